@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// Badge colors, in order of how bad they are; a badge for several agents
+// takes the worst of theirs
+var badgeColors = []string{"lightgrey", "brightgreen", "yellow", "red"}
+
+// badgeHex maps badge colors to the hex shields.io uses for them
+var badgeHex = map[string]string{
+	"lightgrey":   "#9f9f9f",
+	"brightgreen": "#4c1",
+	"yellow":      "#dfb317",
+	"red":         "#e05d44",
+}
+
+// shieldsBadge is the shields.io endpoint badge schema
+// (https://shields.io/badges/endpoint-badge)
+type shieldsBadge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+func newBadgeCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var agent string
+	var fetchTTL time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "badge",
+		Short: "Print a badge saying whether agents are up to date",
+		Long: `Print an SVG badge saying whether installed agents are up to date, e.g.
+"claude: current" in green or "codex: update available" in yellow, for a
+README or status page. With --json, print it as a shields.io endpoint badge
+instead, for https://img.shields.io/endpoint?url=... to render.
+
+Without --agent the badge covers every installed agent, colored by the one
+furthest behind.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			agents := version.Agents
+			if agent != "" {
+				if !slices.Contains(version.Agents, agent) {
+					return fmt.Errorf("unknown --agent %q (want %s)", agent, strings.Join(version.Agents, ", "))
+				}
+				agents = []string{agent}
+			}
+
+			ctx, cancel := flags.withTimeout(cmd.Context())
+			defer cancel()
+			latest := make(map[string]string)
+			if !flags.noFetch {
+				latest = version.FetchLatestCachedContext(ctx, fetchTTL).Latest
+			}
+
+			badge := shieldsBadge{SchemaVersion: 1, Label: "agents", Color: "lightgrey"}
+			var messages []string
+			for _, a := range agents {
+				installed, err := version.GetInstalledContext(ctx, a)
+				if err != nil && agent == "" {
+					continue // Only a badge for one agent says it's missing
+				}
+				message, color := agentBadge(installed, latest[a], flags.minVersions[a], err)
+				if agent != "" {
+					badge.Label = a
+					messages = append(messages, message)
+				} else {
+					messages = append(messages, a+": "+message)
+				}
+				if slices.Index(badgeColors, color) > slices.Index(badgeColors, badge.Color) {
+					badge.Color = color
+				}
+			}
+			badge.Message = strings.Join(messages, ", ")
+			if badge.Message == "" {
+				badge.Message = "none installed"
+			}
+
+			if flags.json {
+				return out.JSON(badge)
+			}
+			out.Printf("%s", badgeSVG(badge))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&agent, "agent", "", "Badge just this agent: "+strings.Join(version.Agents, ", "))
+	cmd.Flags().DurationVar(&fetchTTL, "fetch-ttl", 15*time.Minute, "Fetch latest versions at most once per this duration")
+	return cmd
+}
+
+// agentBadge returns the message and color of one agent's badge
+func agentBadge(installed, latest, minimum string, installErr error) (string, string) {
+	switch {
+	case installErr != nil:
+		return strings.ReplaceAll(version.InstallStatus(installErr), "_", " "), "lightgrey"
+	case version.BelowMinimum(installed, minimum):
+		return "below minimum", "red"
+	case latest == "":
+		return "unknown", "lightgrey"
+	case version.Compare(installed, latest) >= 0:
+		return "current", "brightgreen"
+	default:
+		return "update available", "yellow"
+	}
+}
+
+// badgeSVG draws a badge in the shields.io flat style. Text widths are
+// estimated from the character count, as there are no font metrics to hand.
+func badgeSVG(b shieldsBadge) string {
+	labelW := 6*len(b.Label) + 10
+	messageW := 6*len(b.Message) + 10
+	width := labelW + messageW
+	label, message := html.EscapeString(b.Label), html.EscapeString(b.Message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="14">%[4]s</text>
+<text x="%[8]d" y="14">%[5]s</text>
+</g>
+</svg>
+`, width, labelW, messageW, label, message, badgeHex[b.Color], labelW/2, labelW+messageW/2)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// cacheRefreshResult is what av cache refresh stored
+type cacheRefreshResult struct {
+	Path      string            `json:"path"`
+	Latest    map[string]string `json:"latest"`
+	Errors    map[string]string `json:"errors,omitzero"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	// ExpiresAt is when readers with --fetch-ttl set to the refresh's --ttl
+	// stop trusting the cache
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newCacheCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Refresh or clear the cache of latest versions",
+		Long: `Manage the cache of latest versions that av --fetch-ttl, watch, serve,
+daemon and badge read instead of fetching every time. Refreshing it from
+cron keeps network fetches out of interactive runs entirely.`,
+	}
+
+	var ttl time.Duration
+	refreshCmd := &cobra.Command{
+		Use:   "refresh",
+		Short: "Fetch latest versions into the cache without printing status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := flags.withTimeout(cmd.Context())
+			defer cancel()
+
+			c := version.FetchLatestCachedContext(ctx, 0)
+			result := cacheRefreshResult{
+				Path:      version.CachePath(),
+				Latest:    c.Latest,
+				FetchedAt: c.FetchedAt,
+				ExpiresAt: c.FetchedAt.Add(ttl),
+			}
+			for agent, err := range c.Errors {
+				if result.Errors == nil {
+					result.Errors = make(map[string]string)
+				}
+				result.Errors[agent] = err.Error()
+			}
+			// Nothing fetched means nothing was stored
+			if len(result.Errors) == len(version.Agents) {
+				return fmt.Errorf("couldn't fetch any latest version; cache left as it was")
+			}
+
+			if flags.json {
+				return out.JSON(result)
+			}
+			for _, agent := range version.Agents {
+				if err := c.Errors[agent]; err != nil {
+					out.Warn(fmt.Sprintf("%s: %v", version.DisplayName(agent), err))
+					continue
+				}
+				out.Info(fmt.Sprintf("%s: %s", version.DisplayName(agent), c.Latest[agent]))
+			}
+			out.Success(fmt.Sprintf("Cached in %s; fresh for --fetch-ttl %s until %s", result.Path, ttl, result.ExpiresAt.Local().Format("15:04:05")))
+			return nil
+		},
+	}
+	refreshCmd.Flags().DurationVar(&ttl, "ttl", 15*time.Minute, "The --fetch-ttl readers use, to report when the cache goes stale")
+	cmd.AddCommand(refreshCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Delete the cache, so the next run fetches latest versions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := version.ClearCache()
+			cleared := err == nil
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if flags.json {
+				return out.JSON(struct {
+					Path    string `json:"path"`
+					Cleared bool   `json:"cleared"`
+				}{version.CachePath(), cleared})
+			}
+			if cleared {
+				out.Success("Cleared " + version.CachePath())
+			} else {
+				out.Info("No cache to clear")
+			}
+			return nil
+		},
+	})
+	return cmd
+}
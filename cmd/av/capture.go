@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/tmux"
+	"github.com/spf13/cobra"
+)
+
+// captureResult is a captured pane and what active-work detection made of it
+type captureResult struct {
+	Session    string `json:"session"`
+	Host       string `json:"host,omitempty"`
+	Agent      string `json:"agent"`
+	Lines      int    `json:"lines"`
+	ActiveWork bool   `json:"active_work"`
+	// Pattern names the active-work pattern that matched, and Match the
+	// text it matched
+	Pattern string `json:"pattern,omitempty"`
+	Match   string `json:"match,omitempty"`
+	Content string `json:"content"`
+}
+
+func newCaptureCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var lines int
+
+	cmd := &cobra.Command{
+		Use:   "capture [session]",
+		Short: "Print a session's pane as active-work detection sees it",
+		Long: `Print what a session's tmux pane shows, captured the way active-work
+detection captures it, and which active-work pattern (if any) matched. For
+working out why a session is or isn't reported as busy.
+
+The session is named as for av restart: a tmux session, an unambiguous
+prefix or substring of one, or host:session for a --remote host. With
+--tty it can be left out to capture the session on that terminal. --lines
+sets how much scrollback above the screen is captured; detection uses the
+default.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lines < 0 {
+				return fmt.Errorf("--lines must not be negative")
+			}
+			if len(args) == 0 && flags.tty == "" {
+				return fmt.Errorf("name a session, or pick one with --tty")
+			}
+			ctx, cancel := flags.withTimeout(cmd.Context())
+			defer cancel()
+
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+			s, err := namedSession(ctx, flags, name)
+			if err != nil {
+				return err
+			}
+			content, err := tmux.CapturePaneContext(ctx, runner.For(s.Host), s.TmuxSession, lines)
+			if err != nil {
+				return fmt.Errorf("capture %s: %w", s.Label(), err)
+			}
+
+			result := captureResult{
+				Session: s.TmuxSession,
+				Host:    s.Host,
+				Agent:   s.Agent,
+				Lines:   lines,
+				Content: content,
+			}
+			result.Pattern, result.Match = tmux.ActiveWorkMatch(content)
+			result.ActiveWork = result.Pattern != ""
+
+			if flags.json {
+				return out.JSON(result)
+			}
+			// The pane's empty lines below the prompt are just noise here
+			out.Println(strings.TrimRight(content, "\n"))
+			out.Println()
+			if result.ActiveWork {
+				out.Info(fmt.Sprintf("Active work: pattern %q matched %q", result.Pattern, result.Match))
+			} else {
+				out.Info("No active work: no pattern matched")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&lines, "lines", tmux.ActiveWorkLines, "Lines of scrollback above the screen to capture")
+	return cmd
+}
+
+// namedSession finds the one tmux session name refers to, locally or on
+// a --remote host, among those on the --tty terminal if it's given. An
+// empty name is the session on that terminal.
+func namedSession(ctx context.Context, flags *rootFlags, name string) (*process.Session, error) {
+	sessions, err := process.FindAgentSessionsContext(ctx, runner.Local)
+	if err != nil {
+		return nil, err
+	}
+	tmuxPanes, _ := tmux.GetPanesContext(ctx, runner.Local)
+	process.EnrichWithTmux(sessions, tmuxPanes)
+	for _, host := range flags.remotes {
+		remote, _, err := scanRemote(ctx, host, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("remote %s: %w", host, err)
+		}
+		sessions = append(sessions, remote...)
+	}
+
+	if flags.tty != "" {
+		filtered := process.FilterByTTY(sessions, flags.tty)
+		if len(filtered) == 0 {
+			return nil, process.NoSessionOnTTY(flags.tty, sessions)
+		}
+		sessions = filtered
+	}
+	sessions = filterSessions(sessions, func(s *process.Session) bool { return s.TmuxSession != "" })
+	if name == "" {
+		if len(sessions) == 0 {
+			return nil, fmt.Errorf("the session on %s isn't in tmux", process.NormalizeTTY(flags.tty))
+		}
+		return sessions[0], nil
+	}
+	found, err := matchSessions(sessions, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) > 1 {
+		return nil, ambiguousName(name, found, nil)
+	}
+	return found[0], nil
+}
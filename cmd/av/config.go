@@ -0,0 +1,348 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/buddyh/av/internal/config"
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/tmux"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// loadConfig reads the file given by --config, or the default config if
+// --config wasn't set
+func loadConfig(flags *rootFlags) (*config.Config, error) {
+	var cfg *config.Config
+	var err error
+	if flags.configPath == "" {
+		cfg, err = config.LoadDefault()
+	} else {
+		cfg, err = config.Load(flags.configPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// applyConfig loads the config and uses it for every flag that wasn't given
+// on the command line. It is safe to call again to pick up config changes.
+func applyConfig(cmd *cobra.Command, flags *rootFlags) error {
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		return err
+	}
+
+	set := func(name string, dst *bool, val bool) {
+		if !cmd.Flags().Changed(name) {
+			*dst = val
+		}
+	}
+	set("plain", &flags.plain, cfg.Plain)
+	set("no-color", &flags.noColor, cfg.NoColor)
+	set("symbols", &flags.symbols, cfg.Symbols)
+	set("ascii", &flags.ascii, cfg.ASCII)
+	set("no-fetch", &flags.noFetch, cfg.NoFetch)
+	set("lsof", &flags.lsof, cfg.Lsof)
+	set("claude-prerelease", &flags.claudePrerelease, cfg.ClaudePrerelease)
+	version.SetClaudePrerelease(flags.claudePrerelease)
+	flags.upgradeCommands = cfg.UpgradeCommand
+	flags.versionPatterns = cfg.VersionPattern
+	flags.helperPatterns = cfg.HelperPattern
+	flags.agentColors = cfg.AgentColor
+	if !cmd.Flags().Changed("codex-channel") {
+		flags.codexChannel = cmp.Or(cfg.CodexChannel, version.DefaultChannel)
+	}
+	if err := version.SetCodexChannel(flags.codexChannel); err != nil {
+		return err
+	}
+	if !cmd.Flags().Changed("unknown-work") {
+		flags.unknownWork = cmp.Or(cfg.UnknownWork, config.UnknownWorkSkip)
+	}
+	if err := config.ValidateUnknownWork(flags.unknownWork); err != nil {
+		return fmt.Errorf("--unknown-work: %w", err)
+	}
+
+	// --min-version overrides the config per agent, not as a whole
+	flags.minVersions = maps.Clone(cfg.MinVersion)
+	if flags.minVersions == nil {
+		flags.minVersions = make(map[string]string)
+	}
+	for agent, v := range flags.minVersionFlag {
+		if !slices.Contains(version.Agents, agent) {
+			return fmt.Errorf("--min-version: unknown agent %q", agent)
+		}
+		if !version.IsVersion(v) {
+			return fmt.Errorf("--min-version %s: %q is not a version like 2.0.0", agent, v)
+		}
+		flags.minVersions[agent] = v
+	}
+
+	flags.resumeCommands = maps.Clone(cfg.ResumeCommand)
+	if flags.resumeCommands == nil {
+		flags.resumeCommands = make(map[string]string)
+	}
+	for agent, cmd := range flags.resumeCommandFlag {
+		if !slices.Contains(version.Agents, agent) {
+			return fmt.Errorf("--resume-command: unknown agent %q", agent)
+		}
+		flags.resumeCommands[agent] = cmd
+	}
+
+	for _, agent := range version.Agents {
+		if err := tmux.SetResumeCommand(agent, flags.resumeCommands[agent]); err != nil {
+			return err
+		}
+		if err := process.SetVersionPatterns(agent, flags.versionPatterns[agent]); err != nil {
+			return err
+		}
+		if err := process.SetHelperPatterns(agent, flags.helperPatterns[agent]); err != nil {
+			return err
+		}
+		bin := flags.bins[agent]
+		if !cmd.Flags().Changed(agent + "-bin") {
+			*bin = cfg.Bin[agent]
+		}
+		if err := version.SetBinary(agent, *bin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipConfigAnnotation marks commands that must run without loading the
+// config file, so a broken config can still be replaced
+const skipConfigAnnotation = "av:skip-config"
+
+// effectiveConfig returns the config as the current invocation sees it: the
+// config file with command-line flags applied on top
+func effectiveConfig(flags *rootFlags) *config.Config {
+	cfg := &config.Config{
+		Plain:            flags.plain,
+		NoColor:          flags.noColor,
+		Symbols:          flags.symbols,
+		ASCII:            flags.ascii,
+		NoFetch:          flags.noFetch,
+		Lsof:             flags.lsof,
+		UpgradeCommand:   maps.Clone(flags.upgradeCommands),
+		ClaudePrerelease: flags.claudePrerelease,
+	}
+	if flags.codexChannel != version.DefaultChannel {
+		cfg.CodexChannel = flags.codexChannel
+	}
+	if flags.unknownWork != config.UnknownWorkSkip {
+		cfg.UnknownWork = flags.unknownWork
+	}
+	if len(flags.minVersions) > 0 {
+		cfg.MinVersion = maps.Clone(flags.minVersions)
+	}
+	if len(flags.resumeCommands) > 0 {
+		cfg.ResumeCommand = maps.Clone(flags.resumeCommands)
+	}
+	if len(flags.versionPatterns) > 0 {
+		cfg.VersionPattern = maps.Clone(flags.versionPatterns)
+	}
+	if len(flags.helperPatterns) > 0 {
+		cfg.HelperPattern = maps.Clone(flags.helperPatterns)
+	}
+	if len(flags.agentColors) > 0 {
+		cfg.AgentColor = maps.Clone(flags.agentColors)
+	}
+	for _, agent := range version.Agents {
+		if bin := *flags.bins[agent]; bin != "" {
+			if cfg.Bin == nil {
+				cfg.Bin = make(map[string]string)
+			}
+			cfg.Bin[agent] = bin
+		}
+	}
+	return cfg
+}
+
+// Sources of a config setting, from highest precedence to lowest
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceConfig  = "config"
+	sourceDefault = "default"
+)
+
+// configSetting is one effective config value and where it came from
+type configSetting struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// configSettings returns every effective setting, keyed like the config
+// file's fields ("plain", "bin.claude"), with its source. Per-agent settings
+// are only listed for agents that have one. A config file value equal to
+// the default counts as the default.
+func configSettings(cmd *cobra.Command, flags *rootFlags) (map[string]configSetting, error) {
+	file, err := loadConfig(flags)
+	if err != nil {
+		return nil, err
+	}
+	eff := effectiveConfig(flags)
+
+	// source reports where a setting with flag name came from; given says
+	// whether the flag itself covers it, inFile whether the file sets it
+	source := func(name string, given, inFile bool) string {
+		if f := cmd.Flags().Lookup(name); f != nil && f.Changed && given {
+			if _, ok := f.Annotations[envAnnotation]; ok {
+				return sourceEnv
+			}
+			return sourceFlag
+		}
+		if inFile {
+			return sourceConfig
+		}
+		return sourceDefault
+	}
+
+	settings := make(map[string]configSetting)
+	for _, b := range []struct {
+		key, flag string
+		val, file bool
+	}{
+		{"plain", "plain", eff.Plain, file.Plain},
+		{"no_color", "no-color", eff.NoColor, file.NoColor},
+		{"symbols", "symbols", eff.Symbols, file.Symbols},
+		{"ascii", "ascii", eff.ASCII, file.ASCII},
+		{"no_fetch", "no-fetch", eff.NoFetch, file.NoFetch},
+		{"lsof", "lsof", eff.Lsof, file.Lsof},
+		{"claude_prerelease", "claude-prerelease", eff.ClaudePrerelease, file.ClaudePrerelease},
+	} {
+		settings[b.key] = configSetting{b.val, source(b.flag, true, b.file)}
+	}
+	settings["codex_channel"] = configSetting{flags.codexChannel, source("codex-channel", true, file.CodexChannel != "")}
+	settings["unknown_work"] = configSetting{flags.unknownWork, source("unknown-work", true, file.UnknownWork != "")}
+
+	for _, agent := range version.Agents {
+		if v, ok := eff.Bin[agent]; ok {
+			settings["bin."+agent] = configSetting{v, source(agent+"-bin", true, file.Bin[agent] != "")}
+		}
+		if v, ok := eff.MinVersion[agent]; ok {
+			_, given := flags.minVersionFlag[agent]
+			settings["min_version."+agent] = configSetting{v, source("min-version", given, file.MinVersion[agent] != "")}
+		}
+		if v, ok := eff.ResumeCommand[agent]; ok {
+			_, given := flags.resumeCommandFlag[agent]
+			settings["resume_command."+agent] = configSetting{v, source("resume-command", given, file.ResumeCommand[agent] != "")}
+		}
+		if v, ok := eff.UpgradeCommand[agent]; ok {
+			settings["upgrade_command."+agent] = configSetting{v, sourceConfig}
+		}
+		if v, ok := eff.VersionPattern[agent]; ok {
+			settings["version_pattern."+agent] = configSetting{v, sourceConfig}
+		}
+		if v, ok := eff.HelperPattern[agent]; ok {
+			settings["helper_pattern."+agent] = configSetting{v, sourceConfig}
+		}
+		if v, ok := eff.AgentColor[agent]; ok {
+			settings["agent_color."+agent] = configSetting{v, sourceConfig}
+		}
+	}
+	return settings, nil
+}
+
+// configPath returns the file av reads its config from
+func configPath(flags *rootFlags) string {
+	if flags.configPath != "" {
+		return flags.configPath
+	}
+	return config.DefaultPath()
+}
+
+func newConfigCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show, export or import the av config",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "export",
+		Short: "Print the effective config as JSON",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return out.JSON(effectiveConfig(flags))
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Show each effective setting and where it came from (flag, env, config or default)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			settings, err := configSettings(cmd, flags)
+			if err != nil {
+				return err
+			}
+			if flags.json {
+				return out.JSON(map[string]any{
+					"path":     configPath(flags),
+					"settings": settings,
+				})
+			}
+
+			out.PrintNote("Config file: " + configPath(flags))
+			out.Println()
+			for _, key := range slices.Sorted(maps.Keys(settings)) {
+				s := settings[key]
+				out.Printf("  %-24s %-30v (%s)\n", key, s.Value, s.Source)
+			}
+			return nil
+		},
+	})
+
+	var yes bool
+	importCmd := &cobra.Command{
+		Use:         "import <file>",
+		Short:       "Validate a config file and install it",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{skipConfigAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(args[0])
+			if err == nil {
+				err = validateResumeCommands(cfg)
+			}
+			if err != nil {
+				return fmt.Errorf("import: %w", err)
+			}
+
+			dest := configPath(flags)
+			if _, err := os.Stat(dest); err == nil && !yes {
+				if !confirm(fmt.Sprintf("Replace %s?", dest)) {
+					return fmt.Errorf("import: not replacing %s", dest)
+				}
+			}
+			if err := config.Save(dest, cfg); err != nil {
+				return fmt.Errorf("import: %w", err)
+			}
+			out.Success(fmt.Sprintf("Imported config to %s", dest))
+			return nil
+		},
+	}
+	importCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Replace an existing config without asking")
+	cmd.AddCommand(importCmd)
+
+	return cmd
+}
+
+// validateResumeCommands checks the placeholders in cfg's resume commands,
+// which config.Validate leaves to the tmux package that fills them in
+func validateResumeCommands(cfg *config.Config) error {
+	var errs []error
+	for _, agent := range slices.Sorted(maps.Keys(cfg.ResumeCommand)) {
+		if err := tmux.ValidateResumeCommand(cfg.ResumeCommand[agent]); err != nil {
+			errs = append(errs, fmt.Errorf("resume_command.%s: %w", agent, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// The daemon speaks a line protocol over a Unix socket. A client sends one
+// command per line and gets one line back:
+//
+//	status  -> the status JSON (same shape as av --json) on a single line
+//	ping    -> pong
+//
+// Unknown commands get a line starting with "error:".
+
+// defaultSocketPath returns $XDG_RUNTIME_DIR/av.sock, or a per-user path in
+// the temp dir when XDG_RUNTIME_DIR isn't set
+func defaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "av.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("av-%d.sock", os.Getuid()))
+}
+
+func newDaemonCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var socketPath string
+	var interval time.Duration
+	var fetchTTL time.Duration
+	var scanTTL time.Duration
+	var pprofAddr string
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Scan periodically and serve status over a Unix socket",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval < minWatchInterval {
+				return fmt.Errorf("--interval must be at least %s", minWatchInterval)
+			}
+			if scanTTL < 0 {
+				return fmt.Errorf("--scan-cache-ttl must not be negative")
+			}
+
+			// Remove a stale socket left by a crashed daemon, but refuse to
+			// steal one that's still being served
+			if conn, err := net.Dial("unix", socketPath); err == nil {
+				conn.Close()
+				return fmt.Errorf("daemon already running on %s", socketPath)
+			}
+			os.Remove(socketPath)
+
+			ln, err := net.Listen("unix", socketPath)
+			if err != nil {
+				return fmt.Errorf("listen on %s: %w", socketPath, err)
+			}
+			defer os.Remove(socketPath)
+			defer ln.Close()
+
+			if pprofAddr != "" {
+				stopPprof, err := startPprof(out, pprofAddr)
+				if err != nil {
+					return err
+				}
+				defer stopPprof()
+			}
+
+			d := &daemon{cache: newScanCache(flags, fetchTTL, scanTTL), maxAge: scanTTL > 0, out: out}
+			d.scan()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			go func() {
+				<-ctx.Done()
+				ln.Close()
+			}()
+			go d.scanLoop(ctx, interval)
+
+			out.Info(fmt.Sprintf("Listening on %s", socketPath))
+
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+						return nil
+					}
+					return err
+				}
+				go d.handle(conn)
+			}
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&socketPath, "socket", defaultSocketPath(), "Unix socket path")
+	cmd.Flags().DurationVarP(&interval, "interval", "n", 30*time.Second, "Rescan interval (minimum 1s)")
+	cmd.Flags().DurationVar(&fetchTTL, "fetch-ttl", 15*time.Minute, "Fetch latest versions at most once per this duration")
+	cmd.Flags().DurationVar(&scanTTL, "scan-cache-ttl", 0, "Rescan before answering a status request when the last scan is older than this (0 = always answer from the last scan)")
+	addPprofFlag(cmd, &pprofAddr)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Query a running daemon for status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			line, err := queryDaemon(socketPath, "status")
+			if err != nil {
+				return err
+			}
+			if flags.json {
+				out.Println(line)
+				return nil
+			}
+			// Indented as sent, so the fields keep their order
+			if !json.Valid([]byte(line)) {
+				return fmt.Errorf("bad response from daemon: %q", line)
+			}
+			return out.JSON(json.RawMessage(line))
+		},
+	})
+
+	return cmd
+}
+
+// daemon holds the most recent scan, pre-encoded so client reads are instant
+type daemon struct {
+	cache *scanCache
+	// maxAge makes status requests rescan first when the last scan is
+	// older than the cache's TTL
+	maxAge bool
+	out    *output.Output
+
+	mu     sync.RWMutex
+	report *statusReport
+	status []byte
+}
+
+func (d *daemon) scan() {
+	d.store(d.cache.refresh())
+}
+
+func (d *daemon) store(report *statusReport) {
+	data, err := json.Marshal(report.jsonData())
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	d.report, d.status = report, data
+	d.mu.Unlock()
+}
+
+// current returns the status to answer a request with: the last scan's,
+// unless it has outlived --scan-cache-ttl
+func (d *daemon) current() []byte {
+	if !d.maxAge {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return d.status
+	}
+
+	// Requests wait on a rescan rather than racing it
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if report := d.cache.get(); report != d.report {
+		if data, err := json.Marshal(report.jsonData()); err == nil {
+			d.report, d.status = report, data
+		}
+	}
+	return d.status
+}
+
+// scanLoop rescans on every tick and on refresh signals. Everything runs on
+// this one goroutine so signal-driven and scheduled scans never overlap.
+func (d *daemon) scanLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	refresh, stopRefresh := refreshSignals()
+	defer stopRefresh()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-refresh:
+			if isReload(sig) {
+				report, err := d.cache.reload()
+				if err != nil {
+					d.out.Warn(fmt.Sprintf("Config reload failed: %v", err))
+				}
+				d.store(report)
+			} else {
+				d.scan()
+			}
+			ticker.Reset(interval)
+		case <-ticker.C:
+			d.scan()
+		}
+	}
+}
+
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "status":
+			conn.Write(append(d.current(), '\n'))
+		case "ping":
+			fmt.Fprintln(conn, "pong")
+		default:
+			fmt.Fprintln(conn, "error: unknown command")
+		}
+	}
+}
+
+// queryDaemon sends a single command to the daemon and returns its reply
+func queryDaemon(socketPath, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return "", fmt.Errorf("daemon not running on %s: %w", socketPath, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// agentDiff is one agent's installed version and session count in each of
+// the two statuses compared
+type agentDiff struct {
+	Agent      string `json:"agent"`
+	InstalledA string `json:"installed_a"`
+	InstalledB string `json:"installed_b"`
+	SessionsA  int    `json:"sessions_a"`
+	SessionsB  int    `json:"sessions_b"`
+}
+
+func newDiffCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff <status-a.json> <status-b.json>",
+		Short: "Compare two saved JSON statuses, e.g. from two machines",
+		Long: `Compare two statuses saved with "av --json" or "av snapshot save", e.g. from two
+machines, and show the agents whose installed version or session count
+differs.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := loadSnapshot(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := loadSnapshot(args[1])
+			if err != nil {
+				return err
+			}
+			if a.SessionsOmitted > 0 || b.SessionsOmitted > 0 {
+				out.Warn("A status was saved with --limit; session counts only include the sessions listed")
+			}
+
+			diffs := diffStatus(a, b)
+			if flags.json {
+				return out.JSON(map[string]any{
+					"a":           args[0],
+					"b":           args[1],
+					"differences": diffs,
+				})
+			}
+
+			if len(diffs) == 0 {
+				out.Success("No differences")
+				return nil
+			}
+			out.PrintHeader(fmt.Sprintf("%s -> %s", args[0], args[1]))
+			for _, d := range diffs {
+				var changes []string
+				if d.InstalledA != d.InstalledB {
+					changes = append(changes, fmt.Sprintf("installed %s -> %s", orNone(d.InstalledA), orNone(d.InstalledB)))
+				}
+				if d.SessionsA != d.SessionsB {
+					changes = append(changes, fmt.Sprintf("sessions %d -> %d", d.SessionsA, d.SessionsB))
+				}
+				out.Printf("  %-14s %s\n", version.DisplayName(d.Agent), strings.Join(changes, ", "))
+			}
+			return nil
+		},
+	}
+}
+
+// diffStatus returns the agents whose installed version or session count
+// differs between a and b
+func diffStatus(a, b *statusSnapshot) []agentDiff {
+	diffs := []agentDiff{}
+	for _, agent := range version.Agents {
+		d := agentDiff{
+			Agent:      agent,
+			InstalledA: a.Installed[agent],
+			InstalledB: b.Installed[agent],
+			SessionsA:  countAgent(a.Sessions, agent),
+			SessionsB:  countAgent(b.Sessions, agent),
+		}
+		if d.InstalledA != d.InstalledB || d.SessionsA != d.SessionsB {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+func countAgent(sessions []*process.Session, agent string) int {
+	n := 0
+	for _, s := range sessions {
+		if s.Agent == agent {
+			n++
+		}
+	}
+	return n
+}
+
+// orNone shows an empty version as "none"
+func orNone(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return v
+}
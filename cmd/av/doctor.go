@@ -0,0 +1,131 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/termcaps"
+	"github.com/buddyh/av/internal/tmux"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// doctorAgent is the doctor report for one agent
+type doctorAgent struct {
+	Installed string            `json:"installed"`
+	Status    string            `json:"install_status"`
+	Installs  []version.Install `json:"installs"`
+	Conflict  bool              `json:"conflicting_installs"`
+	// Sessions counts the agent's running sessions; with no detectable
+	// installed version none of them can be checked for restart
+	Sessions int `json:"running_sessions"`
+}
+
+func newDoctorCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose detection problems (tmux, shadowed installs)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tmuxOK := tmux.IsAvailable(runner.Local)
+			caps := termcaps.Detect()
+			sessions, _ := process.FindAgentSessions(runner.Local)
+
+			agents := make(map[string]*doctorAgent)
+			for _, agent := range version.Agents {
+				installed, err := version.GetInstalled(agent)
+				installs := version.FindInstalls(agent)
+				// A lone install's version is the detected one
+				if len(installs) == 1 {
+					installs[0].Version = installed
+				}
+				agents[agent] = &doctorAgent{
+					Installed: installed,
+					Status:    version.InstallStatus(err),
+					Installs:  installs,
+					Conflict:  version.ConflictingInstalls(installs),
+				}
+			}
+			for _, s := range sessions {
+				agents[s.Agent].Sessions++
+			}
+
+			if flags.json {
+				return out.JSON(map[string]any{
+					"tmux_available": tmuxOK,
+					"terminal":       caps,
+					"agents":         agents,
+				})
+			}
+
+			out.PrintHeader("tmux")
+			if tmuxOK {
+				out.Success("tmux server is running")
+			} else {
+				out.Warn("tmux not available; session names and restart won't work")
+			}
+			out.Println()
+
+			out.PrintHeader("Terminal")
+			printTermcaps(out, caps)
+			out.Println()
+
+			for _, agent := range version.Agents {
+				d := agents[agent]
+				out.PrintHeader(version.DisplayName(agent))
+				if len(d.Installs) == 0 {
+					out.PrintNote("not installed")
+				}
+				for _, i := range d.Installs {
+					path := i.Path
+					if i.Target != "" {
+						path += " -> " + i.Target
+					}
+					v := i.Version
+					if v == "" {
+						v = "?"
+					}
+					active := ""
+					if i.Active {
+						active = "  (active)"
+					}
+					out.Printf("  %-10s %s%s\n", v, path, active)
+				}
+				if d.Conflict {
+					out.Warn(fmt.Sprintf("%d %s installs with different versions; sessions may run a different one than `%s` reports", len(d.Installs), agent, agent))
+				}
+				if d.Installed == "" && d.Sessions > 0 {
+					out.Warn(fmt.Sprintf("%d %s session(s) running but the installed version couldn't be determined; restart detection is disabled for them", d.Sessions, agent))
+				}
+				out.Println()
+			}
+			return nil
+		},
+	}
+}
+
+// printTermcaps shows what termcaps detected about the terminal, which
+// decides colors and glyphs
+func printTermcaps(out *output.Output, caps termcaps.Caps) {
+	term := cmp.Or(caps.Term, "(unset)")
+	if caps.Program != "" {
+		term += " in " + caps.Program
+	}
+	if caps.Multiplexer {
+		term += ", inside tmux or screen"
+	}
+	width := "unknown"
+	if caps.Width > 0 {
+		width = fmt.Sprintf("%d columns", caps.Width)
+	}
+	glyphs := "Unicode"
+	if !caps.Unicode {
+		glyphs = "ASCII only"
+	}
+	out.Printf("  %-10s %s\n", "terminal", term)
+	out.Printf("  %-10s %s\n", "colors", caps.Colors)
+	out.Printf("  %-10s %s\n", "glyphs", glyphs)
+	out.Printf("  %-10s %s\n", "width", width)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/tmux"
+)
+
+// Enrichment steps a status scan runs, each of which --skip-enrich can turn
+// off
+const (
+	// enrichTmux maps sessions to their tmux session, pane and path
+	enrichTmux = "tmux"
+	// enrichCwd finds the working dir of sessions outside tmux
+	enrichCwd = "cwd"
+	// enrichActiveWork captures each tmux pane to look for work in progress
+	enrichActiveWork = "active-work"
+	// enrichModel looks up the model of sessions not launched with one in
+	// their transcript or the agent's config
+	enrichModel = "model"
+)
+
+var enrichSteps = []string{enrichTmux, enrichCwd, enrichActiveWork, enrichModel}
+
+// validateSkipEnrich checks --skip-enrich names only known steps
+func validateSkipEnrich(skip []string) error {
+	for _, step := range skip {
+		if !slices.Contains(enrichSteps, step) {
+			return fmt.Errorf("--skip-enrich: unknown step %q (want %s)", step, strings.Join(enrichSteps, ", "))
+		}
+	}
+	return nil
+}
+
+// enriches reports whether a status scan runs step
+func (f *rootFlags) enriches(step string) bool {
+	return !f.noEnrich && !slices.Contains(f.skipEnrich, step)
+}
+
+// activeWork returns the step that checks a session's tmux pane, on r's
+// host, for work in progress. Once the host's tmux turns out not to
+// capture panes at all, the remaining sessions are left unknown without
+// trying theirs.
+func activeWork(r runner.Runner) process.Enricher {
+	var unsupported atomic.Bool
+	return func(ctx context.Context, s *process.Session) {
+		if s.TmuxSession == "" {
+			return
+		}
+		if unsupported.Load() {
+			s.ActiveWorkUnknown = true
+			return
+		}
+		busy, err := tmux.ActiveWorkContext(ctx, r, s.TmuxSession)
+		s.HasActiveWork, s.ActiveWorkUnknown = busy, err != nil
+		if errors.Is(err, tmux.ErrCaptureUnsupported) {
+			unsupported.Store(true)
+		}
+	}
+}
+
+// conversation is the step that notes which conversation a tmux session is
+// in, while its process is still around to ask
+func conversation(ctx context.Context, s *process.Session) {
+	if s.TmuxSession != "" {
+		s.ConversationID = process.ConversationIDContext(ctx, s)
+	}
+}
+
+// model returns the step that finds the model of a session not launched
+// with one, running lsof for it only if useLsof is set
+func model(useLsof bool) process.Enricher {
+	return func(ctx context.Context, s *process.Session) {
+		s.Model = process.ModelContext(ctx, s, useLsof)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+// BenchmarkActiveWork runs the active-work step, whose tmux capture-pane
+// per session dominates a scan, over many sessions with and without the
+// worker pool
+func BenchmarkActiveWork(b *testing.B) {
+	r := &runnertest.Fake{Func: func(cmdline string) ([]byte, error) {
+		if !strings.HasPrefix(cmdline, "tmux capture-pane") {
+			return nil, fmt.Errorf("unexpected %q", cmdline)
+		}
+		time.Sleep(2 * time.Millisecond) // About what spawning tmux costs
+		return []byte("> \n"), nil
+	}}
+	sessions := make([]*process.Session, 64)
+	for i := range sessions {
+		sessions[i] = &process.Session{PID: i + 1, TmuxSession: fmt.Sprintf("s%d", i)}
+	}
+
+	for _, workers := range []int{1, remoteWorkers, process.EnrichWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				process.EnrichContext(context.Background(), sessions, workers, activeWork(r))
+			}
+		})
+	}
+}
+
+func TestActiveWorkStopsCapturingWhenUnsupported(t *testing.T) {
+	r := &runnertest.Fake{Func: func(cmdline string) ([]byte, error) {
+		if !strings.HasPrefix(cmdline, "tmux capture-pane") {
+			return nil, fmt.Errorf("unexpected %q", cmdline)
+		}
+		return nil, fmt.Errorf("tmux: %w", exec.ErrNotFound)
+	}}
+	sessions := []*process.Session{
+		{PID: 1, TmuxSession: "api"},
+		{PID: 2, TmuxSession: "web"},
+		{PID: 3, TmuxSession: "docs"},
+		{PID: 4}, // Not in tmux
+	}
+	process.EnrichContext(context.Background(), sessions, 1, activeWork(r))
+
+	if n := r.Count("tmux capture-pane"); n != 1 {
+		t.Errorf("capture-pane ran %d times, want once", n)
+	}
+	for _, s := range sessions {
+		if want := s.TmuxSession != ""; s.ActiveWorkUnknown != want || s.HasActiveWork {
+			t.Errorf("session %d: unknown %v, busy %v; want unknown %v, not busy", s.PID, s.ActiveWorkUnknown, s.HasActiveWork, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// ensureReport is what av ensure did, or with --dry-run would have done
+type ensureReport struct {
+	Upgrades []*upgradeResult `json:"upgrades"`
+	Restarts []restartResult  `json:"restarts"`
+	// Acted is set when anything was upgraded or restarted (or would have
+	// been, in a dry run)
+	Acted bool `json:"acted"`
+}
+
+func newEnsureCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var dryRun bool
+	var yes bool
+	var noUpgrade bool
+	var detachedOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "ensure [agent...]",
+		Short: "Upgrade agents behind latest and restart outdated sessions, in one go",
+		Long: `Bring agents to the latest version: upgrade each installed agent that's
+behind latest (unless --no-upgrade), then restart the tmux sessions still
+running an older version than the one installed. Running it again once
+everything is current does nothing, so it suits a cron job or login hook.
+
+Busy sessions are skipped as with av restart, and upgrades and restarts are
+confirmed first unless --yes (or --json) is given. Exits 0 if there was
+nothing to do, 3 if anything was upgraded or restarted (or, with
+--dry-run, would be), and 1 if an upgrade or restart failed.`,
+		ValidArgs: version.Agents,
+		Args:      cobra.OnlyValidArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateRestartFlags(flags); err != nil {
+				return err
+			}
+			agents := args
+			if len(agents) == 0 {
+				agents = version.Agents
+			}
+
+			report := &ensureReport{Upgrades: []*upgradeResult{}, Restarts: []restartResult{}}
+			if !noUpgrade {
+				for _, agent := range version.Agents {
+					if slices.Contains(agents, agent) {
+						report.Upgrades = append(report.Upgrades, upgradeAgent(flags, out, agent, dryRun, yes))
+					}
+				}
+			}
+
+			// Upgrades are done, so like restart the rest only needs the
+			// installed versions
+			version.SetOffline(true)
+			restarts, err := ensureRestarts(cmd.Context(), flags, out, agents, report.Upgrades, dryRun, yes, detachedOnly)
+			if err != nil {
+				return err
+			}
+			report.Restarts = append(report.Restarts, restarts...)
+
+			failed := 0
+			for _, u := range report.Upgrades {
+				report.Acted = report.Acted || u.Upgraded || u.Skipped == "dry run"
+				if u.Error != "" {
+					failed++
+				}
+			}
+			for _, r := range report.Restarts {
+				report.Acted = report.Acted || r.Restarted || r.Skipped == "dry run"
+				if r.Error != "" {
+					failed++
+				}
+			}
+
+			if flags.json {
+				if err := out.JSON(report); err != nil {
+					return err
+				}
+			} else if !report.Acted && failed == 0 {
+				out.Success("Everything is up to date")
+			} else if !dryRun {
+				printUpgradeSummary(out, report.Upgrades, report.Restarts)
+			}
+
+			switch {
+			case failed > 0:
+				return fmt.Errorf("%d upgrade(s) or restart(s) failed", failed)
+			case report.Acted:
+				return &exitError{code: exitActed}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be upgraded and restarted without doing it")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	cmd.Flags().BoolVar(&noUpgrade, "no-upgrade", false, "Only restart sessions behind the installed version; don't upgrade anything")
+	cmd.Flags().BoolVar(&detachedOnly, "detached-only", false, "Skip sessions a tmux client is attached to")
+	addRestartFlags(cmd, flags)
+	return cmd
+}
+
+// ensureRestarts restarts the agents' tmux sessions running a version other
+// than the installed one, after asking unless yes. In a dry run it returns
+// what it would restart instead, counting the upgrades that would have been
+// made as installed.
+func ensureRestarts(ctx context.Context, flags *rootFlags, out *output.Output, agents []string, upgrades []*upgradeResult, dryRun, yes, detachedOnly bool) ([]restartResult, error) {
+	installed, sessions, err := scanForRestart(ctx, flags, out)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		for _, u := range upgrades {
+			if u.Skipped == "dry run" && u.Latest != "" {
+				installed[u.Agent] = u.Latest
+			}
+		}
+	}
+
+	sessions = filterSessions(sessions, func(s *process.Session) bool { return slices.Contains(agents, s.Agent) })
+	if stuck := unrestartable(sessions, installed, false); len(stuck) > 0 {
+		out.Warn(stuckMessage(stuck, runner.For))
+	}
+	candidates := restartCandidates(sessions, installed, false)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	if dryRun {
+		var results []restartResult
+		for _, s := range candidates {
+			results = append(results, restartResult{
+				Session:     s.TmuxSession,
+				Host:        s.Host,
+				Agent:       s.Agent,
+				FromVersion: s.RunningVersion,
+				ToVersion:   s.CurrentVersion(installed),
+				Skipped:     "dry run",
+			})
+			if !flags.json {
+				out.Info(fmt.Sprintf("%s: would restart %s -> %s", s.Label(), s.RunningVersion, s.CurrentVersion(installed)))
+			}
+		}
+		return results, nil
+	}
+
+	var labels []string
+	for _, s := range candidates {
+		labels = append(labels, s.Label())
+	}
+
+	if !yes && !flags.json && !confirm(fmt.Sprintf("Restart %d outdated session(s): %s?", len(candidates), strings.Join(labels, ", "))) {
+		out.Info("Restarts skipped")
+		return nil, nil
+	}
+	return restartSessions(ctx, out, flags, candidates, installed, detachedOnly, false), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variable for each flag
+const envPrefix = "AV_"
+
+// envAnnotation marks a flag as set from its environment variable rather
+// than the command line
+const envAnnotation = "av:from-env"
+
+// envName returns the environment variable for a flag: --no-fetch is
+// AV_NO_FETCH
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyEnv sets each of the command's flags, its own and the global ones,
+// not given on the command line from its AV_ environment variable. Setting
+// it marks the flag as given, so the precedence is flag, then environment,
+// then config file. Repeatable flags take a comma-separated list.
+func applyEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || noEnvFlags[f.Name] {
+			return
+		}
+		name := envName(f.Name)
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		vals := []string{val}
+		if f.Value.Type() == "stringArray" {
+			vals = strings.Split(val, ",")
+		}
+		for _, v := range vals {
+			if serr := cmd.Flags().Set(f.Name, strings.TrimSpace(v)); serr != nil {
+				err = fmt.Errorf("%s: %w", name, serr)
+				return
+			}
+		}
+		err = cmd.Flags().SetAnnotation(f.Name, envAnnotation, []string{name})
+	})
+	return err
+}
+
+// noEnvFlags are cobra's own flags, which only make sense typed
+var noEnvFlags = map[string]bool{"help": true, "version": true}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/version"
+)
+
+// Exit statuses. Anything that isn't an exitError exits with exitFailure.
+const (
+	exitFailure = 1
+	// exitBelowMinimum means an install or session is older than its
+	// --min-version, a policy violation rather than a detection problem
+	exitBelowMinimum = 2
+	// exitActed means av ensure upgraded or restarted something (or, with
+	// --dry-run, would have); nothing went wrong
+	exitActed = 3
+)
+
+// exitError makes av exit with a specific status. One without an err only
+// sets the status, with nothing to report.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// statusOnly reports whether err only sets the exit status
+func statusOnly(err error) bool {
+	var e *exitError
+	return errors.As(err, &e) && e.err == nil
+}
+
+// exitCode returns the status av exits with for err
+func exitCode(err error) int {
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
+
+// belowMinimum returns the agents whose install, and the sessions whose
+// running version, is older than the agent's minimum
+func belowMinimum(installed map[string]string, installErr map[string]error, sessions []*process.Session, minimums map[string]string) ([]string, []*process.Session) {
+	var agents []string
+	for _, agent := range version.Agents {
+		if installErr[agent] == nil && version.BelowMinimum(installed[agent], minimums[agent]) {
+			agents = append(agents, agent)
+		}
+	}
+	var below []*process.Session
+	for _, s := range sessions {
+		if version.BelowMinimum(s.RunningVersion, minimums[s.Agent]) {
+			below = append(below, s)
+		}
+	}
+	return agents, below
+}
+
+// minimumError describes everything below its minimum version as an error
+// that exits with exitBelowMinimum, or returns nil if nothing is
+func minimumError(installed map[string]string, installErr map[string]error, sessions []*process.Session, minimums map[string]string) error {
+	agents, below := belowMinimum(installed, installErr, sessions, minimums)
+	if len(agents) == 0 && len(below) == 0 {
+		return nil
+	}
+
+	var items []string
+	for _, agent := range agents {
+		items = append(items, fmt.Sprintf("%s %s installed (minimum %s)", agent, installed[agent], minimums[agent]))
+	}
+	for _, s := range below {
+		items = append(items, fmt.Sprintf("%s running %s %s (minimum %s)", s.Label(), s.Agent, s.RunningVersion, minimums[s.Agent]))
+	}
+	return &exitError{code: exitBelowMinimum, err: fmt.Errorf("below minimum version: %s", strings.Join(items, "; "))}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/buddyh/av/internal/process"
+)
+
+// historyTTL is how long a session that hasn't been seen is remembered
+const historyTTL = 30 * 24 * time.Hour
+
+// historySeenInterval is how stale a session's LastSeen may get before a
+// scan updates it. Against historyTTL an hour is nothing, and it spares
+// every watch tick a rewrite of the file.
+const historySeenInterval = time.Hour
+
+// historyEntry is what av remembers about one session between runs
+type historyEntry struct {
+	// OutdatedSince is when the session was first seen running an
+	// outdated version; zero while it is current
+	OutdatedSince time.Time `json:"outdated_since,omitzero"`
+	Restarts      int       `json:"restarts,omitempty"`
+	LastSeen      time.Time `json:"last_seen"`
+	// Label is the user's name for the session, set with av label
+	Label string `json:"label,omitempty"`
+}
+
+// sessionHistory holds the history of every session, by historyKey
+type sessionHistory map[string]*historyEntry
+
+// historyKey identifies a session across runs by its label (host and tmux
+// session) and working dir. Only tmux sessions have one: anything else is
+// known only by a PID that changes on every restart.
+func historyKey(s *process.Session) string {
+	return s.Label() + "|" + s.WorkingDir
+}
+
+func historyPath() string {
+	return filepath.Join(stateDir(), "sessions.json")
+}
+
+// loadHistory reads the session history; a missing file is an empty history
+func loadHistory() (sessionHistory, error) {
+	h := make(sessionHistory)
+	data, err := os.ReadFile(historyPath())
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// updateHistory loads the history, lets update change it and saves it if
+// update reports a change, all under an exclusive lock on the history, so
+// concurrent runs (a watch, a daemon, av label) don't lose each other's
+// updates
+func updateHistory(update func(h sessionHistory) bool) error {
+	return withLock(historyPath(), func() error {
+		h, err := loadHistory()
+		if err != nil {
+			return err
+		}
+		if !update(h) {
+			return nil
+		}
+		return h.save()
+	})
+}
+
+// withLock runs fn holding an exclusive lock on path, taken on path.lock
+// beside it so path itself can be replaced or renamed meanwhile
+func withLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close() // Releases the lock
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s: %w", path, err)
+	}
+	return fn()
+}
+
+// entry returns the history of s, adding an empty one if there's none
+func (h sessionHistory) entry(s *process.Session) *historyEntry {
+	e := h[historyKey(s)]
+	if e == nil {
+		e = &historyEntry{}
+		h[historyKey(s)] = e
+	}
+	return e
+}
+
+// save writes the history atomically, so concurrent runs never read half a
+// file. Callers go through updateHistory, which holds the lock.
+func (h sessionHistory) save() error {
+	path := historyPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// trackHistory updates the history with this scan's sessions: when each
+// started being outdated, and that it was seen. The sessions get their
+// OutdatedSince, Restarts and UserLabel filled in from it. The file is only
+// rewritten when something in it changed.
+func trackHistory(sessions []*process.Session, installed map[string]string) error {
+	return updateHistory(func(h sessionHistory) bool {
+		changed := false
+		now := time.Now()
+		for _, s := range sessions {
+			if s.TmuxSession == "" {
+				continue
+			}
+			e := h[historyKey(s)]
+			if e == nil {
+				e = h.entry(s)
+				changed = true
+			}
+			if now.Sub(e.LastSeen) > historySeenInterval {
+				e.LastSeen = now
+				changed = true
+			}
+
+			// An unknown version says nothing either way
+			current := s.CurrentVersion(installed)
+			if s.RunningVersion != "" && current != "" {
+				if s.RunningVersion == current && !e.OutdatedSince.IsZero() {
+					e.OutdatedSince = time.Time{}
+					changed = true
+				} else if s.RunningVersion != current && e.OutdatedSince.IsZero() {
+					e.OutdatedSince = now
+					changed = true
+				}
+			}
+			s.OutdatedSince = e.OutdatedSince
+			s.Restarts = e.Restarts
+			s.UserLabel = e.Label
+		}
+
+		for key, e := range h {
+			if now.Sub(e.LastSeen) > historyTTL {
+				delete(h, key)
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// recordRestarts counts a restart for each of sessions
+func recordRestarts(sessions []*process.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	return updateHistory(func(h sessionHistory) bool {
+		changed := false
+		for _, s := range sessions {
+			if s.TmuxSession == "" {
+				continue
+			}
+			e := h.entry(s)
+			e.Restarts++
+			e.LastSeen = time.Now()
+			changed = true
+		}
+		return changed
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/buddyh/av/internal/process"
+)
+
+func TestTrackHistorySkipsUnchangedSaves(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	installed := map[string]string{"claude": "2.1.14"}
+	sessions := func() []*process.Session {
+		return []*process.Session{{Agent: "claude", TmuxSession: "api", WorkingDir: "/repos/api", RunningVersion: "2.1.9"}}
+	}
+
+	if err := trackHistory(sessions(), installed); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(historyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := before.ModTime().Add(-time.Minute)
+	if err := os.Chtimes(historyPath(), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second scan of the same sessions has nothing new to record
+	s := sessions()
+	if err := trackHistory(s, installed); err != nil {
+		t.Fatal(err)
+	}
+	if s[0].OutdatedSince.IsZero() {
+		t.Error("OutdatedSince wasn't filled in from the history")
+	}
+	after, err := os.Stat(historyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(old) {
+		t.Error("history was rewritten though nothing changed")
+	}
+
+	// Once it runs the installed version it is current again
+	s[0].RunningVersion = "2.1.14"
+	if err := trackHistory(s, installed); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := loadHistory(); err != nil || !h[historyKey(s[0])].OutdatedSince.IsZero() {
+		t.Errorf("history after updating = %v, %v; want OutdatedSince cleared", h[historyKey(s[0])], err)
+	}
+}
+
+func TestRecordRestartsConcurrently(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	s := &process.Session{Agent: "claude", TmuxSession: "api", WorkingDir: "/repos/api"}
+
+	const runs = 20
+	var wg sync.WaitGroup
+	for range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := recordRestarts([]*process.Session{s}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	h, err := loadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h[historyKey(s)].Restarts; got != runs {
+		t.Errorf("Restarts = %d after %d concurrent restarts, want %d", got, runs, runs)
+	}
+}
+
+func TestSetLabelAlongsideRestarts(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	s := &process.Session{Agent: "claude", TmuxSession: "api", WorkingDir: "/repos/api"}
+	other := &process.Session{Agent: "codex", TmuxSession: "web", WorkingDir: "/repos/web"}
+
+	// av label run while a restart records itself loses neither update
+	const runs = 10
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := recordRestarts([]*process.Session{s}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			target := s
+			if i%2 == 1 {
+				target = other
+			}
+			if err := setLabel(target, "frontend-refactor"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	h, err := loadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := h[historyKey(s)]; e.Restarts != runs || e.Label != "frontend-refactor" {
+		t.Errorf("api history = %+v, want %d restarts and its label", *e, runs)
+	}
+	if e := h[historyKey(other)]; e == nil || e.Label != "frontend-refactor" {
+		t.Errorf("web history = %+v, want its label", e)
+	}
+
+	if err := setLabel(s, ""); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := loadHistory(); err != nil || h[historyKey(s)].Label != "" || h[historyKey(s)].Restarts != runs {
+		t.Errorf("api history after clearing = %+v, %v; want no label and its restarts kept", h[historyKey(s)], err)
+	}
+}
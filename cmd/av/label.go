@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/spf13/cobra"
+)
+
+// labelResult is the label av label set on a session
+type labelResult struct {
+	Session string `json:"session"`
+	Host    string `json:"host,omitempty"`
+	Label   string `json:"label"`
+}
+
+func newLabelCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var clear bool
+
+	cmd := &cobra.Command{
+		Use:   "label <session> [text]",
+		Short: "Name what a session is for",
+		Long: `Give a tmux session a label of your own, e.g. "frontend-refactor", shown
+in the sessions table's LABEL column and as user_label in JSON. The label
+is kept with the session's history, so it survives restarts for as long
+as the session keeps its name and working dir. --clear removes it.
+
+The session is named as for av restart: a tmux session, an unambiguous
+prefix or substring of one, or host:session for a --remote host.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var text string
+			if len(args) == 2 {
+				text = strings.TrimSpace(args[1])
+			}
+			switch {
+			case clear && text != "":
+				return fmt.Errorf("--clear takes no label text")
+			case !clear && text == "":
+				return fmt.Errorf("give the label text, or --clear to remove the label")
+			}
+
+			ctx, cancel := flags.withTimeout(cmd.Context())
+			defer cancel()
+			s, err := namedSession(ctx, flags, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := setLabel(s, text); err != nil {
+				return fmt.Errorf("save session history: %w", err)
+			}
+
+			if flags.json {
+				return out.JSON(labelResult{Session: s.TmuxSession, Host: s.Host, Label: text})
+			}
+			if clear {
+				out.Success(fmt.Sprintf("Cleared the label of %s", s.Label()))
+			} else {
+				out.Success(fmt.Sprintf("Labeled %s %q", s.Label(), text))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&clear, "clear", false, "Remove the session's label")
+	return cmd
+}
+
+// setLabel sets the label kept in s's history; "" removes it
+func setLabel(s *process.Session, text string) error {
+	return updateHistory(func(h sessionHistory) bool {
+		e := h.entry(s)
+		e.Label = text
+		e.LastSeen = time.Now()
+		return true
+	})
+}
@@ -4,6 +4,6 @@ import "os"
 
 func main() {
 	if err := execute(os.Args[1:]); err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/version"
+)
+
+// matchSessions resolves names as typed on the command line (a session
+// label like "work" or "dev@box:work", or an agent name) to sessions. Each
+// name matches, in order of precedence: a session label exactly, an agent
+// exactly, then a unique prefix of a label or agent, then a unique substring
+// of a label. A name that matches several sessions as a partial is an error
+// listing them.
+func matchSessions(sessions []*process.Session, names []string) ([]*process.Session, error) {
+	var matched []*process.Session
+	for _, name := range names {
+		found, err := matchSession(sessions, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range found {
+			if !slices.Contains(matched, s) {
+				matched = append(matched, s)
+			}
+		}
+	}
+	return matched, nil
+}
+
+func matchSession(sessions []*process.Session, name string) ([]*process.Session, error) {
+	if found := filterSessions(sessions, func(s *process.Session) bool {
+		return s.Label() == name || (s.TmuxSession != "" && s.TmuxSession == name)
+	}); len(found) > 0 {
+		return found, nil
+	}
+	if slices.Contains(version.Agents, name) {
+		return agentSessions(sessions, name)
+	}
+
+	lower := strings.ToLower(name)
+	byPrefix := filterSessions(sessions, func(s *process.Session) bool {
+		return strings.HasPrefix(strings.ToLower(s.Label()), lower) ||
+			strings.HasPrefix(strings.ToLower(s.TmuxSession), lower)
+	})
+	var agents []string
+	for _, agent := range version.Agents {
+		if strings.HasPrefix(agent, lower) {
+			agents = append(agents, agent)
+		}
+	}
+	switch {
+	case len(byPrefix) == 1 && len(agents) == 0:
+		return byPrefix, nil
+	case len(byPrefix) == 0 && len(agents) == 1:
+		return agentSessions(sessions, agents[0])
+	case len(byPrefix) > 0 || len(agents) > 0:
+		return nil, ambiguousName(name, byPrefix, agents)
+	}
+
+	bySubstring := filterSessions(sessions, func(s *process.Session) bool {
+		return strings.Contains(strings.ToLower(s.Label()), lower)
+	})
+	switch len(bySubstring) {
+	case 0:
+		return nil, fmt.Errorf("no session or agent matches %q", name)
+	case 1:
+		return bySubstring, nil
+	default:
+		return nil, ambiguousName(name, bySubstring, nil)
+	}
+}
+
+// agentSessions returns the agent's sessions, or an error if it has none
+func agentSessions(sessions []*process.Session, agent string) ([]*process.Session, error) {
+	found := filterSessions(sessions, func(s *process.Session) bool { return s.Agent == agent })
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no %s sessions running", agent)
+	}
+	return found, nil
+}
+
+func filterSessions(sessions []*process.Session, keep func(*process.Session) bool) []*process.Session {
+	var found []*process.Session
+	for _, s := range sessions {
+		if keep(s) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// ambiguousName is the error for a name matching more than one thing
+func ambiguousName(name string, sessions []*process.Session, agents []string) error {
+	candidates := slices.Clone(agents)
+	for _, s := range sessions {
+		candidates = append(candidates, s.Label())
+	}
+	return fmt.Errorf("%q is ambiguous; did you mean one of: %s", name, strings.Join(candidates, ", "))
+}
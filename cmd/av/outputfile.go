@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// outputFile is the destination for --output-file. In atomic mode output goes
+// to a temp file next to the target, which is renamed into place only once
+// the command succeeds.
+type outputFile struct {
+	*os.File
+	path   string
+	atomic bool
+}
+
+func openOutputFile(path string, atomic bool) (*outputFile, error) {
+	if !atomic {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("output file: %w", err)
+		}
+		return &outputFile{File: f, path: path}, nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("output file: %w", err)
+	}
+	return &outputFile{File: f, path: path, atomic: true}, nil
+}
+
+// finish closes the file. In atomic mode it renames the temp file into place
+// on success and discards it on failure, leaving any previous file intact.
+func (f *outputFile) finish(success bool) error {
+	closeErr := f.Close()
+	if !f.atomic {
+		if closeErr != nil {
+			return fmt.Errorf("output file: %w", closeErr)
+		}
+		return nil
+	}
+	if !success || closeErr != nil {
+		os.Remove(f.Name())
+		if closeErr != nil {
+			return fmt.Errorf("output file: %w", closeErr)
+		}
+		return nil
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("output file: %w", err)
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("output file: %w", err)
+	}
+	return nil
+}
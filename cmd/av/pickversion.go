@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/tui"
+	"github.com/buddyh/av/internal/version"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pickVersion asks which locally installed version the sessions' agent
+// should be restarted onto, and points the sessions at its binary. It
+// returns installed with the agent's entry replaced by the picked version,
+// so sessions on any other version count as needing restart, and false if
+// the user cancelled.
+func pickVersion(flags *rootFlags, sessions []*process.Session, installed map[string]string) (map[string]string, bool, error) {
+	var agent string
+	for _, s := range sessions {
+		if s.Host != "" {
+			return nil, false, errors.New("--pick-version only works on local sessions: the versions offered are the ones installed here")
+		}
+		if agent != "" && s.Agent != agent {
+			return nil, false, errors.New("--pick-version needs sessions of a single agent; name them, e.g. `av restart claude --pick-version`")
+		}
+		agent = s.Agent
+	}
+	if agent == "" {
+		return nil, false, errors.New("no sessions to restart")
+	}
+
+	versions, err := version.ListInstalled(agent)
+	if err != nil {
+		return nil, false, fmt.Errorf("list installed %s versions: %w", agent, err)
+	}
+
+	picker := tui.NewVersionPicker(fmt.Sprintf("Restart %s sessions onto:", version.DisplayName(agent)), versions).WithASCII(flags.ascii)
+	finalModel, err := tea.NewProgram(picker).Run()
+	if err != nil {
+		return nil, false, fmt.Errorf("picker error: %w", err)
+	}
+	result := finalModel.(tui.VersionPickerModel)
+	if result.Cancelled() {
+		return nil, false, nil
+	}
+
+	picked := result.Selected()
+	for _, s := range sessions {
+		// The active version is what the agent's usual binary runs
+		if !picked.Active {
+			s.ResumeBinary = picked.Path
+		}
+	}
+	installed = maps.Clone(installed)
+	installed[agent] = picked.Version
+	return installed, true, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// defaultPprofAddr is where --pprof listens when given without a value.
+// Profiles expose internals, so it only binds to loopback.
+const defaultPprofAddr = "localhost:6060"
+
+// addPprofFlag registers --pprof[=addr] on a long-running command
+func addPprofFlag(cmd *cobra.Command, addr *string) {
+	cmd.Flags().StringVar(addr, "pprof", "", "Serve net/http/pprof on this address (default "+defaultPprofAddr+" when given without a value)")
+	cmd.Flags().Lookup("pprof").NoOptDefVal = defaultPprofAddr
+}
+
+// startPprof serves the pprof endpoints under /debug/pprof/ on their own
+// listener, separate from any status server. The returned function stops it.
+func startPprof(out *output.Output, addr string) (func(), error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("--pprof: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		out.Warn(fmt.Sprintf("pprof is listening on non-loopback address %s", addr))
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("pprof: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	out.Info(fmt.Sprintf("pprof on http://%s/debug/pprof/", ln.Addr()))
+	return func() { srv.Close() }, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/tmux"
+	"github.com/buddyh/av/internal/version"
+)
+
+// remoteWorkers caps how many panes are captured at once on a --remote
+// host. Each capture is an ssh connection of its own, and sshd starts
+// dropping new ones beyond 10 still authenticating (MaxStartups).
+const remoteWorkers = 4
+
+// scanRemote finds the agent sessions on a --remote host over SSH and fills
+// in the versions installed there. With enrich it also adds the host's tmux
+// info, and with checkWork too each session's active-work state; a host
+// without tmux still reports its sessions, by PID, along with a warning.
+func scanRemote(ctx context.Context, host string, enrich, checkWork bool) ([]*process.Session, []string, error) {
+	r := runner.For(host)
+	sessions, err := process.FindAgentSessionsContext(ctx, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only ask about agents that are actually running there; every
+	// command is a round trip
+	installed := make(map[string]string)
+	for _, s := range sessions {
+		if _, ok := installed[s.Agent]; !ok {
+			installed[s.Agent], _ = version.GetInstalledOnContext(ctx, r, s.Agent)
+		}
+		s.InstalledVersion = installed[s.Agent]
+	}
+
+	if !enrich {
+		return sessions, nil, nil
+	}
+	panes, err := tmux.GetPanesContext(ctx, r)
+	if errors.Is(err, exec.ErrNotFound) {
+		return sessions, []string{fmt.Sprintf("tmux not installed on %s; its sessions are shown by PID and can't be restarted", host)}, nil
+	}
+	process.EnrichWithTmux(sessions, panes)
+	var warnings []string
+	if checkWork {
+		panics := process.EnrichContext(ctx, sessions, remoteWorkers, activeWork(r))
+		sessions = process.DropPanicked(sessions, panics)
+		for _, p := range panics {
+			warnings = append(warnings, fmt.Sprintf("Skipped %v", p))
+		}
+	}
+	return sessions, warnings, nil
+}
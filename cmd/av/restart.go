@@ -0,0 +1,583 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buddyh/av/internal/config"
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/tmux"
+	"github.com/buddyh/av/internal/tui"
+	"github.com/buddyh/av/internal/version"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+func newRestartCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var all bool
+	var yes bool
+	var detachedOnly bool
+	var failOnBusy bool
+	var pickVersionFlag bool
+	var compareTo string
+
+	cmd := &cobra.Command{
+		Use:   "restart [session|agent]...",
+		Short: "Restart outdated sessions (interactive picker)",
+		Long: `Restart outdated sessions, picked interactively unless --yes is given.
+
+Naming sessions (by tmux session, or an agent to mean all its sessions)
+restarts just those, current or not, without the picker. Unambiguous
+prefixes and substrings are accepted, e.g. "av restart api" for a session
+named "api-server".
+
+A session is outdated when it runs a version other than the installed one.
+With --compare-to latest it's outdated when it runs one other than the
+latest release instead, even if that isn't installed yet: it is still
+relaunched with the installed version. Latest versions are fetched for
+this, or with --no-fetch read from the cache however old. Remote sessions
+are always compared with their host's installed version.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if compareTo != compareInstalled && compareTo != compareLatest {
+				return fmt.Errorf("unknown --compare-to %q (want %s or %s)", compareTo, compareInstalled, compareLatest)
+			}
+			// Comparing against installed versions works fully offline,
+			// whether or not --no-fetch is given
+			version.SetOffline(compareTo == compareInstalled)
+			if err := validateRestartFlags(flags); err != nil {
+				return err
+			}
+			installed, sessions, err := scanForRestart(cmd.Context(), flags, out)
+			if err != nil {
+				return err
+			}
+			baseline := installed
+			if compareTo == compareLatest {
+				if baseline, err = latestBaseline(cmd.Context(), out, flags); err != nil {
+					return err
+				}
+			}
+
+			// Named sessions are restarted as asked, outdated or not
+			if len(args) > 0 {
+				sessions, err = matchSessions(sessions, args)
+				if err != nil {
+					return err
+				}
+				all, yes = true, true
+			}
+
+			if pickVersionFlag {
+				if flags.json {
+					return errors.New("--pick-version is interactive and can't be used with --json")
+				}
+				var ok bool
+				installed, ok, err = pickVersion(flags, restartCandidates(sessions, installed, true), installed)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					out.Info("Cancelled")
+					return nil
+				}
+				// The picked version is what sessions are compared against
+				baseline = installed
+			}
+
+			for _, w := range undetectedInstalls(sessions, installed) {
+				out.Warn(w)
+			}
+
+			candidates := restartCandidates(sessions, baseline, all)
+			stuck := unrestartable(sessions, baseline, all)
+			if len(stuck) > 0 {
+				msg := stuckMessage(stuck, runner.For)
+				if len(candidates) == 0 {
+					return errors.New(msg)
+				}
+				out.Warn(msg)
+			}
+			if len(candidates) == 0 {
+				out.Success("All sessions are up to date")
+				return nil
+			}
+
+			var toRestart []*process.Session
+
+			// Interactive picker unless --yes flag
+			if !yes && !flags.json {
+				// Sessions are picked against the baseline but relaunched
+				// with the installed version, which the picker shows
+				picker := tui.NewPicker(sessions, baseline).WithInstalled(installed).WithSymbols(flags.symbols).WithASCII(flags.ascii).WithAgentColors(out.AgentColors()).WithUnknownWork(flags.unknownWork == config.UnknownWorkProceed)
+				p := tea.NewProgram(picker)
+				finalModel, err := p.Run()
+				if err != nil {
+					return fmt.Errorf("picker error: %w", err)
+				}
+
+				result := finalModel.(tui.PickerModel)
+				if result.Cancelled() {
+					out.Info("Cancelled")
+					return nil
+				}
+
+				toRestart = result.SelectedSessions()
+			} else {
+				toRestart = candidates
+			}
+
+			if len(toRestart) == 0 {
+				out.Info("No sessions selected")
+				return nil
+			}
+
+			if failOnBusy {
+				if busy := busySessions(toRestart); len(busy) > 0 {
+					return fmt.Errorf("not restarting anything: %d session(s) have active work: %s", len(busy), strings.Join(busy, ", "))
+				}
+			}
+
+			restartSessions(cmd.Context(), out, flags, toRestart, installed, detachedOnly, flags.json)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Include all sessions, even if current")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip interactive picker, restart all outdated")
+	cmd.Flags().BoolVar(&detachedOnly, "detached-only", false, "Skip sessions a tmux client is attached to")
+	cmd.Flags().BoolVar(&pickVersionFlag, "pick-version", false, "Pick which locally installed version to restart onto, e.g. to roll back")
+	cmd.Flags().BoolVar(&failOnBusy, "fail-on-busy", false, "Restart nothing, and exit nonzero, if any session to restart has active work")
+	cmd.Flags().StringVar(&compareTo, "compare-to", compareInstalled, "What makes a session outdated: running other than the installed or the latest version")
+	addRestartFlags(cmd, flags)
+	return cmd
+}
+
+// Baselines for --compare-to
+const (
+	compareInstalled = "installed"
+	compareLatest    = "latest"
+)
+
+// latestBaseline returns the latest versions for restart --compare-to
+// latest: fetched, or with --no-fetch whatever the cache holds. Agents
+// whose latest version is unknown have no outdated sessions.
+func latestBaseline(ctx context.Context, out *output.Output, flags *rootFlags) (map[string]string, error) {
+	var latest map[string]string
+	if flags.noFetch {
+		c, err := version.LoadCache()
+		if err != nil {
+			return nil, fmt.Errorf("--compare-to latest with --no-fetch needs cached latest versions (run av cache refresh): %w", err)
+		}
+		latest = c.Latest
+	} else {
+		ctx, cancel := flags.withTimeout(ctx)
+		defer cancel()
+		latest = version.FetchLatestCachedContext(ctx, 0).Latest
+	}
+
+	var unknown []string
+	for _, agent := range version.Agents {
+		if latest[agent] == "" {
+			unknown = append(unknown, version.DisplayName(agent))
+		}
+	}
+	if len(unknown) == len(version.Agents) {
+		return nil, fmt.Errorf("--compare-to latest: couldn't get any latest version")
+	}
+	if len(unknown) > 0 && !flags.json {
+		out.Warn(fmt.Sprintf("Latest version unknown for %s; none of their sessions count as outdated", strings.Join(unknown, ", ")))
+	}
+	return latest, nil
+}
+
+// Restart strategies for --restart-strategy
+const (
+	// strategySendKeys types exit and the resume command into the pane
+	strategySendKeys = "sendkeys"
+	// strategyRespawn kills the pane's processes and relaunches it in place,
+	// for agents stuck enough to ignore Ctrl+C
+	strategyRespawn = "respawn"
+)
+
+// addRestartFlags adds the flags shared by restart and upgrade --restart
+func addRestartFlags(cmd *cobra.Command, flags *rootFlags) {
+	cmd.Flags().StringVar(&flags.restartStrategy, "restart-strategy", strategySendKeys, "How to restart a session: sendkeys (exit and resume in the pane) or respawn (kill and relaunch the pane)")
+	cmd.Flags().IntVar(&flags.restartConcurrency, "restart-concurrency", 1, "Restart up to this many sessions at once, in batches")
+	cmd.Flags().DurationVar(&flags.restartDelay, "restart-delay", 0, "Wait this long between batches of restarts (e.g. 5s)")
+}
+
+// validateRestartFlags checks the flags added by addRestartFlags
+func validateRestartFlags(flags *rootFlags) error {
+	if _, err := restartFunc(flags.restartStrategy); err != nil {
+		return err
+	}
+	if flags.restartConcurrency < 1 {
+		return fmt.Errorf("--restart-concurrency must be at least 1, got %d", flags.restartConcurrency)
+	}
+	if flags.restartDelay < 0 {
+		return fmt.Errorf("--restart-delay must not be negative, got %s", flags.restartDelay)
+	}
+	return nil
+}
+
+// restartFunc returns the function that restarts a session with strategy
+func restartFunc(strategy string) (func(context.Context, runner.Runner, *process.Session) (string, error), error) {
+	switch strategy {
+	case strategySendKeys:
+		return tmux.RestartSessionContext, nil
+	case strategyRespawn:
+		return tmux.RespawnSessionContext, nil
+	default:
+		return nil, fmt.Errorf("unknown --restart-strategy %q (want %s or %s)", strategy, strategySendKeys, strategyRespawn)
+	}
+}
+
+// scanForRestart returns installed versions and the detected sessions,
+// enriched with tmux info and active-work state. Unlike a status scan, one
+// that times out is an error: restarting from half a picture isn't safe.
+// A remote host that can't be scanned is warned about on out, as status
+// does, and left out.
+func scanForRestart(ctx context.Context, flags *rootFlags, out *output.Output) (map[string]string, []*process.Session, error) {
+	ctx, cancel := flags.withTimeout(ctx)
+	defer cancel()
+
+	// Restart only compares running against installed versions, so an
+	// undetectable install just leaves its sessions as candidates
+	installed := make(map[string]string)
+	for _, agent := range version.Agents {
+		installed[agent], _ = version.GetInstalledContext(ctx, agent)
+	}
+
+	sessions, err := process.FindAgentSessionsContext(ctx, runner.Local)
+	if err != nil && flags.strict {
+		return nil, nil, fmt.Errorf("strict: %w", err)
+	}
+	tmuxPanes, _ := tmux.GetPanesContext(ctx, runner.Local)
+	process.EnrichWithTmux(sessions, tmuxPanes)
+
+	// Check for active work in each session, and note which conversation
+	// each is in while its process is still around to ask. Restart always
+	// does both, whatever --skip-enrich says. A session that couldn't be
+	// checked isn't safe to restart.
+	sessions, err = enrichForRestart(ctx, flags, out, sessions, activeWork(runner.Local), conversation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, host := range flags.remotes {
+		remote, warnings, err := scanRemote(ctx, host, true, true)
+		if err != nil {
+			if flags.strict {
+				return nil, nil, fmt.Errorf("strict: remote %s: %w", host, err)
+			}
+			out.Warn(fmt.Sprintf("Couldn't scan %s: %v", host, err))
+			continue
+		}
+		for _, w := range warnings {
+			out.Warn(w)
+		}
+		sessions = append(sessions, remote...)
+	}
+
+	if timedOut(ctx) {
+		return nil, nil, fmt.Errorf("scan timed out after %s", flags.timeout)
+	}
+
+	if flags.workingDir != "" {
+		sessions = process.FilterByWorkingDir(sessions, flags.workingDir)
+	}
+	if flags.ppid != 0 {
+		tree, err := process.GetTreeContext(ctx, runner.Local)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--ppid: %w", err)
+		}
+		sessions = process.FilterByAncestor(sessions, tree, flags.ppid)
+	}
+	if flags.tty != "" {
+		filtered := process.FilterByTTY(sessions, flags.tty)
+		if len(filtered) == 0 {
+			return nil, nil, process.NoSessionOnTTY(flags.tty, sessions)
+		}
+		sessions = filtered
+	}
+	if flags.selector != nil {
+		sessions = process.FilterBySelector(sessions, flags.selector, installed)
+	}
+
+	return installed, sessions, nil
+}
+
+// enrichForRestart runs steps over sessions and drops any that panic, so
+// one bad session can't stop the rest being restarted. With --strict a
+// panic is an error; otherwise each skipped session is warned about on out.
+func enrichForRestart(ctx context.Context, flags *rootFlags, out *output.Output, sessions []*process.Session, steps ...process.Enricher) ([]*process.Session, error) {
+	panics := process.EnrichContext(ctx, sessions, process.EnrichWorkers, steps...)
+	if len(panics) > 0 && flags.strict {
+		return nil, fmt.Errorf("strict: %w", panics[0])
+	}
+	for _, p := range panics {
+		out.Warn(fmt.Sprintf("Skipped %v", p))
+	}
+	return process.DropPanicked(sessions, panics), nil
+}
+
+// restartCandidates filters to restartable sessions: tmux sessions running a
+// version other than the installed one, or every tmux session with all
+func restartCandidates(sessions []*process.Session, installed map[string]string, all bool) []*process.Session {
+	var candidates []*process.Session
+	for _, s := range sessions {
+		if s.TmuxSession == "" {
+			continue // Can't restart non-tmux
+		}
+		if wantsRestart(s, installed, all) {
+			candidates = append(candidates, s)
+		}
+	}
+	return candidates
+}
+
+// unrestartable returns the sessions restartCandidates would pick if they
+// were running in tmux
+func unrestartable(sessions []*process.Session, installed map[string]string, all bool) []*process.Session {
+	var stuck []*process.Session
+	for _, s := range sessions {
+		if s.TmuxSession == "" && wantsRestart(s, installed, all) {
+			stuck = append(stuck, s)
+		}
+	}
+	return stuck
+}
+
+// stuckMessage explains why the stuck sessions can't be restarted: they
+// aren't running in tmux, perhaps because their host doesn't have it.
+// runnerFor gives the runner for each session's host.
+func stuckMessage(stuck []*process.Session, runnerFor func(host string) runner.Runner) string {
+	installed := make(map[string]bool)
+	var missing []string
+	without := 0
+	for _, s := range stuck {
+		has, checked := installed[s.Host]
+		if !checked {
+			has = tmux.IsInstalled(runnerFor(s.Host))
+			installed[s.Host] = has
+			if !has {
+				missing = append(missing, s.Host)
+			}
+		}
+		if !has {
+			without++
+		}
+	}
+
+	// Remote hosts are named; this machine only when some are remote
+	var where string
+	if len(missing) > 1 || (len(missing) == 1 && missing[0] != "") {
+		names := make([]string, len(missing))
+		for i, host := range missing {
+			names[i] = cmp.Or(host, "this machine")
+		}
+		where = " on " + strings.Join(names, ", ")
+	}
+	switch {
+	case without == 0:
+		return fmt.Sprintf("%d session(s) aren't running in tmux and can't be restarted", len(stuck))
+	case without == len(stuck):
+		return fmt.Sprintf("tmux isn't installed%s, so %d session(s) can't be restarted", where, len(stuck))
+	default:
+		return fmt.Sprintf("%d session(s) aren't running in tmux and can't be restarted (tmux isn't installed%s for %d of them)", len(stuck), where, without)
+	}
+}
+
+// busySessions returns the labels of sessions with active work
+func busySessions(sessions []*process.Session) []string {
+	var busy []string
+	for _, s := range sessions {
+		if s.HasActiveWork {
+			busy = append(busy, s.Label())
+		}
+	}
+	return busy
+}
+
+// unknownWork counts the sessions whose pane couldn't be captured to check
+// for active work
+func unknownWork(sessions []*process.Session) int {
+	n := 0
+	for _, s := range sessions {
+		if s.ActiveWorkUnknown {
+			n++
+		}
+	}
+	return n
+}
+
+// wantsRestart reports whether a session runs a version other than the
+// installed one, both known (any session, with all)
+func wantsRestart(s *process.Session, installed map[string]string, all bool) bool {
+	return all || s.Outdated(installed)
+}
+
+// restartResult records the outcome of restarting one session
+type restartResult struct {
+	Session     string `json:"session"`
+	Host        string `json:"host,omitempty"`
+	Agent       string `json:"agent"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Command     string `json:"command,omitempty"` // what was run in the pane
+	Batch       int    `json:"batch"`
+	Restarted   bool   `json:"restarted"`
+	Skipped     string `json:"skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Steps are the steps of the restart taken, in order; a failed restart
+	// failed in the last one
+	Steps []string `json:"steps,omitempty"`
+}
+
+// restartSessions restarts the sessions in batches of --restart-concurrency
+// at a time, waiting --restart-delay between batches, and skips any that
+// have active work (or, with detachedOnly, an attached client) at the
+// moment we get to them. Every attempt is recorded in the restart log and,
+// with stream, printed as a JSON line as well. With --json, progress
+// messages are left out so only JSON goes to stdout.
+func restartSessions(ctx context.Context, out *output.Output, flags *rootFlags, sessions []*process.Session, installed map[string]string, detachedOnly, stream bool) []restartResult {
+	restart, err := restartFunc(flags.restartStrategy)
+	if err != nil {
+		out.Warn(err.Error())
+		return nil
+	}
+	size := max(flags.restartConcurrency, 1)
+	batches := (len(sessions) + size - 1) / size
+	paced := size > 1 || flags.restartDelay > 0
+	info := func(msg string) {
+		if !flags.json {
+			out.Info(msg)
+		}
+	}
+	if paced && batches > 1 {
+		info(fmt.Sprintf("Restarting %d session(s) in %d batches of up to %d...", len(sessions), batches, size))
+	} else {
+		info(fmt.Sprintf("Restarting %d session(s)...", len(sessions)))
+	}
+
+	var results []restartResult
+	var restarted []*process.Session
+	logFailed := false
+	for batch := 0; batch < batches; batch++ {
+		if batch > 0 && flags.restartDelay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(flags.restartDelay):
+			}
+		}
+		if ctx.Err() != nil {
+			out.Warn(fmt.Sprintf("Stopped with %d session(s) not restarted: %v", len(sessions)-batch*size, ctx.Err()))
+			break
+		}
+
+		start := time.Now()
+		group := sessions[batch*size : min((batch+1)*size, len(sessions))]
+		batchResults := make([]restartResult, len(group))
+		var wg sync.WaitGroup
+		for i, s := range group {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				batchResults[i] = restartOne(ctx, restart, s, installed, detachedOnly, flags.unknownWork == config.UnknownWorkProceed)
+			}()
+		}
+		wg.Wait()
+
+		// Report in order once the batch is done, so output from sessions
+		// restarted together doesn't interleave
+		ok := 0
+		for i, r := range batchResults {
+			s := group[i]
+			r.Batch = batch + 1
+			switch {
+			case r.Skipped == "active work":
+				out.Warn(fmt.Sprintf("Skipped %s (has active work)", s.Label()))
+			case r.Skipped == "active work unknown":
+				out.Warn(fmt.Sprintf("Skipped %s (couldn't capture its pane to check for active work; --unknown-work=proceed restarts it anyway)", s.Label()))
+			case r.Skipped != "":
+				out.Warn(fmt.Sprintf("Skipped %s (%s)", s.Label(), r.Skipped))
+			case r.Error != "":
+				out.Warn(fmt.Sprintf("Failed to restart %s: %s", s.Label(), r.Error))
+			default:
+				ok++
+				restarted = append(restarted, s)
+				if !flags.json {
+					out.Success(fmt.Sprintf("Restarted %s", s.Label()))
+				}
+			}
+
+			entry := restartLogEntry{Time: time.Now(), Strategy: flags.restartStrategy, restartResult: r}
+			if err := appendRestartLog(entry); err != nil && !logFailed {
+				out.Warn(fmt.Sprintf("Couldn't write restart log: %v", err))
+				logFailed = true
+			}
+			if stream {
+				if line, err := json.Marshal(entry); err == nil {
+					out.Printf("%s\n", line)
+				}
+			}
+			results = append(results, r)
+		}
+		if paced {
+			info(fmt.Sprintf("Batch %d/%d: restarted %d of %d in %s", batch+1, batches, ok, len(group), time.Since(start).Round(100*time.Millisecond)))
+		}
+	}
+
+	if err := recordRestarts(restarted); err != nil {
+		out.Warn(fmt.Sprintf("Couldn't update session history: %v", err))
+	}
+	return results
+}
+
+// restartOne restarts one session unless, right before restarting, it has
+// active work or (with detachedOnly) someone watching. A session whose
+// pane can't be captured to tell is skipped too, unless proceedUnknown.
+func restartOne(ctx context.Context, restart func(context.Context, runner.Runner, *process.Session) (string, error), s *process.Session, installed map[string]string, detachedOnly, proceedUnknown bool) restartResult {
+	r := restartResult{
+		Session:     s.TmuxSession,
+		Host:        s.Host,
+		Agent:       s.Agent,
+		FromVersion: s.RunningVersion,
+		ToVersion:   s.CurrentVersion(installed),
+	}
+
+	ctx = tmux.WithSteps(ctx, func(step string) { r.Steps = append(r.Steps, step) })
+	run := runner.For(s.Host)
+	r.Steps = append(r.Steps, "check active work")
+	busy, err := tmux.ActiveWorkContext(ctx, run, s.TmuxSession)
+	if busy {
+		r.Skipped = "active work"
+		return r
+	}
+	if err != nil && !proceedUnknown {
+		r.Skipped = "active work unknown"
+		return r
+	}
+	if detachedOnly {
+		r.Steps = append(r.Steps, "check attached")
+		if tmux.IsAttachedContext(ctx, run, s.TmuxSession) {
+			r.Skipped = "attached"
+			return r
+		}
+	}
+
+	if r.Command, err = restart(ctx, run, s); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Restarted = true
+	return r
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/runner/runnertest"
+	"github.com/buddyh/av/internal/version"
+)
+
+func TestEnrichForRestartSkipsPanics(t *testing.T) {
+	explode := func(_ context.Context, s *process.Session) {
+		if s.TmuxSession == "broken" {
+			panic("unexpected capture")
+		}
+		s.HasActiveWork = true
+	}
+	newSessions := func() []*process.Session {
+		return []*process.Session{
+			{PID: 1, TmuxSession: "api"},
+			{PID: 2, TmuxSession: "broken"},
+			{PID: 3, TmuxSession: "web"},
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	out := output.New(&stdout, &stderr)
+	out.Configure(false, true, true, false, true)
+	sessions, err := enrichForRestart(context.Background(), &rootFlags{}, out, newSessions(), explode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].TmuxSession != "api" || sessions[1].TmuxSession != "web" {
+		t.Errorf("sessions = %v, want api and web", sessions)
+	}
+	for _, s := range sessions {
+		if !s.HasActiveWork {
+			t.Errorf("%s wasn't enriched", s.TmuxSession)
+		}
+	}
+	if want := "[warn] Skipped broken: internal error: unexpected capture\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+
+	_, err = enrichForRestart(context.Background(), &rootFlags{strict: true}, out, newSessions(), explode)
+	if err == nil || !strings.Contains(err.Error(), "broken: internal error") {
+		t.Errorf("strict err = %v, want the panic", err)
+	}
+}
+
+// countingTransport fails every request, counting them
+type countingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req.URL.String())
+	return nil, errors.New("no network in tests")
+}
+
+func TestRestartMakesNoRequests(t *testing.T) {
+	tempHome(t)
+	rt := &countingTransport{}
+	version.SetTransport(rt)
+	t.Cleanup(func() {
+		version.SetTransport(nil)
+		version.SetOffline(false)
+	})
+
+	// No session is in an empty dir, so nothing gets restarted
+	empty := t.TempDir()
+	if err := execute([]string{"restart", "--yes", "--all", "--json", "--working-dir", empty}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.requests) > 0 {
+		t.Errorf("restart made %d HTTP request(s): %q", len(rt.requests), rt.requests)
+	}
+}
+
+func TestStuckMessageChecksEachHost(t *testing.T) {
+	notFound := errors.New("tmux: not found")
+	runners := map[string]*runnertest.Fake{
+		"":        (&runnertest.Fake{}).On("tmux -V", "tmux 3.4\n", nil),
+		"dev@box": (&runnertest.Fake{HostName: "dev@box"}).On("tmux -V", "", notFound),
+		"ci@box":  (&runnertest.Fake{HostName: "ci@box"}).On("tmux -V", "", notFound),
+	}
+	runnerFor := func(host string) runner.Runner { return runners[host] }
+
+	tests := []struct {
+		name  string
+		hosts []string
+		want  string
+	}{
+		{"tmux everywhere", []string{"", ""}, "2 session(s) aren't running in tmux and can't be restarted"},
+		{"no tmux on the remote", []string{"dev@box", "dev@box"}, "tmux isn't installed on dev@box, so 2 session(s) can't be restarted"},
+		{"some without tmux", []string{"", "dev@box", "ci@box"}, "3 session(s) aren't running in tmux and can't be restarted (tmux isn't installed on dev@box, ci@box for 2 of them)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stuck []*process.Session
+			for i, host := range tt.hosts {
+				stuck = append(stuck, &process.Session{PID: i + 1, Host: host})
+			}
+			if got := stuckMessage(stuck, runnerFor); got != tt.want {
+				t.Errorf("stuckMessage = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+	if n := runners["dev@box"].Count("tmux -V"); n != 2 {
+		t.Errorf("checked dev@box %d times, want once per call", n)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// maxRestartLogSize is the size at which the restart log is rotated; one
+// previous generation is kept as restart.log.1
+const maxRestartLogSize = 1 << 20
+
+// restartLogEntry is one line of the restart log
+type restartLogEntry struct {
+	Time     time.Time `json:"time"`
+	Strategy string    `json:"strategy"`
+	restartResult
+}
+
+// stateDir returns $XDG_STATE_HOME/av, falling back to ~/.local/state/av
+func stateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "av")
+}
+
+// restartLogPath returns the restart log in stateDir
+func restartLogPath() string {
+	return filepath.Join(stateDir(), "restart.log")
+}
+
+// appendRestartLog records one restart attempt as a JSON line. The size
+// check, rotation and append happen under a lock on the log, so concurrent
+// restarts neither rotate it twice nor write to a generation being rotated.
+func appendRestartLog(e restartLogEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	path := restartLogPath()
+	return withLock(path, func() error {
+		if info, err := os.Stat(path); err == nil && info.Size() >= maxRestartLogSize {
+			if err := os.Rename(path, path+".1"); err != nil {
+				return err
+			}
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// readRestartLog returns the last n entries of the restart log, oldest
+// first. Lines that don't parse are skipped.
+func readRestartLog(n int) ([]restartLogEntry, error) {
+	var entries []restartLogEntry
+	for _, path := range []string{restartLogPath() + ".1", restartLogPath()} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e restartLogEntry
+			if json.Unmarshal(scanner.Bytes(), &e) == nil {
+				entries = append(entries, e)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+func printRestartLogEntry(out *output.Output, e restartLogEntry) {
+	session := e.Session
+	if e.Host != "" {
+		session = e.Host + ":" + session
+	}
+	from, to := e.FromVersion, e.ToVersion
+	if from == "" {
+		from = "?"
+	}
+	if to == "" {
+		to = "?"
+	}
+	result := "restarted"
+	switch {
+	case e.Skipped != "":
+		result = "skipped (" + e.Skipped + ")"
+	case e.Error != "":
+		result = "failed: " + e.Error
+	}
+	out.Printf("%s  %-20s %-7s %s -> %s  %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), session, e.Agent, from, to, result)
+	if e.Command != "" {
+		out.Printf("%20s$ %s\n", "", e.Command)
+	}
+	if e.Error != "" && len(e.Steps) > 0 {
+		out.Printf("%20ssteps: %s\n", "", strings.Join(e.Steps, " > "))
+	}
+}
+
+func newLogCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var lines int
+	var follow bool
+
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show the log of restarts av has done",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := readRestartLog(lines)
+			if err != nil {
+				return fmt.Errorf("restart log: %w", err)
+			}
+
+			// Without --follow, JSON is one array; with it, a stream of
+			// objects like av watch --json
+			if flags.json && !follow {
+				if entries == nil {
+					entries = []restartLogEntry{}
+				}
+				return out.JSON(entries)
+			}
+			if len(entries) == 0 && !follow {
+				out.Info(fmt.Sprintf("No restarts logged yet (%s)", restartLogPath()))
+				return nil
+			}
+
+			var last time.Time
+			show := func(e restartLogEntry) error {
+				last = e.Time
+				if flags.json {
+					return out.JSON(e)
+				}
+				printRestartLogEntry(out, e)
+				return nil
+			}
+			for _, e := range entries {
+				if err := show(e); err != nil {
+					return err
+				}
+			}
+			if !follow {
+				return nil
+			}
+
+			// Poll for entries newer than the last one shown. Matching on
+			// time rather than position survives rotation.
+			for {
+				time.Sleep(time.Second)
+				entries, err := readRestartLog(0)
+				if err != nil {
+					return fmt.Errorf("restart log: %w", err)
+				}
+				for _, e := range entries {
+					if !e.Time.After(last) {
+						continue
+					}
+					if err := show(e); err != nil {
+						return err
+					}
+				}
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&lines, "lines", "n", 20, "Number of entries to show (0 = all)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new entries as they're logged")
+	return cmd
+}
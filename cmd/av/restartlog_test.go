@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendRestartLogRotatesOnce(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := restartLogPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A full log, due to be rotated by the next append
+	var full bytes.Buffer
+	old := 0
+	for full.Len() < maxRestartLogSize {
+		line, err := json.Marshal(restartLogEntry{Time: time.Now(), restartResult: restartResult{Session: "old", Agent: "claude"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		full.Write(append(line, '\n'))
+		old++
+	}
+	if err := os.WriteFile(path, full.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const runs = 20
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e := restartLogEntry{Time: time.Now(), restartResult: restartResult{Session: fmt.Sprintf("new-%d", i), Agent: "claude"}}
+			if err := appendRestartLog(e); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := readRestartLog(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotating more than once would have dropped the full generation
+	if want := old + runs; len(entries) != want {
+		t.Errorf("got %d entries after %d concurrent appends to a full log, want %d", len(entries), runs, want)
+	}
+}
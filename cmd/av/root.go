@@ -1,234 +1,985 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/buddyh/av/internal/config"
 	"github.com/buddyh/av/internal/output"
 	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
 	"github.com/buddyh/av/internal/tmux"
-	"github.com/buddyh/av/internal/tui"
 	"github.com/buddyh/av/internal/version"
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 )
 
 var Version = "dev"
 
 type rootFlags struct {
-	json    bool
-	plain   bool
-	noColor bool
-	noFetch bool
+	json     bool
+	compact  bool
+	plain    bool
+	noColor  bool
+	symbols  bool
+	ascii    bool
+	noFetch  bool
+	noEnrich bool
+	lsof     bool
+	strict   bool
+	profile  bool
+	// summary shows only the counts and verdict, not the sessions table
+	summary bool
+	// groupSummary adds a line totting up sessions: outdated, busy and per
+	// agent
+	groupSummary bool
+	// history shows how long each session has been outdated and how often
+	// it's been restarted
+	history bool
+	// showModel adds the model each session uses to the sessions table
+	showModel bool
+	// showInstallMethod notes how each agent was installed
+	showInstallMethod bool
+	// onlyRestartable shows just the sessions av restart would act on
+	onlyRestartable bool
+
+	// limit caps the number of sessions shown; 0 shows all
+	limit int
+	// timeout bounds each scan and check; 0 disables it
+	timeout time.Duration
+
+	workingDir string
+	// skipEnrich names enrichment steps a status scan leaves out
+	skipEnrich []string
+	// ppid keeps only sessions descended from this process; 0 keeps all
+	ppid int
+	// tty keeps only the sessions on this terminal
+	tty string
+	// jsonIndent is --json-indent; --compact overrides it with 0
+	jsonIndent int
+	// flatten prints --json as flat key=value lines
+	flatten bool
+	// installedOnly skips everything about sessions, leaving just versions
+	installedOnly bool
+	// verbose explains what status couldn't find out
+	verbose bool
+	// quiet leaves out the note on when latest versions were fetched
+	quiet bool
+	// fetchTTL lets status use latest versions cached within this long
+	fetchTTL time.Duration
+	// selectExpr is --select as given; selector is it parsed, or nil
+	selectExpr string
+	selector   *process.Selector
+	outputFile string
+	// remotes are user@host targets whose sessions are scanned over SSH
+	remotes []string
+	// restartStrategy is how restart and upgrade --restart restart a session
+	restartStrategy string
+	// restartConcurrency is how many sessions are restarted at once, and
+	// restartDelay the pause between each batch of them
+	restartConcurrency int
+	restartDelay       time.Duration
+	// codexChannel is the npm dist-tag Codex updates are checked against
+	codexChannel string
+	// unknownWork is whether restarts skip or proceed with sessions whose
+	// pane can't be captured to check for active work
+	unknownWork string
+	// claudePrerelease counts Claude Code pre-releases as its latest version
+	claudePrerelease bool
+
+	// bins holds --<agent>-bin binary path overrides, by agent
+	bins map[string]*string
+	// upgradeCommands holds configured upgrade commands, by agent
+	upgradeCommands map[string]string
+	// versionPatterns holds configured running-version regexes, by agent
+	versionPatterns map[string][]string
+	// helperPatterns holds configured helper command-line regexes, by agent
+	helperPatterns map[string][]string
+	// agentColors holds configured agent name colors, by agent
+	agentColors map[string]string
+	// minVersionFlag is --min-version as given; minVersions is it merged
+	// over the config, by agent
+	minVersionFlag map[string]string
+	minVersions    map[string]string
+	// resumeCommandFlag is --resume-command as given; resumeCommands is it
+	// merged over the config, by agent
+	resumeCommandFlag map[string]string
+	resumeCommands    map[string]string
+
+	configPath string
+	// reloadConfig re-reads the config file; long-running modes call it on SIGHUP
+	reloadConfig func() error
 }
 
 func execute(args []string) error {
-	flags := &rootFlags{}
+	flags := &rootFlags{bins: make(map[string]*string)}
 	out := output.New(os.Stdout, os.Stderr)
+	var outFile *outputFile
 
 	rootCmd := &cobra.Command{
 		Use:           "av",
 		Short:         "Agent Versions - Monitor and manage AI coding agents",
-		Long:          `Monitor installed and running versions of Claude Code and OpenAI Codex.`,
+		Long:          `Monitor installed and running versions of Claude Code, OpenAI Codex and Gemini CLI.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		Version:       Version,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			out.Configure(flags.json, flags.plain, flags.noColor)
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyEnv(cmd); err != nil {
+				return err
+			}
+			flags.reloadConfig = func() error {
+				if err := applyConfig(cmd, flags); err != nil {
+					return err
+				}
+				out.Configure(flags.json, flags.plain, flags.noColor, flags.symbols, flags.ascii)
+				out.SetAgentColors(flags.agentColors)
+				return nil
+			}
+			if cmd.Annotations[skipConfigAnnotation] != "" {
+				out.Configure(flags.json, flags.plain, flags.noColor, flags.symbols, flags.ascii)
+			} else if err := flags.reloadConfig(); err != nil {
+				return err
+			}
+			if flags.compact && !flags.json {
+				return fmt.Errorf("--compact requires --json")
+			}
+			if flags.jsonIndent < 0 {
+				return fmt.Errorf("--json-indent must not be negative")
+			}
+			if flags.compact {
+				flags.jsonIndent = 0
+			}
+			out.SetJSONIndent(flags.jsonIndent)
+			if flags.flatten && !flags.json {
+				return fmt.Errorf("--flatten requires --json")
+			}
+			out.SetFlatten(flags.flatten)
+			if flags.timeout < 0 {
+				return fmt.Errorf("--timeout must not be negative")
+			}
+			if flags.limit < 0 {
+				return fmt.Errorf("--limit must not be negative")
+			}
+			if flags.ppid < 0 {
+				return fmt.Errorf("--ppid must not be negative")
+			}
+			if flags.selectExpr != "" {
+				sel, err := process.ParseSelector(flags.selectExpr)
+				if err != nil {
+					return fmt.Errorf("--select: %w", err)
+				}
+				flags.selector = sel
+			}
+			if err := validateSkipEnrich(flags.skipEnrich); err != nil {
+				return err
+			}
+			// Working dirs come from tmux, or from the cwd step outside it
+			if flags.workingDir != "" && !flags.enriches(enrichTmux) && !flags.enriches(enrichCwd) {
+				if flags.noEnrich {
+					return fmt.Errorf("--working-dir can't be combined with --no-enrich")
+				}
+				return fmt.Errorf("--working-dir can't be combined with --skip-enrich tmux,cwd, which leaves no working dirs to filter on")
+			}
+			if flags.outputFile != "" {
+				// A JSON document is written atomically so readers never
+				// see it half-written
+				f, err := openOutputFile(flags.outputFile, flags.json)
+				if err != nil {
+					return err
+				}
+				outFile = f
+				out.SetStdout(f)
+			}
+			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runStatus(out, flags)
+			if flags.installedOnly {
+				// Ones from the environment are meant for other runs too
+				for _, name := range sessionFlags {
+					if f := cmd.Flags().Lookup(name); f.Changed && f.Annotations[envAnnotation] == nil {
+						return fmt.Errorf("--installed-only can't be combined with --%s", name)
+					}
+				}
+			}
+			return runStatus(cmd.Context(), out, flags)
 		},
 	}
 
+	rootCmd.PersistentFlags().StringVar(&flags.configPath, "config", "", "Config file (default $XDG_CONFIG_HOME/av/config.json)")
 	rootCmd.PersistentFlags().BoolVar(&flags.json, "json", false, "Output as JSON")
+	rootCmd.PersistentFlags().BoolVar(&flags.compact, "compact", false, "With --json, print JSON on a single line")
+	rootCmd.PersistentFlags().BoolVar(&flags.flatten, "flatten", false, "With --json, print flat key=value lines with dotted keys, e.g. installed.claude=2.1.14")
+	rootCmd.PersistentFlags().IntVar(&flags.jsonIndent, "json-indent", 2, "Spaces to indent JSON by (0 = one line, like --compact)")
+	rootCmd.PersistentFlags().StringVar(&flags.outputFile, "output-file", "", "Write output to this file instead of stdout")
 	rootCmd.PersistentFlags().BoolVar(&flags.plain, "plain", false, "Plain output (no colors/symbols)")
 	rootCmd.PersistentFlags().BoolVar(&flags.noColor, "no-color", false, "Disable colors")
+	rootCmd.PersistentFlags().BoolVar(&flags.symbols, "symbols", false, "Prefix statuses with symbols (✓ current, ↑ update, ? unknown, ! restart, ✗ below minimum)")
+	rootCmd.PersistentFlags().BoolVar(&flags.ascii, "ascii", false, "Only print ASCII characters (for terminals without Unicode support)")
 	rootCmd.PersistentFlags().BoolVar(&flags.noFetch, "no-fetch", false, "Skip fetching latest versions")
+	rootCmd.PersistentFlags().BoolVar(&flags.strict, "strict", false, "Exit nonzero if any version or process detection fails")
+	rootCmd.PersistentFlags().StringToStringVar(&flags.resumeCommandFlag, "resume-command", nil, "Command restart relaunches an agent with, e.g. claude='claude --continue --model opus' ({session_id}, {tmux_session}, {working_dir} are filled in)")
+	rootCmd.PersistentFlags().StringToStringVar(&flags.minVersionFlag, "min-version", nil, "Minimum acceptable version per agent, e.g. claude=2.0.0 (exit 2 if below)")
+	rootCmd.PersistentFlags().StringVar(&flags.codexChannel, "codex-channel", version.DefaultChannel, "npm dist-tag to check Codex updates against (latest, next, beta, ...)")
+	rootCmd.PersistentFlags().StringVar(&flags.unknownWork, "unknown-work", config.UnknownWorkSkip, "Restart sessions whose pane can't be checked for active work: skip or proceed")
+	rootCmd.PersistentFlags().BoolVar(&flags.claudePrerelease, "claude-prerelease", false, "Check Claude Code updates against the newest release including pre-releases")
+	rootCmd.PersistentFlags().StringVar(&flags.workingDir, "working-dir", "", "Only sessions in this directory or below")
+	rootCmd.PersistentFlags().IntVar(&flags.ppid, "ppid", 0, "Only local sessions started from this process, e.g. $$ for the current shell (0 = all)")
+	rootCmd.PersistentFlags().StringVar(&flags.tty, "tty", "", "Only the session on this terminal, e.g. pts/3 or /dev/ttys003")
+	rootCmd.PersistentFlags().StringVar(&flags.selectExpr, "select", "", "Only sessions matching this expression, e.g. 'agent==claude && outdated && !busy' (see README)")
+	rootCmd.PersistentFlags().DurationVar(&flags.timeout, "timeout", defaultTimeout, "Give up on a scan after this long and show what was gathered (0 = no limit)")
+	rootCmd.PersistentFlags().StringArrayVar(&flags.remotes, "remote", nil, "Also scan sessions on this user@host over SSH (repeatable)")
+	for _, agent := range version.Agents {
+		flags.bins[agent] = new(string)
+		rootCmd.PersistentFlags().StringVar(flags.bins[agent], agent+"-bin", "", fmt.Sprintf("Path to the %s binary (default: found via PATH)", agent))
+	}
+	addStatusFlags(rootCmd, flags)
+	rootCmd.Flags().DurationVar(&flags.fetchTTL, "fetch-ttl", 0, "Use latest versions cached within this long instead of fetching (0 = always fetch)")
+	rootCmd.Flags().BoolVar(&flags.installedOnly, "installed-only", false, "Show only installed and latest versions, without scanning processes or tmux")
 
 	rootCmd.AddCommand(newRestartCmd(flags, out))
 	rootCmd.AddCommand(newCheckCmd(flags, out))
+	rootCmd.AddCommand(newWatchCmd(flags, out))
+	rootCmd.AddCommand(newServeCmd(flags, out))
+	rootCmd.AddCommand(newDaemonCmd(flags, out))
+	rootCmd.AddCommand(newDoctorCmd(flags, out))
+	rootCmd.AddCommand(newVersionsCmd(flags, out))
+	rootCmd.AddCommand(newUpgradeCmd(flags, out))
+	rootCmd.AddCommand(newEnsureCmd(flags, out))
+	rootCmd.AddCommand(newConfigCmd(flags, out))
+	rootCmd.AddCommand(newLogCmd(flags, out))
+	rootCmd.AddCommand(newDiffCmd(flags, out))
+	rootCmd.AddCommand(newSnapshotCmd(flags, out))
+	rootCmd.AddCommand(newBadgeCmd(flags, out))
+	rootCmd.AddCommand(newCaptureCmd(flags, out))
+	rootCmd.AddCommand(newCacheCmd(flags, out))
+	rootCmd.AddCommand(newLabelCmd(flags, out))
 
 	rootCmd.SetArgs(args)
-	if err := rootCmd.Execute(); err != nil {
-		out.Error(err)
+	err := rootCmd.Execute()
+	if outFile != nil {
+		if cerr := outFile.finish(err == nil || statusOnly(err)); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		if !statusOnly(err) {
+			out.Error(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// defaultTimeout is how long a scan may take before av gives up on whatever
+// ps, tmux, ssh or the network is still doing
+const defaultTimeout = 30 * time.Second
+
+// withTimeout bounds ctx by --timeout
+func (f *rootFlags) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, f.timeout)
+}
+
+// timedOut reports whether ctx ended because --timeout ran out
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// statusReport holds everything the status view displays
+type statusReport struct {
+	installed  map[string]string
+	installErr map[string]error
+	latest     map[string]string
+	// installMethod says how each installed agent was installed
+	installMethod map[string]string
+	// minVersions are the configured minimum versions, by agent
+	minVersions map[string]string
+	sessions    []*process.Session
+	enriched    bool
+	// omitted holds the sessions dropped by --limit or --only-restartable
+	omitted []*process.Session
+	// unseen counts the sessions a saved status was saved without, which
+	// count as omitted but can't be shown
+	unseen int
+	// skipped counts the sessions dropped because working on them panicked
+	skipped int
+	// ttyErr is set when no session is on the --tty terminal
+	ttyErr error
+
+	// When latest versions were fetched, and whether they came from the cache
+	latestFetchedAt time.Time
+	latestCached    bool
+	// takenAt is when a snapshot was saved; zero for a live status
+	takenAt time.Time
+
+	// changed holds the sessions that changed since watch --diff last
+	// refreshed, and gone counts those no longer there; nil without --diff
+	changed map[*process.Session]bool
+	gone    int
+
+	// failures are detection problems that are tolerated unless --strict
+	failures []error
+	// fetchErrors are why latest versions couldn't be fetched, by agent
+	fetchErrors map[string]error
+	// warnings are shown alongside the status (e.g. shadowed installs)
+	warnings []string
+
+	// timings records how long each phase of gathering took, for --profile
+	timings []output.Timing
+}
+
+// endPhase records the time since start as the duration of phase
+func (r *statusReport) endPhase(phase string, start time.Time) {
+	r.timings = append(r.timings, output.Timing{Phase: phase, Duration: time.Since(start)})
+}
+
+// addStatusFlags registers the flags that shape a status scan and how it's
+// shown, shared by the root command and watch
+func addStatusFlags(cmd *cobra.Command, flags *rootFlags) {
+	cmd.Flags().BoolVar(&flags.noEnrich, "no-enrich", false, "Skip tmux enrichment (sessions shown by PID only)")
+	cmd.Flags().StringSliceVar(&flags.skipEnrich, "skip-enrich", nil, "Leave out these enrichment steps: tmux, cwd, active-work, model")
+	cmd.Flags().BoolVar(&flags.lsof, "lsof", false, "Use lsof to find working dirs of non-tmux sessions (slow)")
+	cmd.Flags().BoolVar(&flags.profile, "profile", false, "Print time spent in each phase to stderr")
+	cmd.Flags().IntVar(&flags.limit, "limit", 0, "Show at most this many sessions (0 = all)")
+	cmd.Flags().BoolVar(&flags.summary, "summary", false, "Print only session counts and how many need restart (with --json, just the summary object)")
+	cmd.Flags().BoolVar(&flags.groupSummary, "group-summary", false, "End with a totals line: sessions, outdated, busy and how many per agent")
+	cmd.Flags().BoolVar(&flags.onlyRestartable, "only-restartable", false, "Show only the sessions av restart would act on: in tmux, running a known version other than the installed one")
+	cmd.Flags().BoolVar(&flags.history, "history", false, "Show how long each session has been outdated and how often av restarted it")
+	cmd.Flags().BoolVar(&flags.showModel, "show-model", false, "Add a column with the model each session uses, where it can be told")
+	cmd.Flags().BoolVar(&flags.showInstallMethod, "show-install-method", false, "Note how each agent was installed: local, homebrew, npm, nix or path")
+	cmd.Flags().BoolVar(&flags.verbose, "verbose", false, "Explain sessions whose running version couldn't be read")
+	cmd.Flags().BoolVar(&flags.quiet, "quiet", false, "Leave out the note on when latest versions were last fetched")
+}
+
+// sessionFlags are the status flags that pick or show sessions, which
+// --installed-only has none of
+var sessionFlags = []string{"working-dir", "ppid", "tty", "select", "remote", "summary", "group-summary", "limit", "only-restartable", "history", "show-model"}
+
+func runStatus(ctx context.Context, out *output.Output, flags *rootFlags) error {
+	r := gatherStatus(ctx, flags, flags.fetchTTL)
+	if r.ttyErr != nil {
+		return r.ttyErr
+	}
+	r.narrow(flags)
+	if err := printStatus(out, flags, r); err != nil {
 		return err
 	}
+	if flags.profile {
+		out.PrintProfile(r.timings)
+	}
+	// Below-minimum is the harder failure, so it wins over --strict
+	if err := minimumError(r.installed, r.installErr, slices.Concat(r.sessions, r.omitted), r.minVersions); err != nil {
+		return err
+	}
+	if flags.strict {
+		return strictError(r.failures)
+	}
 	return nil
 }
 
-func runStatus(out *output.Output, flags *rootFlags) error {
+// fetchProblems explains failed latest-version fetches in a line each, e.g.
+// "Couldn't fetch latest Codex, Gemini CLI: offline: registry.npmjs.org
+// unreachable (DNS lookup failed)". Agents fetched from the same place share
+// a line.
+func fetchProblems(errs map[string]error) []string {
+	var problems []string
+	agents := make(map[string][]string)
+	for _, agent := range version.Agents {
+		p := version.FetchProblem(errs[agent])
+		if p == "" {
+			continue
+		}
+		if agents[p] == nil {
+			problems = append(problems, p)
+		}
+		agents[p] = append(agents[p], version.DisplayName(agent))
+	}
+	lines := make([]string, len(problems))
+	for i, p := range problems {
+		lines[i] = fmt.Sprintf("Couldn't fetch latest %s: %s", strings.Join(agents[p], ", "), p)
+	}
+	return lines
+}
+
+// skip drops the sessions that panicked while being worked on, counting
+// each as a detection failure
+func (r *statusReport) skip(panics []*process.PanicError) {
+	r.sessions = process.DropPanicked(r.sessions, panics)
+	for _, p := range panics {
+		r.failures = append(r.failures, p)
+	}
+	r.skipped += len(panics)
+}
+
+// strictError combines detection failures into the error --strict exits with
+func strictError(failures []error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("strict: %w", errors.Join(failures...))
+}
+
+// detectionFailure reports whether an installed-version error is a real
+// failure rather than the agent simply not being installed
+func detectionFailure(err error) bool {
+	return err != nil && !errors.Is(err, version.ErrNotInstalled)
+}
+
+// undetectedInstalls returns a warning for each agent (per host) that has
+// sessions running but no detectable installed version, as their sessions
+// can't be checked for restart
+func undetectedInstalls(sessions []*process.Session, installed map[string]string) []string {
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, s := range sessions {
+		if s.CurrentVersion(installed) != "" {
+			continue
+		}
+		agent := s.Agent
+		if s.Host != "" {
+			agent += " on " + s.Host
+		}
+		if !seen[agent] {
+			seen[agent] = true
+			warnings = append(warnings, fmt.Sprintf("Couldn't determine installed %s version; restart detection disabled", agent))
+		}
+	}
+	return warnings
+}
+
+// gatherStatus collects installed/latest versions and running sessions.
+// Latest versions come from the version cache if it is younger than fetchTTL.
+// A scan that runs past --timeout is cut short and keeps what it has so far,
+// with a warning.
+func gatherStatus(ctx context.Context, flags *rootFlags, fetchTTL time.Duration) *statusReport {
+	ctx, cancel := flags.withTimeout(ctx)
+	defer cancel()
+
+	r := &statusReport{
+		installed:   make(map[string]string),
+		installErr:  make(map[string]error),
+		latest:      make(map[string]string),
+		minVersions: flags.minVersions,
+		enriched:    flags.enriches(enrichTmux),
+	}
+	r.installMethod = make(map[string]string)
+
 	// Get installed versions
-	claudeInstalled := version.GetInstalledClaude()
-	codexInstalled := version.GetInstalledCodex()
+	start := time.Now()
+	for _, agent := range version.Agents {
+		r.installed[agent], r.installErr[agent] = version.GetInstalledContext(ctx, agent)
+		if detectionFailure(r.installErr[agent]) {
+			r.failures = append(r.failures, r.installErr[agent])
+		}
+		if method, _ := version.InstallMethod(agent); method != "" {
+			r.installMethod[agent] = method
+		}
+		if r.installErr[agent] == nil && version.ConflictingInstalls(version.FindInstallsContext(ctx, agent)) {
+			r.warnings = append(r.warnings, fmt.Sprintf("Multiple %s installs with different versions; run `av doctor` for details", agent))
+		}
+	}
+	r.endPhase("version detection", start)
 
 	// Fetch latest versions (unless --no-fetch)
-	var claudeLatest, codexLatest string
 	if !flags.noFetch {
-		claudeLatest = version.FetchLatestClaude()
-		codexLatest = version.FetchLatestCodex()
+		start := time.Now()
+		latest := version.FetchLatestCachedContext(ctx, fetchTTL)
+		r.latest = latest.Latest
+		r.fetchErrors = latest.Errors
+		for _, agent := range version.Agents {
+			if err := latest.Errors[agent]; err != nil {
+				r.failures = append(r.failures, fmt.Errorf("fetch latest %s: %w", agent, err))
+			}
+		}
+		for _, v := range latest.Latest {
+			// Only report freshness if the fetch got anything at all
+			if v != "" {
+				r.latestFetchedAt = latest.FetchedAt
+				r.latestCached = latest.FromCache
+				break
+			}
+		}
+		r.endPhase("latest fetch", start)
+	}
+
+	// --installed-only stops before anything that runs ps or tmux
+	if flags.installedOnly {
+		r.enriched = false
+		r.checkTimeout(ctx, flags.timeout)
+		return r
 	}
 
 	// Find running sessions
-	sessions := process.FindAgentSessions()
+	start = time.Now()
+	var err error
+	var panics []*process.PanicError
+	r.sessions, panics, err = process.ScanAgentSessionsContext(ctx, runner.Local)
+	if err != nil {
+		r.failures = append(r.failures, err)
+	}
+	r.skip(panics)
+	r.endPhase("process scan", start)
+
+	// Enrich with tmux info (unless --no-enrich or skipped). One tmux call
+	// lists every pane; each session is then matched to its own.
+	if r.enriched {
+		start = time.Now()
+		tmuxPanes, _ := tmux.GetPanesContext(ctx, runner.Local)
+		r.skip(process.EnrichContext(ctx, r.sessions, process.EnrichWorkers, process.TmuxEnricher(tmuxPanes)))
+		r.endPhase("tmux enrichment", start)
+	}
+
+	// Sessions without a tmux pane still get a working dir: from /proc per
+	// session, then from one lsof for the rest
+	if flags.enriches(enrichCwd) {
+		start = time.Now()
+		r.skip(process.EnrichContext(ctx, r.sessions, process.EnrichWorkers, process.CwdEnricher))
+		process.EnrichWithLsofContext(ctx, r.sessions, flags.lsof)
+		r.endPhase("working dir lookup", start)
+	}
+
+	// Check for active work in each session, capturing several panes at
+	// once. A text summary doesn't show it, so it skips the captures unless
+	// --select may test it or --group-summary counts it.
+	if flags.enriches(enrichActiveWork) && (!flags.summary || flags.json || flags.selector != nil || flags.groupSummary) {
+		start = time.Now()
+		r.skip(process.EnrichContext(ctx, r.sessions, process.EnrichWorkers, activeWork(runner.Local)))
+		r.endPhase("active-work detection", start)
+	}
+
+	// Only the table's model column and JSON show models not given on the
+	// command line, so a text summary skips looking for them too
+	if flags.enriches(enrichModel) && (!flags.summary || flags.json || flags.selector != nil) {
+		start = time.Now()
+		r.skip(process.EnrichContext(ctx, r.sessions, process.EnrichWorkers, model(flags.lsof)))
+		r.endPhase("model detection", start)
+	}
+
+	// Remote hosts come last, already enriched. One that can't be reached
+	// is reported but doesn't hide the rest.
+	if len(flags.remotes) > 0 {
+		start = time.Now()
+		for _, host := range flags.remotes {
+			sessions, warnings, err := scanRemote(ctx, host, r.enriched, flags.enriches(enrichActiveWork))
+			if err != nil {
+				r.failures = append(r.failures, fmt.Errorf("remote %s: %w", host, err))
+				r.warnings = append(r.warnings, fmt.Sprintf("Couldn't scan %s: %v", host, err))
+				continue
+			}
+			r.sessions = append(r.sessions, sessions...)
+			r.warnings = append(r.warnings, warnings...)
+		}
+		r.endPhase("remote scan", start)
+	}
+
+	r.warnings = append(r.warnings, undetectedInstalls(r.sessions, r.installed)...)
+	if unknown := unknownWork(r.sessions); unknown > 0 {
+		r.warnings = append(r.warnings, fmt.Sprintf("Couldn't capture the pane of %d session(s), so whether they have active work is unknown; restart leaves them alone unless --unknown-work=proceed", unknown))
+	}
+	if r.skipped > 0 {
+		r.warnings = append(r.warnings, fmt.Sprintf("Skipped %d session(s) av failed to process; --strict shows why", r.skipped))
+	}
+
+	if flags.workingDir != "" {
+		r.sessions = process.FilterByWorkingDir(r.sessions, flags.workingDir)
+	}
+	if flags.ppid != 0 {
+		// Without the tree no session can be shown to be in scope
+		tree, err := process.GetTreeContext(ctx, runner.Local)
+		if err != nil {
+			r.failures = append(r.failures, err)
+			r.warnings = append(r.warnings, fmt.Sprintf("Couldn't read the process tree for --ppid: %v", err))
+		}
+		r.sessions = process.FilterByAncestor(r.sessions, tree, flags.ppid)
+	}
+	if flags.tty != "" {
+		filtered := process.FilterByTTY(r.sessions, flags.tty)
+		if len(filtered) == 0 {
+			r.ttyErr = process.NoSessionOnTTY(flags.tty, r.sessions)
+		}
+		r.sessions = filtered
+	}
 
-	// Enrich with tmux info
-	tmuxPanes := tmux.GetPanes()
-	process.EnrichWithTmux(sessions, tmuxPanes)
+	// Without tmux info sessions can't be told apart across runs
+	if r.enriched {
+		if err := trackHistory(r.sessions, r.installed); err != nil {
+			r.warnings = append(r.warnings, fmt.Sprintf("Couldn't update session history: %v", err))
+		}
+	}
+
+	// Selected after history is tracked, so restarts can be selected on
+	if flags.selector != nil {
+		r.sessions = process.FilterBySelector(r.sessions, flags.selector, r.installed)
+	}
+
+	if flags.verbose {
+		r.warnings = append(r.warnings, restrictedWarnings(r.sessions)...)
+	}
+	for _, s := range r.sessions {
+		s.SetStatus(r.installed, r.minVersions)
+	}
 
-	// Check for active work in each session
+	r.checkTimeout(ctx, flags.timeout)
+	return r
+}
+
+// restrictedWarnings explains each session whose version couldn't be read
+// for lack of permission
+func restrictedWarnings(sessions []*process.Session) []string {
+	var warnings []string
 	for _, s := range sessions {
-		if s.TmuxSession != "" {
-			s.HasActiveWork = tmux.HasActiveWork(s.TmuxSession)
+		if s.VersionRestricted {
+			warnings = append(warnings, fmt.Sprintf("%s: not permitted to inspect its processes, so its version is unknown; it likely runs as another user, so run av as that user (or with sudo) to check it", s.Label()))
 		}
 	}
+	return warnings
+}
 
-	// Output
-	if flags.json {
-		return out.JSON(map[string]any{
-			"installed": map[string]string{
-				"claude": claudeInstalled,
-				"codex":  codexInstalled,
-			},
-			"latest": map[string]string{
-				"claude": claudeLatest,
-				"codex":  codexLatest,
-			},
-			"sessions": sessions,
-		})
+// checkTimeout notes that the scan ran out of time, if it did
+func (r *statusReport) checkTimeout(ctx context.Context, timeout time.Duration) {
+	if timedOut(ctx) {
+		r.failures = append(r.failures, fmt.Errorf("scan timed out after %s", timeout))
+		r.warnings = append(r.warnings, fmt.Sprintf("Scan timed out after %s; showing what was gathered so far", timeout))
 	}
+}
 
-	out.PrintHeader("Installed Versions")
-	out.PrintVersion("Claude Code", claudeInstalled, claudeLatest)
-	out.PrintVersion("Codex", codexInstalled, codexLatest)
-	fmt.Println()
+// narrow applies --only-restartable and --limit to the sessions shown
+func (r *statusReport) narrow(flags *rootFlags) {
+	if flags.onlyRestartable {
+		r.onlyRestartable()
+	}
+	r.limitSessions(flags.limit)
+}
 
-	out.PrintHeader("Running Sessions")
-	needsRestart := out.PrintSessions(sessions, claudeInstalled, codexInstalled)
+// limitSessions keeps the first n sessions, setting the rest aside as omitted.
+// n <= 0 keeps them all.
+func (r *statusReport) limitSessions(n int) {
+	if n <= 0 || len(r.sessions) <= n {
+		return
+	}
+	r.omitted = append(r.omitted, r.sessions[n:]...)
+	r.sessions = r.sessions[:n]
+}
 
-	if needsRestart > 0 {
-		fmt.Printf("\n%d session(s) need restart. Run `av restart` to update them.\n", needsRestart)
+// onlyRestartable keeps the sessions av restart would act on, setting the
+// rest aside as omitted so they still count towards the summary
+func (r *statusReport) onlyRestartable() {
+	restartable := restartCandidates(r.sessions, r.installed, false)
+	for _, s := range r.sessions {
+		if !slices.Contains(restartable, s) {
+			r.omitted = append(r.omitted, s)
+		}
 	}
+	r.sessions = restartable
+}
 
-	return nil
+// statusSummary is the computed verdict included in JSON output, so
+// consumers don't have to derive it from the raw data
+type statusSummary struct {
+	AnyUpdateAvailable     bool     `json:"any_update_available"`
+	SessionsNeedingRestart int      `json:"sessions_needing_restart"`
+	BusySessions           int      `json:"busy_sessions"`
+	InstallsBelowMinimum   []string `json:"installs_below_minimum"`
+	SessionsBelowMinimum   int      `json:"sessions_below_minimum"`
+	// Status is the most pressing of "below_minimum", "restart_needed",
+	// "updates" and "ok"
+	Status string `json:"status"`
 }
 
-func newCheckCmd(flags *rootFlags, out *output.Output) *cobra.Command {
-	return &cobra.Command{
-		Use:   "check",
-		Short: "Check for updates (no process scan)",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			claudeInstalled := version.GetInstalledClaude()
-			codexInstalled := version.GetInstalledCodex()
-			claudeLatest := version.FetchLatestClaude()
-			codexLatest := version.FetchLatestCodex()
+// statusJSON is the status as av --json prints it, fields in the order
+// they're printed: installs, then sessions, then the verdict on them. Fields
+// marked omitzero only appear when they apply.
+type statusJSON struct {
+	// TakenAt is when a snapshot was taken
+	TakenAt         time.Time          `json:"taken_at,omitzero"`
+	Installed       map[string]string  `json:"installed"`
+	InstallStatus   map[string]string  `json:"install_status"`
+	InstallMethod   map[string]string  `json:"install_method,omitzero"`
+	Latest          map[string]string  `json:"latest"`
+	LatestFetchedAt time.Time          `json:"latest_fetched_at,omitzero"`
+	MinVersion      map[string]string  `json:"min_version,omitzero"`
+	Sessions        []*process.Session `json:"sessions"`
+	SessionsOmitted int                `json:"sessions_omitted,omitzero"`
+	SessionsSkipped int                `json:"sessions_skipped,omitzero"`
+	TmuxEnriched    bool               `json:"tmux_enriched"`
+	Summary         statusSummary      `json:"summary"`
+	// ChangedSessions and GoneSessions say what changed since the last
+	// refresh, in watch mode
+	ChangedSessions []string `json:"changed_sessions,omitzero"`
+	GoneSessions    *int     `json:"gone_sessions,omitzero"`
+	Warnings        []string `json:"warnings,omitzero"`
+}
 
-			if flags.json {
-				return out.JSON(map[string]any{
-					"installed": map[string]string{"claude": claudeInstalled, "codex": codexInstalled},
-					"latest":    map[string]string{"claude": claudeLatest, "codex": codexLatest},
-					"claude_update_available": claudeLatest != "" && claudeInstalled != claudeLatest,
-					"codex_update_available":  codexLatest != "" && codexInstalled != codexLatest,
-				})
+// checkJSON is the result of av check --json
+type checkJSON struct {
+	Installed     map[string]string `json:"installed"`
+	InstallStatus map[string]string `json:"install_status"`
+	InstallMethod map[string]string `json:"install_method"`
+	Latest        map[string]string `json:"latest"`
+	LatestStatus  map[string]string `json:"latest_status"`
+	// LatestErrors is set with --verbose
+	LatestErrors          map[string]string `json:"latest_errors,omitzero"`
+	ClaudeUpdateAvailable bool              `json:"claude_update_available"`
+	CodexUpdateAvailable  bool              `json:"codex_update_available"`
+	GeminiUpdateAvailable bool              `json:"gemini_update_available"`
+}
+
+// summary computes the verdict over all sessions, including any hidden by
+// --limit
+func (r *statusReport) summary() statusSummary {
+	sessions := slices.Concat(r.sessions, r.omitted)
+	agentsBelow, sessionsBelow := belowMinimum(r.installed, r.installErr, sessions, r.minVersions)
+	sum := statusSummary{
+		InstallsBelowMinimum: agentsBelow,
+		SessionsBelowMinimum: len(sessionsBelow),
+	}
+	if sum.InstallsBelowMinimum == nil {
+		sum.InstallsBelowMinimum = []string{}
+	}
+	for _, agent := range version.Agents {
+		if r.installErr[agent] == nil && r.latest[agent] != "" && r.installed[agent] != r.latest[agent] {
+			sum.AnyUpdateAvailable = true
+		}
+	}
+	for _, s := range sessions {
+		if s.Outdated(r.installed) {
+			sum.SessionsNeedingRestart++
+		}
+		if s.HasActiveWork {
+			sum.BusySessions++
+		}
+	}
+
+	switch {
+	case len(agentsBelow) > 0 || len(sessionsBelow) > 0:
+		sum.Status = "below_minimum"
+	case sum.SessionsNeedingRestart > 0:
+		sum.Status = "restart_needed"
+	case sum.AnyUpdateAvailable:
+		sum.Status = "updates"
+	default:
+		sum.Status = "ok"
+	}
+	return sum
+}
+
+// jsonData returns the status in the shape used by --json and av serve
+func (r *statusReport) jsonData() statusJSON {
+	installStatus := make(map[string]string)
+	latest := make(map[string]string)
+	for _, agent := range version.Agents {
+		installStatus[agent] = version.InstallStatus(r.installErr[agent])
+		latest[agent] = r.latest[agent]
+	}
+
+	data := statusJSON{
+		TakenAt:         r.takenAt,
+		Installed:       r.installed,
+		InstallStatus:   installStatus,
+		InstallMethod:   r.installMethod,
+		Latest:          latest,
+		LatestFetchedAt: r.latestFetchedAt,
+		Sessions:        r.sessions,
+		SessionsOmitted: len(r.omitted) + r.unseen,
+		SessionsSkipped: r.skipped,
+		TmuxEnriched:    r.enriched,
+		Summary:         r.summary(),
+		Warnings:        r.warnings,
+	}
+	if r.changed != nil {
+		data.ChangedSessions = []string{}
+		for _, s := range r.sessions {
+			if r.changed[s] {
+				data.ChangedSessions = append(data.ChangedSessions, s.Label())
 			}
+		}
+		data.GoneSessions = &r.gone
+	}
+	if len(r.minVersions) > 0 {
+		data.MinVersion = r.minVersions
+	}
+	return data
+}
 
-			out.PrintVersion("Claude Code", claudeInstalled, claudeLatest)
-			out.PrintVersion("Codex", codexInstalled, codexLatest)
-			return nil
-		},
+func printStatus(out *output.Output, flags *rootFlags, r *statusReport) error {
+	if flags.json {
+		if flags.summary {
+			return out.JSON(r.summary())
+		}
+		return out.JSON(r.jsonData())
 	}
+
+	for _, w := range r.warnings {
+		out.Warn(w)
+	}
+	for _, p := range fetchProblems(r.fetchErrors) {
+		out.Warn(p)
+	}
+
+	if flags.summary {
+		out.PrintSessionCounts(slices.Concat(r.sessions, r.omitted))
+		if n := r.summary().SessionsNeedingRestart; n > 0 {
+			out.Printf("%d session(s) need restart. Run `av restart` to update them.\n", n)
+		}
+		if flags.groupSummary {
+			printGroupSummary(out, r)
+		}
+		return nil
+	}
+
+	out.PrintHeader("Installed Versions")
+	for _, agent := range version.Agents {
+		var method string
+		if flags.showInstallMethod {
+			method = r.installMethod[agent]
+		}
+		out.PrintVersion(version.DisplayName(agent), r.installed[agent], method, r.latest[agent], r.minVersions[agent], r.installErr[agent], nil)
+	}
+	if flags.installedOnly {
+		if !r.latestFetchedAt.IsZero() && !flags.quiet {
+			out.Println()
+			out.PrintFetched(r.latestFetchedAt, r.latestCached)
+		}
+		return nil
+	}
+	out.Println()
+
+	out.PrintHeader("Running Sessions")
+	if !r.enriched {
+		out.PrintNote("tmux info unavailable (enrichment skipped)")
+	}
+	out.PrintSessions(r.sessions, r.installed, r.minVersions, output.SessionOptions{History: flags.history, Model: flags.showModel, Changed: r.changed})
+	if n := len(r.omitted) + r.unseen; n > 0 {
+		out.PrintNote(fmt.Sprintf("%d more not shown", n))
+	}
+	if r.changed != nil {
+		note := "* changed since the last refresh"
+		if r.gone > 0 {
+			note += fmt.Sprintf("; %d session(s) gone", r.gone)
+		}
+		out.PrintNote(note)
+	}
+
+	// Sessions hidden by --limit or --only-restartable need restarting too
+	if n := r.summary().SessionsNeedingRestart; n > 0 {
+		out.Printf("\n%d session(s) need restart. Run `av restart` to update them.\n", n)
+	}
+	if flags.groupSummary {
+		out.Println()
+		printGroupSummary(out, r)
+	}
+
+	if !r.latestFetchedAt.IsZero() && !flags.quiet {
+		out.Println()
+		out.PrintFetched(r.latestFetchedAt, r.latestCached)
+	}
+
+	return nil
+}
+
+// printGroupSummary prints the --group-summary totals line, over every
+// session including any hidden by --limit
+func printGroupSummary(out *output.Output, r *statusReport) {
+	sum := r.summary()
+	out.PrintTotals(slices.Concat(r.sessions, r.omitted), sum.SessionsNeedingRestart, sum.BusySessions)
 }
 
-func newRestartCmd(flags *rootFlags, out *output.Output) *cobra.Command {
-	var all bool
-	var yes bool
+func newCheckCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var verbose bool
 
 	cmd := &cobra.Command{
-		Use:   "restart",
-		Short: "Restart outdated sessions (interactive picker)",
+		Use:   "check",
+		Short: "Check for updates (no process scan)",
+		Long: `Check installed versions against the latest releases, without looking for
+running sessions. A fetch that can't reach the registry or gets an HTTP
+error is retried a couple of times before it counts as failed.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			claudeInstalled := version.GetInstalledClaude()
-			codexInstalled := version.GetInstalledCodex()
-
-			sessions := process.FindAgentSessions()
-			tmuxPanes := tmux.GetPanes()
-			process.EnrichWithTmux(sessions, tmuxPanes)
+			ctx, cancel := flags.withTimeout(cmd.Context())
+			defer cancel()
+
+			installed := make(map[string]string)
+			installErr := make(map[string]error)
+			installStatus := make(map[string]string)
+			installMethod := make(map[string]string)
+			latest := make(map[string]string)
+			fetchErr := make(map[string]error)
+			var failures []error
+			for _, agent := range version.Agents {
+				installed[agent], installErr[agent] = version.GetInstalledContext(ctx, agent)
+				installStatus[agent] = version.InstallStatus(installErr[agent])
+				installMethod[agent], _ = version.InstallMethod(agent)
+				if detectionFailure(installErr[agent]) {
+					failures = append(failures, installErr[agent])
+				}
 
-			// Check for active work in each session
-			for _, s := range sessions {
-				if s.TmuxSession != "" {
-					s.HasActiveWork = tmux.HasActiveWork(s.TmuxSession)
+				latest[agent], fetchErr[agent] = version.FetchLatestRetryContext(ctx, agent)
+				if fetchErr[agent] != nil {
+					failures = append(failures, fmt.Errorf("fetch latest %s: %w", agent, fetchErr[agent]))
 				}
 			}
+			if timedOut(ctx) {
+				failures = append(failures, fmt.Errorf("check timed out after %s", flags.timeout))
+				out.Warn(fmt.Sprintf("Check timed out after %s; showing what was gathered so far", flags.timeout))
+			}
 
-			// Filter to restartable sessions
-			var candidates []*process.Session
-			for _, s := range sessions {
-				if s.TmuxSession == "" {
-					continue // Can't restart non-tmux
+			if flags.json {
+				latestStatus := make(map[string]string)
+				latestErrors := make(map[string]string)
+				for _, agent := range version.Agents {
+					latestStatus[agent] = version.FetchStatus(fetchErr[agent])
+					if fetchErr[agent] != nil {
+						latestErrors[agent] = fetchErr[agent].Error()
+					}
 				}
-				currentVersion := claudeInstalled
-				if s.Agent == "codex" {
-					currentVersion = codexInstalled
+				updateAvailable := func(agent string) bool {
+					return installErr[agent] == nil && latest[agent] != "" && installed[agent] != latest[agent]
 				}
-				if all || (s.RunningVersion != "" && s.RunningVersion != currentVersion) {
-					candidates = append(candidates, s)
+				data := checkJSON{
+					Installed:             installed,
+					InstallStatus:         installStatus,
+					InstallMethod:         installMethod,
+					Latest:                latest,
+					LatestStatus:          latestStatus,
+					ClaudeUpdateAvailable: updateAvailable("claude"),
+					CodexUpdateAvailable:  updateAvailable("codex"),
+					GeminiUpdateAvailable: updateAvailable("gemini"),
 				}
-			}
-
-			if len(candidates) == 0 {
-				out.Success("All sessions are up to date")
-				return nil
-			}
-
-			var toRestart []*process.Session
-
-			// Interactive picker unless --yes flag
-			if !yes && !flags.json {
-				picker := tui.NewPicker(sessions, claudeInstalled, codexInstalled)
-				p := tea.NewProgram(picker)
-				finalModel, err := p.Run()
-				if err != nil {
-					return fmt.Errorf("picker error: %w", err)
+				if verbose {
+					data.LatestErrors = latestErrors
 				}
-
-				result := finalModel.(tui.PickerModel)
-				if result.Cancelled() {
-					out.Info("Cancelled")
-					return nil
+				if err := out.JSON(data); err != nil {
+					return err
 				}
-
-				toRestart = result.SelectedSessions()
 			} else {
-				toRestart = candidates
-			}
-
-			if len(toRestart) == 0 {
-				out.Info("No sessions selected")
-				return nil
-			}
-
-			out.Info(fmt.Sprintf("Restarting %d session(s)...", len(toRestart)))
-
-			for _, s := range toRestart {
-				// Check for active work before restarting
-				if tmux.HasActiveWork(s.TmuxSession) {
-					out.Warn(fmt.Sprintf("Skipped %s (has active work)", s.TmuxSession))
-					continue
+				if !verbose {
+					for _, p := range fetchProblems(fetchErr) {
+						out.Warn(p)
+					}
 				}
-
-				if err := tmux.RestartSession(s.TmuxSession, s.Agent); err != nil {
-					out.Warn(fmt.Sprintf("Failed to restart %s: %v", s.TmuxSession, err))
-				} else {
-					out.Success(fmt.Sprintf("Restarted %s", s.TmuxSession))
+				for _, agent := range version.Agents {
+					out.PrintVersion(version.DisplayName(agent), installed[agent], "", latest[agent], flags.minVersions[agent], installErr[agent], fetchErr[agent])
+					if verbose && fetchErr[agent] != nil {
+						out.PrintNote(fetchErr[agent].Error())
+					}
 				}
 			}
 
+			if err := minimumError(installed, installErr, nil, flags.minVersions); err != nil {
+				return err
+			}
+			if flags.strict {
+				return strictError(failures)
+			}
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVar(&all, "all", false, "Include all sessions, even if current")
-	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip interactive picker, restart all outdated")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show why a latest-version fetch failed")
 	return cmd
 }
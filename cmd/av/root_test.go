@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/version"
+)
+
+// jsonKeys returns the keys of the JSON object v marshals to, in the order
+// they're written
+func jsonKeys(t *testing.T, v any) []string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		t.Fatalf("%s isn't an object", data)
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, tok.(string))
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestStatusJSONFieldOrder(t *testing.T) {
+	s := &process.Session{PID: 1, Agent: "claude", TmuxSession: "api"}
+	full := &statusReport{
+		installed:       map[string]string{"claude": "2.1.14"},
+		installErr:      map[string]error{"codex": version.ErrNotInstalled},
+		latest:          map[string]string{"claude": "2.1.14"},
+		installMethod:   map[string]string{"claude": "native"},
+		minVersions:     map[string]string{"claude": "2.0.0"},
+		sessions:        []*process.Session{s},
+		enriched:        true,
+		omitted:         []*process.Session{{PID: 2, Agent: "codex"}},
+		skipped:         1,
+		latestFetchedAt: time.Now(),
+		takenAt:         time.Now(),
+		changed:         map[*process.Session]bool{s: true},
+		warnings:        []string{"careful"},
+	}
+	bare := &statusReport{
+		installed:  map[string]string{},
+		installErr: map[string]error{},
+		latest:     map[string]string{},
+	}
+
+	tests := []struct {
+		name string
+		r    *statusReport
+		want []string
+	}{
+		{"every field", full, []string{
+			"taken_at", "installed", "install_status", "install_method", "latest", "latest_fetched_at",
+			"min_version", "sessions", "sessions_omitted", "sessions_skipped", "tmux_enriched", "summary",
+			"changed_sessions", "gone_sessions", "warnings",
+		}},
+		{"only those always there", bare, []string{
+			"installed", "install_status", "latest", "sessions", "tmux_enriched", "summary",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonKeys(t, tt.r.jsonData()); !slices.Equal(got, tt.want) {
+				t.Errorf("status keys = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+
+	want := []string{
+		"any_update_available", "sessions_needing_restart", "busy_sessions",
+		"installs_below_minimum", "sessions_below_minimum", "status",
+	}
+	if got := jsonKeys(t, full.summary()); !slices.Equal(got, want) {
+		t.Errorf("summary keys = %q\nwant %q", got, want)
+	}
+}
+
+func TestCheckJSONFieldOrder(t *testing.T) {
+	data := checkJSON{LatestErrors: map[string]string{"codex": "timeout"}}
+	want := []string{
+		"installed", "install_status", "install_method", "latest", "latest_status", "latest_errors",
+		"claude_update_available", "codex_update_available", "gemini_update_available",
+	}
+	if got := jsonKeys(t, data); !slices.Equal(got, want) {
+		t.Errorf("check keys = %q\nwant %q", got, want)
+	}
+}
+
+func TestRestrictedWarnings(t *testing.T) {
+	sessions := []*process.Session{
+		{PID: 1, Agent: "claude", TmuxSession: "api", VersionRestricted: true},
+		{PID: 2, Agent: "claude", TmuxSession: "web"},
+	}
+	got := restrictedWarnings(sessions)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "api: not permitted") {
+		t.Errorf("restrictedWarnings = %q, want one about api", got)
+	}
+}
+
+// tempHome points HOME and the XDG dirs at a temp dir, so commands run in
+// tests neither read nor write the user's config, state or cache
+func tempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, ".local", "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	return home
+}
+
+func TestJSONIndent(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		args   []string
+		indent string // before the first key; "" for one line
+	}{
+		{"default", "", nil, "  "},
+		{"flag", "", []string{"--json-indent", "4"}, "    "},
+		{"env", "0", nil, ""},
+		{"flag over env", "0", []string{"--json-indent", "3"}, "   "},
+		{"compact over env", "4", []string{"--compact"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := tempHome(t)
+			if tt.env != "" {
+				t.Setenv("AV_JSON_INDENT", tt.env)
+			}
+			path := filepath.Join(home, "status.json")
+			args := append([]string{"--json", "--no-fetch", "--working-dir", home, "--output-file", path}, tt.args...)
+			if err := execute(args); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if tt.indent == "" {
+				if len(lines) != 1 {
+					t.Errorf("got %d lines, want one:\n%s", len(lines), data)
+				}
+				return
+			}
+			if len(lines) < 2 || !strings.HasPrefix(lines[1], tt.indent+`"`) {
+				t.Errorf("want the first key indented by %d spaces:\n%s", len(tt.indent), data)
+			}
+		})
+	}
+}
+
+func TestFetchProblems(t *testing.T) {
+	offline := fmt.Errorf("%w: %w", version.ErrNetwork, &url.Error{Op: "Get", URL: "https://registry.npmjs.org/@openai/codex", Err: &net.DNSError{Err: "no such host", IsNotFound: true}})
+	geminiOffline := fmt.Errorf("%w: %w", version.ErrNetwork, &url.Error{Op: "Get", URL: "https://registry.npmjs.org/@google/gemini-cli", Err: &net.DNSError{Err: "no such host", IsNotFound: true}})
+	got := fetchProblems(map[string]error{
+		"claude": version.ErrOffline,
+		"codex":  offline,
+		"gemini": geminiOffline,
+	})
+	want := []string{
+		"Couldn't fetch latest Claude Code: fetching is turned off",
+		"Couldn't fetch latest Codex, Gemini CLI: offline: registry.npmjs.org unreachable (DNS lookup failed)",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("fetchProblems = %q\nwant %q", got, want)
+	}
+	if got := fetchProblems(map[string]error{}); len(got) != 0 {
+		t.Errorf("fetchProblems with no errors = %q, want none", got)
+	}
+}
+
+func TestWatchTakesStatusFlags(t *testing.T) {
+	home := tempHome(t)
+	shared := []string{"--no-enrich", "--skip-enrich", "model", "--limit", "1", "--only-restartable", "--summary", "--history", "--verbose"}
+	for _, cmd := range [][]string{nil, {"watch", "--once"}} {
+		path := filepath.Join(home, "status.json")
+		args := slices.Concat(cmd, []string{"--json", "--no-fetch", "--output-file", path}, shared)
+		if err := execute(args); err != nil {
+			t.Errorf("av %s: %v", strings.Join(args, " "), err)
+		}
+	}
+}
+
+func TestQuietLeavesOutFetched(t *testing.T) {
+	r := &statusReport{
+		installed:       map[string]string{},
+		installErr:      map[string]error{},
+		latest:          map[string]string{},
+		latestFetchedAt: time.Now(),
+		latestCached:    true,
+	}
+	for _, quiet := range []bool{false, true} {
+		var stdout, stderr bytes.Buffer
+		out := output.New(&stdout, &stderr)
+		if err := printStatus(out, &rootFlags{quiet: quiet}, r); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(stdout.String(), "latest checked"); got == quiet {
+			t.Errorf("quiet=%v: printed the fetched note = %v:\n%s", quiet, got, stdout.String())
+		}
+	}
+}
+
+func TestNeedRestartCountsLimitedSessions(t *testing.T) {
+	r := &statusReport{
+		installed:  map[string]string{"claude": "2.1.14"},
+		installErr: map[string]error{},
+		latest:     map[string]string{},
+		enriched:   true,
+		sessions: []*process.Session{
+			{PID: 1, Agent: "claude", RunningVersion: "2.1.14", TmuxSession: "api"},
+			{PID: 2, Agent: "claude", RunningVersion: "2.1.10", TmuxSession: "web"},
+			{PID: 3, Agent: "claude", RunningVersion: "2.1.12", TmuxSession: "docs"},
+		},
+	}
+	flags := &rootFlags{limit: 1}
+	r.narrow(flags)
+	var stdout, stderr bytes.Buffer
+	if err := printStatus(output.New(&stdout, &stderr), flags, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "2 session(s) need restart") {
+		t.Errorf("want both sessions hidden by --limit counted:\n%s", stdout.String())
+	}
+}
+
+func TestEnvSetsEveryFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		args []string
+	}{
+		{"global", "AV_TIMEOUT", []string{"--no-fetch"}},
+		{"status", "AV_LIMIT", []string{"--no-fetch"}},
+		{"subcommand", "AV_LINES", []string{"log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempHome(t)
+			t.Setenv(tt.env, "not-a-number")
+			err := execute(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.env) {
+				t.Errorf("err = %v, want %s rejected", err, tt.env)
+			}
+		})
+	}
+}
+
+func TestWorkingDirNeedsWorkingDirs(t *testing.T) {
+	tests := []struct {
+		skip    string
+		wantErr bool
+	}{
+		{"tmux", false},
+		{"cwd", false},
+		{"tmux,cwd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.skip, func(t *testing.T) {
+			home := tempHome(t)
+			path := filepath.Join(home, "status.json")
+			err := execute([]string{"--json", "--no-fetch", "--skip-enrich", tt.skip, "--working-dir", home, "--output-file", path})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// Nothing runs in a fresh temp dir, whatever runs elsewhere
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status struct {
+				Sessions []json.RawMessage `json:"sessions"`
+			}
+			if err := json.Unmarshal(data, &status); err != nil {
+				t.Fatal(err)
+			}
+			if len(status.Sessions) != 0 {
+				t.Errorf("got %d sessions under an empty dir, want none", len(status.Sessions))
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// scanCache memoizes gatherStatus so frequent readers (HTTP requests, socket
+// clients) don't each trigger a full ps/tmux scan
+type scanCache struct {
+	flags    *rootFlags
+	fetchTTL time.Duration
+	// ttl is how old a cached report may get before get rescans; 0 rescans
+	// on every get
+	ttl time.Duration
+
+	mu         sync.Mutex
+	report     *statusReport
+	gatheredAt time.Time
+}
+
+func newScanCache(flags *rootFlags, fetchTTL, ttl time.Duration) *scanCache {
+	return &scanCache{flags: flags, fetchTTL: fetchTTL, ttl: ttl}
+}
+
+// get returns the cached report, rescanning if it is older than the cache's
+// TTL
+func (c *scanCache) get() *statusReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report == nil || time.Since(c.gatheredAt) >= c.ttl {
+		c.rescanLocked()
+	}
+	return c.report
+}
+
+// refresh forces a rescan regardless of the cached report's age
+func (c *scanCache) refresh() *statusReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rescanLocked()
+	return c.report
+}
+
+// reload re-reads the config, then rescans and refetches latest versions,
+// bypassing the version cache. A bad config keeps the previous settings.
+func (c *scanCache) reload() (*statusReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if c.flags.reloadConfig != nil {
+		err = c.flags.reloadConfig()
+	}
+	c.report = gatherStatus(context.Background(), c.flags, 0)
+	c.gatheredAt = time.Now()
+	return c.report, err
+}
+
+func (c *scanCache) rescanLocked() {
+	c.report = gatherStatus(context.Background(), c.flags, c.fetchTTL)
+	c.gatheredAt = time.Now()
+}
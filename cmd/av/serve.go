@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+func newServeCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var addr string
+	var fetchTTL time.Duration
+	var scanTTL time.Duration
+	var pprofAddr string
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve status over HTTP (/status, /metrics, /healthz)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if scanTTL < 0 {
+				return fmt.Errorf("--scan-cache-ttl must not be negative")
+			}
+			if pprofAddr != "" {
+				stopPprof, err := startPprof(out, pprofAddr)
+				if err != nil {
+					return err
+				}
+				defer stopPprof()
+			}
+
+			cache := newScanCache(flags, fetchTTL, scanTTL)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				enc.Encode(cache.get().jsonData())
+			})
+			mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+				writeMetrics(w, cache.get())
+			})
+			mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, "ok")
+			})
+
+			srv := &http.Server{Addr: addr, Handler: mux}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// Refresh signals just invalidate the cache; the mutex in
+			// scanCache serializes them with request-driven scans
+			refresh, stopRefresh := refreshSignals()
+			defer stopRefresh()
+			go func() {
+				for sig := range refresh {
+					if isReload(sig) {
+						if _, err := cache.reload(); err != nil {
+							out.Warn(fmt.Sprintf("Config reload failed: %v", err))
+						}
+					} else {
+						cache.refresh()
+					}
+				}
+			}()
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- srv.ListenAndServe()
+			}()
+			out.Info(fmt.Sprintf("Listening on %s", addr))
+
+			select {
+			case err := <-errCh:
+				return err
+			case <-ctx.Done():
+			}
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("shutdown: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", ":8080", "Address to listen on")
+	cmd.Flags().DurationVar(&fetchTTL, "fetch-ttl", 15*time.Minute, "Fetch latest versions at most once per this duration")
+	cmd.Flags().DurationVar(&scanTTL, "scan-cache-ttl", 10*time.Second, "Rescan processes when the cached scan is older than this (0 = on every request)")
+	addPprofFlag(cmd, &pprofAddr)
+	return cmd
+}
+
+// writeMetrics renders the status report in Prometheus text format
+func writeMetrics(w io.Writer, r *statusReport) {
+	installed := r.installed
+	latest := r.latest
+	agents := version.Agents
+
+	fmt.Fprintln(w, "# HELP av_installed_info Installed agent version.")
+	fmt.Fprintln(w, "# TYPE av_installed_info gauge")
+	for _, a := range agents {
+		if installed[a] != "" {
+			fmt.Fprintf(w, "av_installed_info{agent=%q,version=%q} 1\n", a, installed[a])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP av_update_available Whether a newer agent version is available.")
+	fmt.Fprintln(w, "# TYPE av_update_available gauge")
+	for _, a := range agents {
+		fmt.Fprintf(w, "av_update_available{agent=%q} %d\n", a, boolMetric(latest[a] != "" && installed[a] != latest[a]))
+	}
+
+	sessions := make(map[string]int)
+	outdated := make(map[string]int)
+	busy := make(map[string]int)
+	for _, s := range r.sessions {
+		sessions[s.Agent]++
+		if s.Outdated(installed) {
+			outdated[s.Agent]++
+		}
+		if s.HasActiveWork {
+			busy[s.Agent]++
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP av_sessions Running agent sessions.")
+	fmt.Fprintln(w, "# TYPE av_sessions gauge")
+	for _, a := range agents {
+		fmt.Fprintf(w, "av_sessions{agent=%q} %d\n", a, sessions[a])
+	}
+
+	fmt.Fprintln(w, "# HELP av_sessions_outdated Sessions running an older version than installed.")
+	fmt.Fprintln(w, "# TYPE av_sessions_outdated gauge")
+	for _, a := range agents {
+		fmt.Fprintf(w, "av_sessions_outdated{agent=%q} %d\n", a, outdated[a])
+	}
+
+	fmt.Fprintln(w, "# HELP av_sessions_busy Sessions with active work.")
+	fmt.Fprintln(w, "# TYPE av_sessions_busy gauge")
+	for _, a := range agents {
+		fmt.Fprintf(w, "av_sessions_busy{agent=%q} %d\n", a, busy[a])
+	}
+}
+
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
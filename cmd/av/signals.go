@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// refreshSignals subscribes to the signals long-running modes react to:
+//
+//	SIGUSR1  rescan immediately
+//	SIGHUP   reload: re-read the config file, rescan and refetch latest
+//	         versions, bypassing the cache
+//
+// Call the returned stop function to unsubscribe.
+func refreshSignals() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGHUP)
+	return ch, func() { signal.Stop(ch) }
+}
+
+// isReload reports whether sig asks for a full reload rather than a rescan
+func isReload(sig os.Signal) bool {
+	return sig == syscall.SIGHUP
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// statusSnapshot is a status as saved by av snapshot save: the --json shape
+// plus when it was taken, so a saved `av --json` works as a snapshot too
+type statusSnapshot struct {
+	TakenAt         time.Time          `json:"taken_at"`
+	Installed       map[string]string  `json:"installed"`
+	InstallStatus   map[string]string  `json:"install_status"`
+	InstallMethod   map[string]string  `json:"install_method"`
+	Latest          map[string]string  `json:"latest"`
+	LatestFetchedAt time.Time          `json:"latest_fetched_at"`
+	MinVersion      map[string]string  `json:"min_version"`
+	Sessions        []*process.Session `json:"sessions"`
+	SessionsOmitted int                `json:"sessions_omitted"`
+	SessionsSkipped int                `json:"sessions_skipped"`
+	TmuxEnriched    bool               `json:"tmux_enriched"`
+	Warnings        []string           `json:"warnings"`
+}
+
+// report turns the snapshot back into the statusReport it was saved from,
+// so it renders exactly like a live status
+func (s *statusSnapshot) report() *statusReport {
+	r := &statusReport{
+		installed:       s.Installed,
+		installErr:      make(map[string]error),
+		installMethod:   s.InstallMethod,
+		latest:          s.Latest,
+		minVersions:     s.MinVersion,
+		sessions:        s.Sessions,
+		enriched:        s.TmuxEnriched,
+		latestFetchedAt: s.LatestFetchedAt,
+		warnings:        s.Warnings,
+		takenAt:         s.TakenAt,
+		skipped:         s.SessionsSkipped,
+		unseen:          s.SessionsOmitted,
+	}
+	if s.SessionsOmitted > 0 {
+		r.warnings = append(slices.Clip(r.warnings), fmt.Sprintf("Saved with --limit or --only-restartable, leaving out %d session(s); counts only include the sessions listed", s.SessionsOmitted))
+	}
+	for _, agent := range version.Agents {
+		switch s.InstallStatus[agent] {
+		case "not_installed":
+			r.installErr[agent] = version.ErrNotInstalled
+		case "version_unknown":
+			r.installErr[agent] = errors.New("version unknown")
+		}
+	}
+	return r
+}
+
+// loadSnapshot reads a snapshot, or any status saved with av --json
+func loadSnapshot(path string) (*statusSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s statusSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if s.Installed == nil {
+		return nil, fmt.Errorf("%s: not a full status from av --json (no installed versions)", path)
+	}
+	return &s, nil
+}
+
+func newSnapshotCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save the status to a file and show it again later",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "save [dir]",
+		Short: "Save the full status to a timestamped file (in the current dir by default)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+
+			r := gatherStatus(cmd.Context(), flags, 0)
+			r.takenAt = time.Now()
+			data, err := json.MarshalIndent(r.jsonData(), "", "  ")
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+
+			path := filepath.Join(dir, "av-snapshot-"+r.takenAt.Format("20060102-150405")+".json")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				return err
+			}
+			if flags.json {
+				return out.JSON(map[string]string{"path": path})
+			}
+			out.Success("Saved " + path)
+			return nil
+		},
+	})
+
+	showCmd := &cobra.Command{
+		Use:   "show <file>",
+		Short: "Show a saved snapshot as av would have at the time",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := loadSnapshot(args[0])
+			if err != nil {
+				return err
+			}
+			r := s.report()
+			r.limitSessions(flags.limit)
+			if !flags.json && !r.takenAt.IsZero() {
+				out.PrintNote("Snapshot taken " + r.takenAt.Local().Format("2006-01-02 15:04:05"))
+				out.Println()
+			}
+			return printStatus(out, flags, r)
+		},
+	}
+	showCmd.Flags().IntVar(&flags.limit, "limit", 0, "Show at most this many sessions (0 = all)")
+	showCmd.Flags().BoolVar(&flags.summary, "summary", false, "Print only session counts and how many need restart")
+	showCmd.Flags().BoolVar(&flags.showModel, "show-model", false, "Add a column with the model each session used")
+	showCmd.Flags().BoolVar(&flags.history, "history", false, "Show how long each session had been outdated and how often av restarted it")
+	cmd.AddCommand(showCmd)
+	return cmd
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buddyh/av/internal/output"
+)
+
+func TestSnapshotShowCountsOmitted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	data := `{
+  "installed": {"claude": "2.1.14", "codex": "", "gemini": ""},
+  "install_status": {"claude": "ok", "codex": "not_installed", "gemini": "not_installed"},
+  "latest": {"claude": "2.1.14"},
+  "sessions": [
+    {"pid": 1, "agent": "claude", "tmux_session": "api", "running_version": "2.1.14"},
+    {"pid": 2, "agent": "claude", "tmux_session": "web", "running_version": "2.1.14"}
+  ],
+  "sessions_omitted": 3,
+  "tmux_enriched": true
+}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s.report()
+	r.limitSessions(1)
+
+	if got := r.jsonData().SessionsOmitted; got != 4 {
+		t.Errorf("sessions_omitted = %d, want the 3 saved without plus 1 over --limit", got)
+	}
+
+	var stdout, stderr bytes.Buffer
+	out := output.New(&stdout, &stderr)
+	out.Configure(false, true, true, false, true)
+	if err := printStatus(out, &rootFlags{}, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "4 more not shown") {
+		t.Errorf("output doesn't say 4 more not shown:\n%s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "leaving out 3 session(s)") {
+		t.Errorf("no warning about the sessions the snapshot left out:\n%s", stderr.String())
+	}
+}
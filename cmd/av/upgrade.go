@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// upgradeCommand returns the shell command that upgrades an agent: the
+// configured one if set, else one for how it was installed (Homebrew, or
+// none for Nix, which is upgraded through its own config), else the
+// agent's own updater or a global npm install
+func upgradeCommand(flags *rootFlags, agent string) string {
+	if cmd := flags.upgradeCommands[agent]; cmd != "" {
+		return cmd
+	}
+	switch method, target := version.InstallMethod(agent); method {
+	case version.MethodHomebrew:
+		if name, cask := version.BrewPackage(target); cask {
+			return "brew upgrade --cask " + runner.ShellQuote(name)
+		} else if name != "" {
+			return "brew upgrade " + runner.ShellQuote(name)
+		}
+	case version.MethodNix:
+		return ""
+	}
+	switch agent {
+	case "claude":
+		return runner.ShellQuote(version.Binary("claude")) + " update"
+	case "codex":
+		return "npm install -g @openai/codex@latest"
+	case "gemini":
+		return "npm install -g @google/gemini-cli@latest"
+	default:
+		return ""
+	}
+}
+
+// upgradeResult records what av upgrade did for one agent
+type upgradeResult struct {
+	Agent    string `json:"agent"`
+	Before   string `json:"before"`
+	After    string `json:"after,omitempty"`
+	Latest   string `json:"latest,omitempty"`
+	Command  string `json:"command"`
+	Upgraded bool   `json:"upgraded"`
+	Skipped  string `json:"skipped,omitempty"` // why nothing was run
+	Error    string `json:"error,omitempty"`
+
+	// InstallMethod is how the agent was installed, which picks Command
+	InstallMethod string `json:"install_method,omitempty"`
+}
+
+func newUpgradeCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var dryRun bool
+	var yes bool
+	var restart bool
+
+	cmd := &cobra.Command{
+		Use:   "upgrade [agent...]",
+		Short: "Run each agent's updater (default: all installed agents)",
+		Long: `Run each agent's updater: "claude update" for Claude Code and a global
+npm install for Codex and Gemini CLI, or "brew upgrade" for an agent
+installed with Homebrew. An agent from the Nix store is skipped, since
+Nix manages it. An upgrade_command configured for an agent is run
+instead in every case, including for Nix installs.`,
+		ValidArgs: version.Agents,
+		Args:      cobra.OnlyValidArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateRestartFlags(flags); err != nil {
+				return err
+			}
+			agents := args
+			if len(agents) == 0 {
+				agents = version.Agents
+			}
+
+			var results []*upgradeResult
+			for _, agent := range version.Agents {
+				if !slices.Contains(agents, agent) {
+					continue
+				}
+				results = append(results, upgradeAgent(flags, out, agent, dryRun, yes))
+			}
+
+			if !restart || dryRun {
+				if flags.json {
+					return out.JSON(results)
+				}
+				return nil
+			}
+
+			restarts := restartUpgraded(cmd.Context(), flags, out, results)
+			if flags.json {
+				return out.JSON(map[string]any{
+					"upgrades": results,
+					"restarts": restarts,
+				})
+			}
+			printUpgradeSummary(out, results, restarts)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be run without upgrading")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	cmd.Flags().BoolVar(&restart, "restart", false, "Restart outdated sessions of upgraded agents afterwards")
+	addRestartFlags(cmd, flags)
+	return cmd
+}
+
+// upgradeAgent upgrades one agent if it's installed and behind latest, then
+// re-checks the installed version to confirm the upgrade took effect
+func upgradeAgent(flags *rootFlags, out *output.Output, agent string, dryRun, yes bool) *upgradeResult {
+	r := &upgradeResult{Agent: agent, Command: upgradeCommand(flags, agent)}
+	r.InstallMethod, _ = version.InstallMethod(agent)
+	name := version.DisplayName(agent)
+
+	before, err := version.GetInstalled(agent)
+	r.Before = before
+	if err != nil {
+		r.Skipped = "not installed"
+		if detectionFailure(err) {
+			r.Skipped = "installed version unknown"
+		}
+		if !flags.json {
+			out.Info(fmt.Sprintf("%s: skipped (%s)", name, r.Skipped))
+		}
+		return r
+	}
+
+	// Without a known latest version, let the updater decide
+	if !flags.noFetch {
+		r.Latest, _ = version.FetchLatest(agent)
+	}
+	if r.Latest != "" && version.Compare(before, r.Latest) >= 0 {
+		r.Skipped = "already current"
+		r.After = before
+		if !flags.json {
+			out.Success(fmt.Sprintf("%s %s is current", name, before))
+		}
+		return r
+	}
+
+	if r.Command == "" {
+		r.Skipped = "no upgrade command"
+		if !flags.json {
+			out.Info(fmt.Sprintf("%s: skipped (installed with %s; upgrade it there, or set upgrade_command)", name, r.InstallMethod))
+		}
+		return r
+	}
+
+	target := r.Latest
+	if target == "" {
+		target = "latest"
+	}
+	if dryRun {
+		r.Skipped = "dry run"
+		if !flags.json {
+			out.Info(fmt.Sprintf("%s: would upgrade %s -> %s with: %s", name, before, target, r.Command))
+		}
+		return r
+	}
+	if !yes && !flags.json && !confirm(fmt.Sprintf("Upgrade %s %s -> %s with `%s`?", name, before, target, r.Command)) {
+		r.Skipped = "declined"
+		out.Info(fmt.Sprintf("%s: skipped", name))
+		return r
+	}
+
+	// The updater's own output goes to stderr so --json stays parseable
+	c := exec.Command("sh", "-c", r.Command)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		r.Error = err.Error()
+		if !flags.json {
+			out.Warn(fmt.Sprintf("%s: upgrade failed: %v", name, err))
+		}
+		return r
+	}
+
+	r.After, _ = version.GetInstalled(agent)
+	r.Upgraded = r.After != "" && r.After != before
+	if !flags.json {
+		if r.Upgraded {
+			out.Success(fmt.Sprintf("%s upgraded %s -> %s", name, before, r.After))
+		} else {
+			out.Warn(fmt.Sprintf("%s still at %s after running `%s`", name, before, r.Command))
+		}
+	}
+	return r
+}
+
+// restartUpgraded restarts the outdated tmux sessions of every agent that was
+// just upgraded, with the same active-work guard as av restart
+func restartUpgraded(ctx context.Context, flags *rootFlags, out *output.Output, upgrades []*upgradeResult) []restartResult {
+	upgraded := make(map[string]bool)
+	for _, u := range upgrades {
+		if u.Upgraded {
+			upgraded[u.Agent] = true
+		}
+	}
+	if len(upgraded) == 0 {
+		return nil
+	}
+
+	installed, sessions, err := scanForRestart(ctx, flags, out)
+	if err != nil {
+		out.Warn(fmt.Sprintf("Restart skipped: %v", err))
+		return nil
+	}
+
+	var toRestart []*process.Session
+	for _, s := range restartCandidates(sessions, installed, false) {
+		// Remote sessions run a different install, untouched by this upgrade
+		if upgraded[s.Agent] && s.Host == "" {
+			toRestart = append(toRestart, s)
+		}
+	}
+	if len(toRestart) == 0 {
+		return nil
+	}
+	return restartSessions(ctx, out, flags, toRestart, installed, false, false)
+}
+
+// printUpgradeSummary prints one line per upgraded agent plus restart totals
+func printUpgradeSummary(out *output.Output, upgrades []*upgradeResult, restarts []restartResult) {
+	restarted, skipped, failed := 0, 0, 0
+	for _, r := range restarts {
+		switch {
+		case r.Restarted:
+			restarted++
+		case r.Error != "":
+			failed++
+		default:
+			skipped++
+		}
+	}
+
+	out.Println()
+	out.PrintHeader("Summary")
+	for _, u := range upgrades {
+		if u.Upgraded {
+			out.Printf("  %-14s %s -> %s\n", version.DisplayName(u.Agent), u.Before, u.After)
+		}
+	}
+	out.Printf("  Restarted %d session(s), skipped %d busy, %d failed\n", restarted, skipped, failed)
+}
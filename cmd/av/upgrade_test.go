@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeCommand(t *testing.T) {
+	// gemini installed with Homebrew, codex with npm, claude not at all
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	installs := map[string]string{
+		"gemini": filepath.Join(dir, "Cellar", "gemini-cli", "0.9.0", "bin", "gemini"),
+		"codex":  filepath.Join(dir, "lib", "node_modules", "@openai", "codex", "bin", "codex.js"),
+	}
+	for agent, target := range installs {
+		for _, d := range []string{filepath.Dir(target), bin} {
+			if err := os.MkdirAll(d, 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(target, []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(bin, agent)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name, agent, configured, want string
+	}{
+		{"Homebrew", "gemini", "", "brew upgrade gemini-cli"},
+		{"npm", "codex", "", "npm install -g @openai/codex@latest"},
+		{"own updater", "claude", "", "claude update"},
+		{"configured wins over Homebrew", "gemini", "mise upgrade gemini", "mise upgrade gemini"},
+		{"configured wins over npm", "codex", "pnpm add -g @openai/codex", "pnpm add -g @openai/codex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := &rootFlags{upgradeCommands: map[string]string{}}
+			if tt.configured != "" {
+				flags.upgradeCommands[tt.agent] = tt.configured
+			}
+			if got := upgradeCommand(flags, tt.agent); got != tt.want {
+				t.Errorf("upgradeCommand(%s) = %q, want %q", tt.agent, got, tt.want)
+			}
+		})
+	}
+}
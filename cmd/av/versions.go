@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/version"
+	"github.com/spf13/cobra"
+)
+
+func newVersionsCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	return &cobra.Command{
+		Use:   "versions",
+		Short: "List agent versions installed locally",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			listed := make(map[string][]version.LocalVersion)
+			for _, agent := range version.Agents {
+				versions, _ := version.ListInstalled(agent)
+				if versions == nil {
+					versions = []version.LocalVersion{}
+				}
+				listed[agent] = versions
+			}
+
+			if flags.json {
+				return out.JSON(listed)
+			}
+
+			for i, agent := range version.Agents {
+				if i > 0 {
+					out.Println()
+				}
+				out.PrintHeader(version.DisplayName(agent))
+				out.PrintLocalVersions(listed[agent])
+			}
+			return nil
+		},
+	}
+}
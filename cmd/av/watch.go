@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/spf13/cobra"
+)
+
+// minWatchInterval keeps watch mode from hammering ps/tmux
+const minWatchInterval = time.Second
+
+func newWatchCmd(flags *rootFlags, out *output.Output) *cobra.Command {
+	var interval time.Duration
+	var jitter time.Duration
+	var fetchTTL time.Duration
+	var diff bool
+	var once bool
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Continuously refresh the status view",
+		Long: `Continuously refresh the status view.
+
+The display refreshes every --interval, but latest versions are fetched from
+upstream at most once per --fetch-ttl; in between, the version cache is used.
+Use --jitter to spread refreshes when running several watch instances.
+With --diff, rows whose version, status or busy state changed since the
+previous refresh are marked with *. --once draws a single frame and exits,
+for checking the layout from a script.
+
+Send SIGUSR1 to refresh immediately, or SIGHUP to reload the config file and
+refetch latest versions, bypassing the cache.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval < minWatchInterval {
+				return fmt.Errorf("--interval must be at least %s", minWatchInterval)
+			}
+			if jitter < 0 {
+				return fmt.Errorf("--jitter must not be negative")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			refresh, stopRefresh := refreshSignals()
+			defer stopRefresh()
+
+			ttl := fetchTTL
+			var rows map[string]string
+			for {
+				report := gatherStatus(ctx, flags, ttl)
+				ttl = fetchTTL
+				if diff {
+					rows = report.diffRows(rows)
+				}
+				report.narrow(flags)
+
+				out.ClearScreen()
+				if err := printStatus(out, flags, report); err != nil {
+					return err
+				}
+				if flags.profile {
+					out.PrintProfile(report.timings)
+				}
+				if once {
+					return nil
+				}
+				if !flags.json {
+					out.Println()
+					out.PrintNote(fmt.Sprintf("refreshing every %s, Ctrl+C to quit", interval))
+				}
+
+				wait := interval
+				if jitter > 0 {
+					wait += time.Duration(rand.Int63n(int64(jitter)))
+				}
+
+				// Signals are handled here, between renders, so a forced
+				// refresh never overlaps a regular one
+				select {
+				case <-ctx.Done():
+					return nil
+				case sig := <-refresh:
+					if isReload(sig) {
+						if err := flags.reloadConfig(); err != nil {
+							out.Warn(fmt.Sprintf("Config reload failed: %v", err))
+						}
+						ttl = 0
+					}
+				case <-time.After(wait):
+				}
+			}
+		},
+	}
+
+	cmd.Flags().DurationVarP(&interval, "interval", "n", 5*time.Second, "Display refresh interval (minimum 1s)")
+	cmd.Flags().DurationVar(&jitter, "jitter", 0, "Add a random delay up to this duration to each refresh")
+	cmd.Flags().BoolVar(&diff, "diff", false, "Mark sessions whose version, status or busy state changed since the last refresh")
+	cmd.Flags().DurationVar(&fetchTTL, "fetch-ttl", 15*time.Minute, "Fetch latest versions at most once per this duration")
+	cmd.Flags().BoolVar(&once, "once", false, "Draw one frame and exit")
+	addStatusFlags(cmd, flags)
+	return cmd
+}
+
+// diffRows compares the report's sessions with the rows of the previous
+// refresh, setting changed and gone, and returns this refresh's rows. Rows
+// are keyed by session label; on the first refresh (prev nil) nothing is
+// marked.
+func (r *statusReport) diffRows(prev map[string]string) map[string]string {
+	rows := make(map[string]string, len(r.sessions))
+	r.changed = make(map[*process.Session]bool)
+	for _, s := range r.sessions {
+		row := fmt.Sprintf("%s|%t|%t|%t", s.RunningVersion, s.Outdated(r.installed), s.HasActiveWork, s.Attached)
+		rows[s.Label()] = row
+		if old, ok := prev[s.Label()]; prev != nil && (!ok || old != row) {
+			r.changed[s] = true
+		}
+	}
+	for label := range prev {
+		if _, ok := rows[label]; !ok {
+			r.gone++
+		}
+	}
+	return rows
+}
@@ -0,0 +1,255 @@
+// Package config loads the optional av config file
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/buddyh/av/internal/output"
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/version"
+)
+
+// Config holds user defaults. Flags given on the command line take
+// precedence over these values.
+type Config struct {
+	Plain   bool `json:"plain,omitempty"`
+	NoColor bool `json:"no_color,omitempty"`
+	Symbols bool `json:"symbols,omitempty"`
+	ASCII   bool `json:"ascii,omitempty"`
+	NoFetch bool `json:"no_fetch,omitempty"`
+	Lsof    bool `json:"lsof,omitempty"`
+
+	// Bin overrides the binary path per agent, e.g. {"claude": "/opt/claude/bin/claude"}
+	Bin map[string]string `json:"bin,omitempty"`
+	// UpgradeCommand overrides the shell command av upgrade runs, per agent
+	UpgradeCommand map[string]string `json:"upgrade_command,omitempty"`
+	// MinVersion is the oldest acceptable version per agent, e.g. {"claude": "2.0.0"}
+	MinVersion map[string]string `json:"min_version,omitempty"`
+	// ResumeCommand replaces the command restart relaunches an agent with,
+	// per agent; its placeholders are checked by tmux.ValidateResumeCommand
+	ResumeCommand map[string]string `json:"resume_command,omitempty"`
+	// VersionPattern lists extra regexes per agent for reading the running
+	// version from a process command line, tried in order; each must capture
+	// the version in its first group
+	VersionPattern map[string][]string `json:"version_pattern,omitempty"`
+	// CodexChannel is the npm dist-tag Codex updates are checked against,
+	// e.g. "next"; "latest" if unset
+	CodexChannel string `json:"codex_channel,omitempty"`
+	// ClaudePrerelease checks Claude Code updates against pre-releases too
+	ClaudePrerelease bool `json:"claude_prerelease,omitempty"`
+	// AgentColor sets the color agent names are shown in, per agent, e.g.
+	// {"codex": "green"}; "none" shows one uncolored
+	AgentColor map[string]string `json:"agent_color,omitempty"`
+	// HelperPattern lists extra regexes per agent for command lines of
+	// helper processes to leave out of the sessions, e.g. an editor's MCP
+	// bridge
+	HelperPattern map[string][]string `json:"helper_pattern,omitempty"`
+	// UnknownWork is what restart does with a session whose pane can't be
+	// captured to check for active work: "skip" (the default) or "proceed"
+	UnknownWork string `json:"unknown_work,omitempty"`
+}
+
+// DefaultPath returns $XDG_CONFIG_HOME/av/config.json, falling back to
+// ~/.config/av/config.json
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "av", "config.json")
+}
+
+// Load reads and parses the config file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s:\n%w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks every field and reports all problems at once, one per
+// line, each prefixed with the field it concerns (e.g. "bin.claude: ...")
+func (c *Config) Validate() error {
+	var errs []error
+	for _, agent := range sortedKeys(c.Bin) {
+		path := c.Bin[agent]
+		field := "bin." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			continue
+		}
+		if path == "" {
+			errs = append(errs, fmt.Errorf("%s: empty path", field))
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		} else if info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+			errs = append(errs, fmt.Errorf("%s: %s is not executable", field, path))
+		}
+	}
+	for _, agent := range sortedKeys(c.UpgradeCommand) {
+		field := "upgrade_command." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		} else if strings.TrimSpace(c.UpgradeCommand[agent]) == "" {
+			errs = append(errs, fmt.Errorf("%s: empty command", field))
+		}
+	}
+	for _, agent := range sortedKeys(c.MinVersion) {
+		field := "min_version." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		} else if !version.IsVersion(c.MinVersion[agent]) {
+			errs = append(errs, fmt.Errorf("%s: %q is not a version like 2.0.0", field, c.MinVersion[agent]))
+		}
+	}
+	for _, agent := range sortedKeys(c.ResumeCommand) {
+		field := "resume_command." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		} else if strings.TrimSpace(c.ResumeCommand[agent]) == "" {
+			errs = append(errs, fmt.Errorf("%s: empty command", field))
+		}
+	}
+	for _, agent := range sortedKeys(c.VersionPattern) {
+		field := "version_pattern." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			continue
+		}
+		for i, p := range c.VersionPattern[agent] {
+			if _, err := process.CompileVersionPattern(p); err != nil {
+				errs = append(errs, fmt.Errorf("%s[%d]: %w", field, i, err))
+			}
+		}
+	}
+	for _, agent := range sortedKeys(c.HelperPattern) {
+		field := "helper_pattern." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			continue
+		}
+		for i, p := range c.HelperPattern[agent] {
+			if _, err := regexp.Compile(p); err != nil {
+				errs = append(errs, fmt.Errorf("%s[%d]: %w", field, i, err))
+			}
+		}
+	}
+	for _, agent := range sortedKeys(c.AgentColor) {
+		field := "agent_color." + agent
+		if err := validateAgent(agent); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		} else if err := output.ValidateColor(c.AgentColor[agent]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+	if c.CodexChannel != "" {
+		if err := version.ValidateChannel(c.CodexChannel); err != nil {
+			errs = append(errs, fmt.Errorf("codex_channel: %w", err))
+		}
+	}
+	if c.UnknownWork != "" {
+		if err := ValidateUnknownWork(c.UnknownWork); err != nil {
+			errs = append(errs, fmt.Errorf("unknown_work: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// What to do with a session whose pane can't be captured, so it can't be
+// told whether it's busy: skip restarting it, as if it were, or proceed
+// as if it weren't
+const (
+	UnknownWorkSkip    = "skip"
+	UnknownWorkProceed = "proceed"
+)
+
+// ValidateUnknownWork checks that policy is UnknownWorkSkip or
+// UnknownWorkProceed
+func ValidateUnknownWork(policy string) error {
+	if policy != UnknownWorkSkip && policy != UnknownWorkProceed {
+		return fmt.Errorf("unknown policy %q (want %s or %s)", policy, UnknownWorkSkip, UnknownWorkProceed)
+	}
+	return nil
+}
+
+func validateAgent(agent string) error {
+	if slices.Contains(version.Agents, agent) {
+		return nil
+	}
+	return fmt.Errorf("unknown agent %q (want one of %s)", agent, strings.Join(version.Agents, ", "))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Save validates cfg and writes it to path, replacing any existing file
+// atomically
+func Save(path string, cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadDefault reads the config from DefaultPath. A missing file is not an
+// error and yields an empty config.
+func LoadDefault() (*Config, error) {
+	cfg, err := Load(DefaultPath())
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	return cfg, err
+}
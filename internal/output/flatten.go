@@ -0,0 +1,78 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Flatten writes v as its JSON encoding flattened into key=value lines, one
+// per leaf, with dotted paths for keys and array indexes, e.g.
+//
+//	installed.claude=2.1.14
+//	sessions.0.tmux_session=api
+//
+// in the order the JSON has them. Strings are quoted when they contain
+// spaces, quotes, = or anything unprintable, and null is left empty, as
+// logfmt has it. Empty objects and arrays have no leaves, so no lines.
+func Flatten(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return flattenValue(w, dec, "")
+}
+
+// flattenValue writes the next value dec reads, found at path
+func flattenValue(w io.Writer, dec *json.Decoder, path string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		for i := 0; dec.More(); i++ {
+			key := strconv.Itoa(i)
+			if t == '{' {
+				k, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key = k.(string)
+			}
+			if path != "" {
+				key = path + "." + key
+			}
+			if err := flattenValue(w, dec, key); err != nil {
+				return err
+			}
+		}
+		// The closing delimiter
+		_, err = dec.Token()
+		return err
+	case nil:
+		_, err = fmt.Fprintf(w, "%s=\n", path)
+	case string:
+		_, err = fmt.Fprintf(w, "%s=%s\n", path, logfmtValue(t))
+	default: // bool or json.Number
+		_, err = fmt.Fprintf(w, "%s=%v\n", path, t)
+	}
+	return err
+}
+
+// logfmtValue quotes s if it can't stand bare as a logfmt value
+func logfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if strings.ContainsAny(s, " =\"\\") || strings.ContainsFunc(s, func(r rune) bool { return !strconv.IsPrint(r) }) {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -3,12 +3,19 @@ package output
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/termcaps"
+	"github.com/buddyh/av/internal/version"
 )
 
 // Colors
@@ -22,6 +29,58 @@ const (
 	colorBold   = "\033[1m"
 )
 
+// Status symbols, shown with --symbols so status doesn't rely on color alone
+const (
+	symbolCurrent = "✓"
+	symbolUpdate  = "↑"
+	symbolUnknown = "?"
+	symbolRestart = "!"
+	symbolBelow   = "✗"
+)
+
+// colorNumbers maps the color names agent colors can be set to onto their
+// ANSI color numbers
+var colorNumbers = map[string]int{
+	"black":   0,
+	"red":     1,
+	"green":   2,
+	"yellow":  3,
+	"blue":    4,
+	"magenta": 5,
+	"cyan":    6,
+	"white":   7,
+	"gray":    8,
+}
+
+// defaultAgentColors are the colors agent names are shown in unless the
+// config says otherwise
+var defaultAgentColors = map[string]string{
+	"claude": "magenta",
+	"codex":  "cyan",
+	"gemini": "blue",
+}
+
+// ValidateColor checks name is a color agent names can be shown in, or
+// "none" for no color
+func ValidateColor(name string) error {
+	if _, ok := colorNumbers[name]; ok || name == "none" {
+		return nil
+	}
+	names := make([]string, 0, len(colorNumbers))
+	for n := range colorNumbers {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return fmt.Errorf("unknown color %q (want one of %s, or none)", name, strings.Join(names, ", "))
+}
+
+// asciiSymbols stand in for the non-ASCII status symbols with --ascii
+var asciiSymbols = map[string]string{
+	symbolCurrent: "+",
+	symbolUpdate:  "^",
+	symbolBelow:   "x",
+}
+
 // Output handles formatted output
 type Output struct {
 	stdout  io.Writer
@@ -29,21 +88,112 @@ type Output struct {
 	json    bool
 	plain   bool
 	noColor bool
+	symbols bool
+	// ascii keeps output to ASCII for terminals without Unicode support
+	ascii bool
+	// jsonIndent is how many spaces JSON is indented by; 0 prints it on
+	// one line
+	jsonIndent int
+	// flatten prints JSON as flat key=value lines instead
+	flatten bool
+	// agentColors holds the color each agent's name is shown in, by agent
+	agentColors map[string]string
 }
 
 // New creates a new Output
 func New(stdout, stderr io.Writer) *Output {
 	return &Output{
-		stdout: stdout,
-		stderr: stderr,
+		stdout:      stdout,
+		stderr:      stderr,
+		jsonIndent:  2,
+		agentColors: defaultAgentColors,
 	}
 }
 
-// Configure sets output options
-func (o *Output) Configure(jsonOut, plain, noColor bool) {
+// Configure sets output options. Colors and non-ASCII glyphs are also left
+// out when termcaps finds the terminal can't show them.
+func (o *Output) Configure(jsonOut, plain, noColor, symbols, ascii bool) {
+	caps := termcaps.Detect()
 	o.json = jsonOut
 	o.plain = plain
-	o.noColor = noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb"
+	o.noColor = noColor || caps.Colors == termcaps.ColorNone
+	o.symbols = symbols
+	o.ascii = ascii || !caps.Unicode
+}
+
+// SetJSONIndent sets how many spaces JSON is indented by (2 by default); 0
+// prints each document on a single line, for piping, storage and CI logs
+func (o *Output) SetJSONIndent(width int) {
+	o.jsonIndent = width
+}
+
+// SetFlatten makes JSON print each document as flat key=value lines, as
+// Flatten does, for logfmt-style consumers and grep
+func (o *Output) SetFlatten(on bool) {
+	o.flatten = on
+}
+
+// SetAgentColors sets the colors agent names are shown in, by agent, over
+// the defaults
+func (o *Output) SetAgentColors(colors map[string]string) {
+	o.agentColors = maps.Clone(defaultAgentColors)
+	maps.Copy(o.agentColors, colors)
+}
+
+// AgentColors returns the ANSI color number each agent's name is shown in,
+// by agent, leaving out agents shown without color. It is empty with
+// --no-color or --plain.
+func (o *Output) AgentColors() map[string]string {
+	colors := make(map[string]string)
+	if o.noColor || o.plain {
+		return colors
+	}
+	for agent, name := range o.agentColors {
+		if n, ok := colorNumbers[name]; ok {
+			colors[agent] = strconv.Itoa(n)
+		}
+	}
+	return colors
+}
+
+// agent returns an agent's name, padded to width, in the agent's color
+func (o *Output) agent(agent string, width int) string {
+	padded := fmt.Sprintf("%-*s", width, agent)
+	n, ok := colorNumbers[o.agentColors[agent]]
+	if !ok {
+		return padded
+	}
+	if n >= 8 {
+		return o.color(fmt.Sprintf("\033[%dm", 90+n-8), padded)
+	}
+	return o.color(fmt.Sprintf("\033[%dm", 30+n), padded)
+}
+
+// SetStdout redirects primary output (e.g. to a file); errors and
+// warnings stay on stderr
+func (o *Output) SetStdout(w io.Writer) {
+	o.stdout = w
+}
+
+// Printf writes formatted text to the primary output
+func (o *Output) Printf(format string, args ...any) {
+	fmt.Fprintf(o.stdout, format, args...)
+}
+
+// Println writes a line to the primary output
+func (o *Output) Println(args ...any) {
+	fmt.Fprintln(o.stdout, args...)
+}
+
+// sym prefixes s with a status symbol when symbols are enabled
+func (o *Output) sym(symbol, s string) string {
+	if !o.symbols {
+		return s
+	}
+	if a, ok := asciiSymbols[symbol]; ok && o.ascii {
+		symbol = a
+	}
+	return symbol + " " + s
 }
 
 func (o *Output) color(c, s string) string {
@@ -55,8 +205,13 @@ func (o *Output) color(c, s string) string {
 
 // JSON outputs data as JSON
 func (o *Output) JSON(v any) error {
+	if o.flatten {
+		return Flatten(o.stdout, v)
+	}
 	enc := json.NewEncoder(o.stdout)
-	enc.SetIndent("", "  ")
+	if o.jsonIndent > 0 {
+		enc.SetIndent("", strings.Repeat(" ", o.jsonIndent))
+	}
 	return enc.Encode(v)
 }
 
@@ -96,6 +251,32 @@ func (o *Output) Success(msg string) {
 	fmt.Fprintf(o.stdout, "%s %s\n", prefix, msg)
 }
 
+// Timing is the wall-clock time one phase of a command took
+type Timing struct {
+	Phase    string
+	Duration time.Duration
+}
+
+// PrintProfile prints a per-phase timing breakdown to stderr
+func (o *Output) PrintProfile(timings []Timing) {
+	var total time.Duration
+	fmt.Fprintln(o.stderr, o.color(colorBold, "Profile"))
+	for _, t := range timings {
+		total += t.Duration
+		fmt.Fprintf(o.stderr, "  %-22s %10s\n", t.Phase, t.Duration.Round(time.Microsecond))
+	}
+	fmt.Fprintf(o.stderr, "  %-22s %10s\n", "total", total.Round(time.Microsecond))
+}
+
+// ClearScreen clears the terminal before a redraw (no-op for JSON/plain,
+// and when output goes to a file or pipe rather than a terminal)
+func (o *Output) ClearScreen() {
+	if o.json || o.plain || !termcaps.IsTerminal(o.stdout) {
+		return
+	}
+	fmt.Fprint(o.stdout, "\033[H\033[2J")
+}
+
 // PrintHeader prints a section header
 func (o *Output) PrintHeader(title string) {
 	if o.plain {
@@ -105,68 +286,210 @@ func (o *Output) PrintHeader(title string) {
 	}
 }
 
-// PrintVersion prints version info with update status
-func (o *Output) PrintVersion(name, installed, latest string) {
-	if installed == "" {
+// PrintNote prints a dimmed, indented note line
+func (o *Output) PrintNote(msg string) {
+	if o.plain {
+		fmt.Fprintf(o.stdout, "  (%s)\n", msg)
+	} else {
+		fmt.Fprintf(o.stdout, "  %s\n", o.color(colorGray, msg))
+	}
+}
+
+// PrintFetched prints how fresh the latest-version data is
+func (o *Output) PrintFetched(at time.Time, cached bool) {
+	msg := "latest checked " + relativeTime(time.Since(at))
+	if cached {
+		msg += ", cached"
+	}
+	o.PrintNote(msg)
+}
+
+// relativeTime renders an age like "just now" or "5 minutes ago"
+func relativeTime(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int(d/(24*time.Hour)), "day")
+	}
+}
+
+// PrintVersion prints version info with update status. A non-empty method
+// notes how the agent was installed, a non-empty minimum flags an install
+// older than it, and fetchErr says why latest is missing.
+func (o *Output) PrintVersion(name, installed, method, latest, minimum string, installErr, fetchErr error) {
+	belowMin := installErr == nil && version.BelowMinimum(installed, minimum)
+
+	if installErr != nil || installed == "" {
 		installed = "not installed"
+		if installErr != nil && !errors.Is(installErr, version.ErrNotInstalled) {
+			installed = "installed, version unknown"
+		}
 	}
 
 	var status string
-	if latest == "" {
-		status = o.color(colorGray, "(couldn't fetch latest)")
+	if belowMin {
+		if o.plain {
+			status = fmt.Sprintf("[%s]", o.sym(symbolBelow, "below minimum: "+minimum))
+		} else {
+			status = o.color(colorRed, o.sym(symbolBelow, "below minimum "+minimum))
+		}
+	} else if latest == "" {
+		status = o.color(colorGray, o.sym(symbolUnknown, "(couldn't fetch latest"+fetchReason(fetchErr)+")"))
 	} else if installed == latest {
 		if o.plain {
-			status = "[current]"
+			status = "[" + o.sym(symbolCurrent, "current") + "]"
 		} else {
-			status = o.color(colorGreen, "current")
+			status = o.color(colorGreen, o.sym(symbolCurrent, "current"))
 		}
-	} else if installed == "not installed" {
+	} else if installErr != nil || installed == "not installed" {
 		status = ""
 	} else {
 		if o.plain {
-			status = fmt.Sprintf("[update: %s]", latest)
+			status = fmt.Sprintf("[%s]", o.sym(symbolUpdate, "update: "+latest))
 		} else {
-			status = o.color(colorYellow, fmt.Sprintf("update available: %s", latest))
+			status = o.color(colorYellow, o.sym(symbolUpdate, "update available: "+latest))
 		}
 	}
 
+	if method != "" && installErr == nil {
+		installed += " " + o.color(colorGray, "(via "+method+")")
+	}
 	fmt.Fprintf(o.stdout, "  %-14s %s  %s\n", name, installed, status)
 }
 
-// PrintSessions prints the sessions table and returns count needing restart
-func (o *Output) PrintSessions(sessions []*process.Session, claudeInstalled, codexInstalled string) int {
-	if len(sessions) == 0 {
-		fmt.Fprintln(o.stdout, "  No agent sessions running")
-		return 0
+// fetchReason says briefly why fetching the latest version failed, e.g.
+// ": network error", or nothing if that isn't known
+func fetchReason(err error) string {
+	switch {
+	case errors.Is(err, version.ErrNetwork):
+		return ": network error"
+	case errors.Is(err, version.ErrBadStatus):
+		return ": HTTP error"
+	case errors.Is(err, version.ErrBadResponse):
+		return ": unparseable response"
+	case errors.Is(err, version.ErrOffline):
+		return ": offline"
+	default:
+		return ""
+	}
+}
+
+// PrintLocalVersions prints locally installed versions, marking the active one
+func (o *Output) PrintLocalVersions(versions []version.LocalVersion) {
+	if len(versions) == 0 {
+		o.PrintNote("not installed")
+		return
+	}
+
+	for _, v := range versions {
+		marker := " "
+		name := fmt.Sprintf("%-12s", v.Version)
+		if v.Active {
+			marker = "*"
+			name = o.color(colorGreen, name)
+		}
+		installed := "-"
+		if !v.InstalledAt.IsZero() {
+			installed = v.InstalledAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(o.stdout, "  %s %s %-16s  %s\n", marker, name, installed, shortenPath(v.Path))
 	}
+}
 
-	// Count by agent
-	claudeCount := 0
-	codexCount := 0
+// PrintSessionCounts prints how many sessions each agent has
+func (o *Output) PrintSessionCounts(sessions []*process.Session) {
+	counts := make(map[string]int)
 	for _, s := range sessions {
-		if s.Agent == "claude" {
-			claudeCount++
-		} else {
-			codexCount++
+		counts[s.Agent]++
+	}
+	var found []string
+	for _, agent := range version.Agents {
+		found = append(found, fmt.Sprintf("%d %s", counts[agent], agent))
+	}
+
+	fmt.Fprintf(o.stdout, "  Found %s session(s)\n", strings.Join(found, ", "))
+}
+
+// PrintTotals prints a line totting up sessions, e.g. "12 sessions, 4
+// outdated, 2 busy, 3 claude / 9 codex", given how many are outdated and
+// busy. Agents without sessions are left out.
+func (o *Output) PrintTotals(sessions []*process.Session, outdated, busy int) {
+	counts := make(map[string]int)
+	for _, s := range sessions {
+		counts[s.Agent]++
+	}
+	var agents []string
+	for _, agent := range version.Agents {
+		if counts[agent] > 0 {
+			agents = append(agents, fmt.Sprintf("%d %s", counts[agent], agent))
 		}
 	}
 
-	fmt.Fprintf(o.stdout, "  Found %d claude, %d codex session(s)\n\n", claudeCount, codexCount)
+	line := fmt.Sprintf("%d session(s), %d outdated, %d busy", len(sessions), outdated, busy)
+	if len(agents) > 0 {
+		line += ", " + strings.Join(agents, " / ")
+	}
+	fmt.Fprintf(o.stdout, "  %s\n", line)
+}
+
+// SessionOptions are the optional extras in the sessions table
+type SessionOptions struct {
+	// History notes in each status how long the session has been outdated
+	// and how often it's been restarted
+	History bool
+	// Model adds a column with the model each session uses
+	Model bool
+	// Changed marks the rows of these sessions, e.g. ones that changed
+	// since watch last refreshed
+	Changed map[*process.Session]bool
+}
+
+// PrintSessions prints the sessions table and returns count needing restart.
+// Sessions running a version below their agent's entry in minimums are
+// flagged as such.
+func (o *Output) PrintSessions(sessions []*process.Session, installed, minimums map[string]string, opts SessionOptions) int {
+	if len(sessions) == 0 {
+		fmt.Fprintln(o.stdout, "  No agent sessions running")
+		return 0
+	}
+
+	o.PrintSessionCounts(sessions)
+	fmt.Fprintln(o.stdout)
+
+	// The label column only appears once some session has one
+	labels := slices.ContainsFunc(sessions, func(s *process.Session) bool { return s.UserLabel != "" })
 
 	// Header
+	header := fmt.Sprintf("%-22s %-*s %-40s %-10s ", "SESSION", agentWidth, "AGENT", "PATH", "VERSION")
+	if opts.Model {
+		header += fmt.Sprintf("%-*s ", modelWidth, "MODEL")
+	}
+	if labels {
+		header += fmt.Sprintf("%-*s ", labelWidth, "LABEL")
+	}
+	header += "STATUS"
 	if o.plain {
-		fmt.Fprintf(o.stdout, "  %-22s %-40s %-10s %s\n", "SESSION", "PATH", "VERSION", "STATUS")
+		fmt.Fprintf(o.stdout, "  %s\n", header)
 	} else {
-		fmt.Fprintf(o.stdout, "  %s\n", o.color(colorGray, fmt.Sprintf("%-22s %-40s %-10s %s", "SESSION", "PATH", "VERSION", "STATUS")))
+		fmt.Fprintf(o.stdout, "  %s\n", o.color(colorGray, header))
 	}
 
 	needsRestart := 0
 
 	for _, s := range sessions {
-		session := s.TmuxSession
-		if session == "" {
-			session = fmt.Sprintf("pid:%d", s.PID)
-		}
+		session := s.Label()
 
 		path := shortenPath(s.WorkingDir)
 		if path == "" {
@@ -179,37 +502,69 @@ func (o *Output) PrintSessions(sessions []*process.Session, claudeInstalled, cod
 		}
 
 		// Determine status
-		currentVersion := claudeInstalled
-		if s.Agent == "codex" {
-			currentVersion = codexInstalled
+		sessionStatus, _ := s.Status(installed, minimums)
+		if sessionStatus == process.StatusOutdated || sessionStatus == process.StatusBelowMinimum && s.Outdated(installed) {
+			needsRestart++
 		}
 
 		var status string
-		if version == currentVersion {
+		switch sessionStatus {
+		case process.StatusBelowMinimum:
 			if o.plain {
-				status = "[current]"
+				status = "[" + o.sym(symbolBelow, "below minimum") + "]"
 			} else {
-				status = o.color(colorGreen, "current")
+				status = o.color(colorRed, o.sym(symbolBelow, "below minimum"))
 			}
-		} else if version == "?" {
+		case process.StatusCurrent:
 			if o.plain {
-				status = "[unknown]"
+				status = "[" + o.sym(symbolCurrent, "current") + "]"
 			} else {
-				status = o.color(colorGray, "unknown")
+				status = o.color(colorGreen, o.sym(symbolCurrent, "current"))
 			}
-		} else {
-			needsRestart++
+		case process.StatusUnknown:
+			if o.plain {
+				status = "[" + o.sym(symbolUnknown, "unknown") + "]"
+			} else {
+				status = o.color(colorGray, o.sym(symbolUnknown, "unknown"))
+			}
+		default:
 			if s.TmuxSession == "" {
 				if o.plain {
-					status = "[outdated, no tmux]"
+					status = "[" + o.sym(symbolRestart, "outdated, no tmux") + "]"
 				} else {
-					status = o.color(colorYellow, "outdated") + o.color(colorGray, " (no tmux)")
+					status = o.color(colorYellow, o.sym(symbolRestart, "outdated")) + o.color(colorGray, " (no tmux)")
 				}
 			} else {
 				if o.plain {
-					status = "[restart needed]"
+					status = "[" + o.sym(symbolRestart, "restart needed") + "]"
 				} else {
-					status = o.color(colorYellow, "restart needed")
+					status = o.color(colorYellow, o.sym(symbolRestart, "restart needed"))
+				}
+			}
+		}
+
+		if s.Attached {
+			if o.plain {
+				status += " [attached]"
+			} else {
+				status += o.color(colorGray, " (attached)")
+			}
+		}
+
+		if s.WorkingDirMissing {
+			if o.plain {
+				status += " [path missing]"
+			} else {
+				status += o.color(colorGray, " (path missing)")
+			}
+		}
+
+		if opts.History {
+			if h := sessionHistory(s); h != "" {
+				if o.plain {
+					status += " [" + h + "]"
+				} else {
+					status += o.color(colorGray, " ("+h+")")
 				}
 			}
 		}
@@ -219,12 +574,73 @@ func (o *Output) PrintSessions(sessions []*process.Session, claudeInstalled, cod
 			path = "..." + path[len(path)-35:]
 		}
 
-		fmt.Fprintf(o.stdout, "  %-22s %-40s %-10s %s\n", session, path, version, status)
+		marker := " "
+		if opts.Changed[s] {
+			marker = o.color(colorYellow, "*")
+		}
+		if labels {
+			label := s.UserLabel
+			if label == "" {
+				label = "-"
+			} else if len(label) > labelWidth {
+				label = label[:labelWidth-3] + "..."
+			}
+			status = fmt.Sprintf("%-*s %s", labelWidth, label, status)
+		}
+		if opts.Model {
+			model := s.Model
+			if model == "" {
+				model = "-"
+			} else if len(model) > modelWidth {
+				model = model[:modelWidth-3] + "..."
+			}
+			status = fmt.Sprintf("%-*s %s", modelWidth, model, status)
+		}
+		if s.VersionRestricted {
+			version = "restricted"
+		}
+		fmt.Fprintf(o.stdout, " %s%-22s %s %-40s %-10s %s\n", marker, session, o.agent(s.Agent, agentWidth), path, version, status)
 	}
 
 	return needsRestart
 }
 
+// agentWidth is the width of the sessions table's agent column, the same
+// as the restart picker's
+const agentWidth = version.AgentWidth
+
+// modelWidth is the width of the sessions table's model column, enough for
+// a dated model ID like claude-sonnet-4-5-20250929
+const modelWidth = 26
+
+// labelWidth is the width of the sessions table's label column
+const labelWidth = 20
+
+// sessionHistory describes what earlier runs saw of a session, e.g.
+// "outdated for 3d, restarted 2x"
+func sessionHistory(s *process.Session) string {
+	var parts []string
+	if !s.OutdatedSince.IsZero() {
+		parts = append(parts, "outdated for "+shortDuration(time.Since(s.OutdatedSince)))
+	}
+	if s.Restarts > 0 {
+		parts = append(parts, fmt.Sprintf("restarted %dx", s.Restarts))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// shortDuration formats d in its largest whole unit: 45m, 5h, 3d
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+}
+
 func shortenPath(path string) string {
 	if path == "" {
 		return ""
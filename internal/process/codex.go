@@ -0,0 +1,195 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Codex records each conversation as a "rollout" in its home dir
+// ($CODEX_HOME, or ~/.codex):
+//
+//	sessions/YYYY/MM/DD/rollout-YYYY-MM-DDThh-mm-ss-<id>.jsonl
+//
+// dated by when the conversation started, and appended to as it goes. The
+// first line is a session_meta record with the conversation's id and the
+// working dir it started in:
+//
+//	{"type":"session_meta","payload":{"id":"<id>","cwd":"/path/to/repo",...}}
+//
+// Older releases wrote the id at the top level and no cwd. `codex resume
+// <id>` picks a conversation back up.
+
+// rolloutRegex matches a rollout file name, capturing its conversation ID
+var rolloutRegex = regexp.MustCompile(`^rollout-.*-([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\.jsonl$`)
+
+// codexHome returns the dir Codex keeps its config and sessions in, or ""
+// if there's no home dir to put it in
+func codexHome() string {
+	if dir := os.Getenv("CODEX_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".codex")
+}
+
+// CodexConversationIDContext returns the ID of the conversation a local
+// codex session is in, so a restart can resume exactly that one. It checks,
+// in order:
+//
+//  1. `codex resume <id>` on the command line
+//  2. files the process has open, which include its rollout
+//  3. the most recently written rollout started in the session's working dir
+//
+// The last is only a guess when several sessions share a directory. It
+// returns "" if nothing matches.
+func CodexConversationIDContext(ctx context.Context, s *Session) string {
+	if s.Agent != "codex" || s.Host != "" {
+		return ""
+	}
+	if id := codexConversationFromArgs(s.Command); id != "" {
+		return id
+	}
+	for _, path := range openFiles(ctx, s.PID, true) {
+		if m := rolloutRegex.FindStringSubmatch(filepath.Base(path)); m != nil {
+			return m[1]
+		}
+	}
+	if s.WorkingDirMissing {
+		return ""
+	}
+	return newestRollout(s.WorkingDir)
+}
+
+// codexConversationFromArgs finds an ID given as `codex resume <id>`
+func codexConversationFromArgs(command string) string {
+	words := strings.Fields(command)
+	for i, w := range words {
+		if w != "resume" {
+			continue
+		}
+		for _, arg := range words[i+1:] {
+			if uuidRegex.MatchString(arg) {
+				return arg
+			}
+		}
+	}
+	return ""
+}
+
+// codexRollout returns the path of the rollout for conversation id, or ""
+// if there isn't one
+func codexRollout(id string) string {
+	home := codexHome()
+	if home == "" {
+		return ""
+	}
+	matches, _ := filepath.Glob(filepath.Join(home, "sessions", "*", "*", "*", "rollout-*-"+id+".jsonl"))
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
+
+// newestRollout returns the ID of the most recently written rollout that
+// started in workingDir. Date dirs are searched newest first, stopping at
+// the first that has one, so a long history isn't read on every lookup.
+func newestRollout(workingDir string) string {
+	home := codexHome()
+	if home == "" || workingDir == "" {
+		return ""
+	}
+	for _, year := range reverseDirs(filepath.Join(home, "sessions")) {
+		for _, month := range reverseDirs(year) {
+			for _, day := range reverseDirs(month) {
+				if id := newestRolloutIn(day, workingDir); id != "" {
+					return id
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// newestRolloutIn returns the ID of the most recently written rollout in
+// the date dir day that started in workingDir
+func newestRolloutIn(day, workingDir string) string {
+	entries, _ := os.ReadDir(day)
+	var newest string
+	var newestMod int64
+	for _, e := range entries {
+		m := rolloutRegex.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().UnixNano() <= newestMod {
+			continue
+		}
+		if sameDir(rolloutCwd(filepath.Join(day, e.Name())), workingDir) {
+			newest, newestMod = m[1], info.ModTime().UnixNano()
+		}
+	}
+	return newest
+}
+
+// reverseDirs returns the paths of the subdirs of dir, in reverse name order
+func reverseDirs(dir string) []string {
+	entries, _ := os.ReadDir(dir) // Sorted by name
+	var dirs []string
+	for _, e := range slices.Backward(entries) {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, e.Name()))
+		}
+	}
+	return dirs
+}
+
+// rolloutCwd returns the working dir a rollout's conversation started in,
+// from its session_meta line, or "" for older rollouts without one
+func rolloutCwd(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// The first line carries the base instructions, which can be long
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	if !scanner.Scan() {
+		return ""
+	}
+	var meta struct {
+		Type    string `json:"type"`
+		Payload struct {
+			Cwd string `json:"cwd"`
+		} `json:"payload"`
+	}
+	if json.Unmarshal(scanner.Bytes(), &meta) != nil || meta.Type != "session_meta" {
+		return ""
+	}
+	return meta.Payload.Cwd
+}
+
+// sameDir reports whether a and b are the same directory, as given or
+// with symlinks resolved
+func sameDir(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ra, erra := filepath.EvalSymlinks(a)
+	rb, errb := filepath.EvalSymlinks(b)
+	return erra == nil && errb == nil && ra == rb
+}
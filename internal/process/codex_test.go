@@ -0,0 +1,79 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeRollout writes a rollout for conversation id, started on day
+// (YYYY/MM/DD) in cwd, last written at mod
+func writeRollout(t *testing.T, home, day, id, cwd string, mod time.Time) string {
+	t.Helper()
+	dir := filepath.Join(home, "sessions", filepath.FromSlash(day))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rollout-2026-01-02T10-00-00-"+id+".jsonl")
+	meta := fmt.Sprintf(`{"type":"session_meta","payload":{"id":%q,"cwd":%q}}`, id, cwd)
+	if cwd == "" {
+		meta = fmt.Sprintf(`{"id":%q}`, id) // Older releases wrote no cwd
+	}
+	writeFile(t, path, meta+"\n")
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCodexConversationID(t *testing.T) {
+	const (
+		old       = "0199a000-0000-7000-8000-000000000001"
+		lastWeek  = "0199a000-0000-7000-8000-000000000002"
+		today     = "0199a000-0000-7000-8000-000000000003"
+		todayToo  = "0199a000-0000-7000-8000-000000000004"
+		elsewhere = "0199a000-0000-7000-8000-000000000005"
+		legacy    = "0199a000-0000-7000-8000-000000000006"
+	)
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	repo, other, lone := t.TempDir(), t.TempDir(), t.TempDir()
+
+	now := time.Now()
+	writeRollout(t, home, "2025/12/31", old, other, now.Add(-time.Hour))
+	writeRollout(t, home, "2026/01/02", lastWeek, repo, now) // Still being written
+	writeRollout(t, home, "2026/01/09", today, repo, now.Add(-2*time.Hour))
+	writeRollout(t, home, "2026/01/09", todayToo, repo, now.Add(-time.Hour))
+	writeRollout(t, home, "2026/01/09", elsewhere, other, now)
+	writeRollout(t, home, "2026/01/09", legacy, "", now)
+
+	missingPID := 1 << 30
+	tests := []struct {
+		name string
+		s    Session
+		want string
+	}{
+		{"codex resume", Session{Agent: "codex", PID: missingPID, WorkingDir: repo, Command: "codex resume " + old}, old},
+		{"newest in the newest day", Session{Agent: "codex", PID: missingPID, WorkingDir: repo}, todayToo},
+		{"an older day", Session{Agent: "codex", PID: missingPID, WorkingDir: other}, elsewhere},
+		{"none started there", Session{Agent: "codex", PID: missingPID, WorkingDir: lone}, ""},
+		{"deleted dir", Session{Agent: "codex", PID: missingPID, WorkingDir: repo, WorkingDirMissing: true}, ""},
+		{"remote", Session{Agent: "codex", PID: missingPID, WorkingDir: repo, Host: "dev@box"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodexConversationIDContext(t.Context(), &tt.s); got != tt.want {
+				t.Errorf("CodexConversationIDContext = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if !TranscriptExists(&Session{Agent: "codex", ConversationID: lastWeek}) {
+		t.Errorf("TranscriptExists(%s) = false, want true", lastWeek)
+	}
+	if TranscriptExists(&Session{Agent: "codex", ConversationID: "0199a000-0000-7000-8000-00000000ffff"}) {
+		t.Error("TranscriptExists of an unknown conversation = true, want false")
+	}
+}
@@ -0,0 +1,243 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// uuidRegex matches a Claude conversation ID
+var uuidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ConversationIDContext returns the ID of the conversation a local session
+// is in, for the agents av can resume by ID (Claude and Codex), or ""
+func ConversationIDContext(ctx context.Context, s *Session) string {
+	switch s.Agent {
+	case "claude":
+		return ClaudeConversationIDContext(ctx, s)
+	case "codex":
+		return CodexConversationIDContext(ctx, s)
+	default:
+		return ""
+	}
+}
+
+// ClaudeConversationID returns the ID of the conversation a local claude
+// session is in, so a restart can resume exactly that one. It checks, in
+// order:
+//
+//  1. --resume/--session-id on the command line
+//  2. files the process has open, which include per-conversation paths
+//  3. the most recently written transcript for the session's working dir
+//
+// The last is only a guess when several sessions share a directory. It
+// returns "" if nothing matches.
+func ClaudeConversationID(s *Session) string {
+	return ClaudeConversationIDContext(context.Background(), s)
+}
+
+// ClaudeConversationIDContext is ClaudeConversationID, giving up on lsof
+// when ctx is done
+func ClaudeConversationIDContext(ctx context.Context, s *Session) string {
+	if s.Agent != "claude" || s.Host != "" {
+		return ""
+	}
+	if id := conversationFromArgs(s.Command); id != "" {
+		return id
+	}
+
+	// A deleted working dir can't be mapped reliably to its project dir, so
+	// open transcripts are taken on trust and the newest one isn't guessed
+	projectDir := ""
+	if !s.WorkingDirMissing {
+		projectDir = claudeProjectDir(s.WorkingDir)
+	}
+	if id := openConversation(ctx, s.PID, projectDir, true); id != "" {
+		return id
+	}
+	return newestTranscript(projectDir)
+}
+
+// openConversation returns the ID of the Claude transcript process pid has
+// open, checked against projectDir when there is one, or "". useLsof says
+// whether to run lsof where there's no /proc to read.
+func openConversation(ctx context.Context, pid int, projectDir string, useLsof bool) string {
+	for _, path := range openFiles(ctx, pid, useLsof) {
+		if id := conversationFromPath(path); id != "" && transcriptExists(projectDir, id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// conversationFromArgs finds an ID given with --resume, -r or --session-id
+func conversationFromArgs(command string) string {
+	words := strings.Fields(command)
+	for i, w := range words {
+		name, value, hasValue := strings.Cut(w, "=")
+		if name != "--resume" && name != "-r" && name != "--session-id" {
+			continue
+		}
+		if !hasValue && i+1 < len(words) {
+			value = words[i+1]
+		}
+		if uuidRegex.MatchString(value) {
+			return value
+		}
+	}
+	return ""
+}
+
+// conversationFromPath finds a conversation ID in a path Claude keeps open,
+// like /tmp/claude-0/-root-repo/<id>/tasks or .../projects/-root-repo/<id>.jsonl
+func conversationFromPath(path string) string {
+	if !strings.Contains(path, "claude") {
+		return ""
+	}
+	for _, part := range strings.Split(path, string(filepath.Separator)) {
+		part = strings.TrimSuffix(part, ".jsonl")
+		if uuidRegex.MatchString(part) {
+			return part
+		}
+	}
+	return ""
+}
+
+// nonAlnumRegex matches what Claude replaces with - in project dir names
+var nonAlnumRegex = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+// claudeProjectDir returns where Claude keeps transcripts for a working dir,
+// ~/.claude/projects/<encoded dir>, or "" if there's no such directory.
+// Claude encodes the path by replacing every character other than a letter
+// or digit with -, so /Users/me/my.app_v2 becomes -Users-me-my-app-v2;
+// older releases only replaced / and . (keeping _). The encoding is lossy,
+// so rather than trusting one spelling we try both, for the path as given
+// and with symlinks resolved, then fall back to scanning the projects dir
+// for a name that matches ignoring case.
+func claudeProjectDir(workingDir string) string {
+	if workingDir == "" {
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	root := filepath.Join(home, ".claude", "projects")
+
+	dirs := []string{workingDir}
+	if resolved, err := filepath.EvalSymlinks(workingDir); err == nil && resolved != workingDir {
+		dirs = append(dirs, resolved)
+	}
+
+	var names []string
+	for _, dir := range dirs {
+		names = append(names,
+			nonAlnumRegex.ReplaceAllString(dir, "-"),
+			strings.NewReplacer("/", "-", ".", "-").Replace(dir))
+	}
+	for _, name := range names {
+		if info, err := os.Stat(filepath.Join(root, name)); err == nil && info.IsDir() {
+			return filepath.Join(root, name)
+		}
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		entry := nonAlnumRegex.ReplaceAllString(e.Name(), "-")
+		for _, name := range names {
+			if strings.EqualFold(entry, nonAlnumRegex.ReplaceAllString(name, "-")) {
+				return filepath.Join(root, e.Name())
+			}
+		}
+	}
+	return ""
+}
+
+// transcriptExists reports whether id has a transcript to resume. Without a
+// project dir to check, any ID is taken on trust.
+func transcriptExists(projectDir, id string) bool {
+	if projectDir == "" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(projectDir, id+".jsonl"))
+	return err == nil
+}
+
+// TranscriptExists reports whether the session's conversation still has a
+// transcript (for Codex, a rollout) on disk to resume
+func TranscriptExists(s *Session) bool {
+	if s.Agent == "codex" {
+		return s.ConversationID != "" && codexRollout(s.ConversationID) != ""
+	}
+	projectDir := claudeProjectDir(s.WorkingDir)
+	return s.ConversationID != "" && projectDir != "" && transcriptExists(projectDir, s.ConversationID)
+}
+
+// newestTranscript returns the ID of the most recently modified transcript
+// in projectDir
+func newestTranscript(projectDir string) string {
+	if projectDir == "" {
+		return ""
+	}
+	matches, _ := filepath.Glob(filepath.Join(projectDir, "*.jsonl"))
+	var newest string
+	var newestMod int64
+	for _, m := range matches {
+		id := strings.TrimSuffix(filepath.Base(m), ".jsonl")
+		info, err := os.Stat(m)
+		if err != nil || !uuidRegex.MatchString(id) {
+			continue
+		}
+		if mod := info.ModTime().UnixNano(); mod > newestMod {
+			newest, newestMod = id, mod
+		}
+	}
+	return newest
+}
+
+// openFiles lists the paths a process has open: from /proc on Linux, from
+// lsof elsewhere if useLsof is set
+func openFiles(ctx context.Context, pid int, useLsof bool) []string {
+	if runtime.GOOS == "linux" {
+		dir := fmt.Sprintf("/proc/%d/fd", pid)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil
+		}
+		var paths []string
+		for _, e := range entries {
+			if target, err := os.Readlink(filepath.Join(dir, e.Name())); err == nil {
+				paths = append(paths, target)
+			}
+		}
+		return paths
+	}
+	if !useLsof {
+		return nil
+	}
+
+	out, err := runner.Local.Output(ctx, "lsof", "-p", strconv.Itoa(pid), "-Fn")
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "n") {
+			paths = append(paths, line[1:])
+		}
+	}
+	return paths
+}
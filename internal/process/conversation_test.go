@@ -0,0 +1,125 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a fixture file, failing the test if it can't
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// claudeProject makes a fake ~/.claude/projects/<name> under a temporary
+// HOME and returns its path
+func claudeProject(t *testing.T, name string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".claude", "projects", name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestClaudeConversationIDSeveralSessions(t *testing.T) {
+	const (
+		open    = "11111111-1111-4111-8111-111111111111"
+		resumed = "22222222-2222-4222-8222-222222222222"
+		newest  = "33333333-3333-4333-8333-333333333333"
+	)
+	repo := filepath.Join(t.TempDir(), "repo")
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	project := claudeProject(t, nonAlnumRegex.ReplaceAllString(repo, "-"))
+	now := time.Now()
+	for i, id := range []string{open, resumed, newest} {
+		path := filepath.Join(project, id+".jsonl")
+		writeFile(t, path, "{}\n")
+		mod := now.Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// This process stands in for a session with its transcript open
+	f, err := os.Open(filepath.Join(project, open+".jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	missingPID := 1 << 30
+	tests := []struct {
+		name string
+		s    Session
+		want string
+	}{
+		{"open transcript", Session{Agent: "claude", PID: os.Getpid(), WorkingDir: repo}, open},
+		{"--resume", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, Command: "claude --resume " + resumed}, resumed},
+		{"--session-id=", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, Command: "claude --session-id=" + resumed}, resumed},
+		{"newest", Session{Agent: "claude", PID: missingPID, WorkingDir: repo}, newest},
+		{"deleted dir", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, WorkingDirMissing: true}, ""},
+		{"remote", Session{Agent: "claude", PID: os.Getpid(), WorkingDir: repo, Host: "dev@box"}, ""},
+		{"codex", Session{Agent: "codex", PID: os.Getpid(), WorkingDir: repo}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClaudeConversationID(&tt.s); got != tt.want {
+				t.Errorf("ClaudeConversationID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaudeProjectDir(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "my.app_v2")
+	link := filepath.Join(base, "link")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	encoded := nonAlnumRegex.ReplaceAllString(dir, "-")
+
+	tests := []struct {
+		name, project, workingDir string
+		want                      bool
+	}{
+		{"current encoding", encoded, dir, true},
+		{"older encoding keeps _", strings.NewReplacer("/", "-", ".", "-").Replace(dir), dir, true},
+		{"through a symlink", encoded, link, true},
+		{"different case", strings.ToLower(encoded), dir, true},
+		{"other project", "-somewhere-else", dir, false},
+		{"no working dir", encoded, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := claudeProject(t, tt.project)
+			want := ""
+			if tt.want {
+				want = project
+			}
+			if got := claudeProjectDir(tt.workingDir); got != want {
+				t.Errorf("claudeProjectDir(%q) = %q, want %q", tt.workingDir, got, want)
+			}
+		})
+	}
+
+	t.Run("no projects dir", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		if got := claudeProjectDir(dir); got != "" {
+			t.Errorf("claudeProjectDir(%q) = %q, want \"\"", dir, got)
+		}
+	})
+}
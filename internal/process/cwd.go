@@ -0,0 +1,150 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// lsofCache remembers cwd lookups by PID for lsofCacheTTL, since lsof is
+// expensive. Entries expire so a long-running watch or daemon doesn't give
+// a reused PID the cwd of the process it used to be.
+var (
+	lsofCache   = make(map[int]lsofEntry)
+	lsofCacheMu sync.Mutex
+)
+
+// lsofCacheTTL is how long a cwd found by lsof is trusted
+const lsofCacheTTL = 30 * time.Second
+
+// lsofEntry is a cached cwd and when lsof found it
+type lsofEntry struct {
+	cwd string
+	at  time.Time
+}
+
+// deletedSuffix is how Linux reports a working dir that has been deleted
+const deletedSuffix = " (deleted)"
+
+// CheckWorkingDir strips the marker Linux adds to a deleted working dir and
+// reports whether the dir is gone. Only local paths (local set) are checked
+// on disk; for remote ones the marker is all there is to go on.
+func CheckWorkingDir(path string, local bool) (dir string, missing bool) {
+	if trimmed, ok := strings.CutSuffix(path, deletedSuffix); ok {
+		return trimmed, true
+	}
+	if !local || path == "" {
+		return path, false
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return path, true
+	}
+	return path, false
+}
+
+// EnrichWithCwd fills in WorkingDir for sessions that don't have one
+// (typically non-tmux sessions such as VS Code terminals). It reads
+// /proc/<pid>/cwd where available (Linux) and, if useLsof is set, falls back
+// to a single batched lsof call (macOS), which is noticeably slower. Remote
+// sessions are left alone.
+func EnrichWithCwd(sessions []*Session, useLsof bool) {
+	EnrichWithCwdContext(context.Background(), sessions, useLsof)
+}
+
+// EnrichWithCwdContext is EnrichWithCwd, giving up on lsof when ctx is done
+func EnrichWithCwdContext(ctx context.Context, sessions []*Session, useLsof bool) {
+	for _, s := range sessions {
+		CwdEnricher(ctx, s)
+	}
+	EnrichWithLsofContext(ctx, sessions, useLsof)
+}
+
+// CwdEnricher is the step that fills in a local session's WorkingDir from
+// /proc/<pid>/cwd, where there is one (Linux), if it has none yet
+func CwdEnricher(_ context.Context, s *Session) {
+	if s.WorkingDir != "" || s.Host != "" {
+		return
+	}
+	if target, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", s.PID)); err == nil {
+		s.WorkingDir, s.WorkingDirMissing = CheckWorkingDir(target, true)
+	}
+}
+
+// EnrichWithLsofContext fills in WorkingDir for the local sessions still
+// without one after CwdEnricher, if useLsof is set, with one lsof call for
+// all of them. That's a batch rather than a per-session step, since an lsof
+// per session would cost far more than the pool saves.
+func EnrichWithLsofContext(ctx context.Context, sessions []*Session, useLsof bool) {
+	if !useLsof {
+		return
+	}
+	var missing []*Session
+	for _, s := range sessions {
+		if s.WorkingDir == "" && s.Host == "" {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	pids := make([]int, 0, len(missing))
+	for _, s := range missing {
+		pids = append(pids, s.PID)
+	}
+	cwds := lsofCwds(ctx, pids)
+
+	for _, s := range missing {
+		s.WorkingDir, s.WorkingDirMissing = CheckWorkingDir(cwds[s.PID], true)
+	}
+}
+
+// lsofCwds resolves the cwd of each PID, running lsof once for any PIDs not
+// cached. PIDs lsof finds nothing for aren't cached, so they're tried again
+// next time.
+func lsofCwds(ctx context.Context, pids []int) map[int]string {
+	lsofCacheMu.Lock()
+	defer lsofCacheMu.Unlock()
+
+	now := time.Now()
+	for pid, e := range lsofCache {
+		if now.Sub(e.at) > lsofCacheTTL {
+			delete(lsofCache, pid)
+		}
+	}
+
+	var uncached []string
+	for _, pid := range pids {
+		if _, ok := lsofCache[pid]; !ok {
+			uncached = append(uncached, strconv.Itoa(pid))
+		}
+	}
+
+	if len(uncached) > 0 {
+		// -Fpn prints one field per line: "p<pid>" followed by "n<path>"
+		out, _ := runner.Local.Output(ctx, "lsof", "-a", "-d", "cwd", "-p", strings.Join(uncached, ","), "-Fpn")
+		pid := 0
+		for _, line := range strings.Split(string(out), "\n") {
+			switch {
+			case strings.HasPrefix(line, "p"):
+				pid, _ = strconv.Atoi(line[1:])
+			case strings.HasPrefix(line, "n") && pid != 0:
+				lsofCache[pid] = lsofEntry{cwd: line[1:], at: now}
+			}
+		}
+	}
+
+	result := make(map[int]string, len(pids))
+	for _, pid := range pids {
+		result[pid] = lsofCache[pid].cwd
+	}
+	return result
+}
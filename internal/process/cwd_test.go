@@ -0,0 +1,63 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	gone := filepath.Join(dir, "gone")
+	tests := []struct {
+		name, path string
+		local      bool
+		wantDir    string
+		wantGone   bool
+	}{
+		{"exists", dir, true, dir, false},
+		{"doesn't exist", gone, true, gone, true},
+		{"deleted marker", gone + " (deleted)", true, gone, true},
+		{"remote unchecked", gone, false, gone, false},
+		{"remote deleted marker", gone + " (deleted)", false, gone, true},
+		{"empty", "", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, missing := CheckWorkingDir(tt.path, tt.local)
+			if dir != tt.wantDir || missing != tt.wantGone {
+				t.Errorf("CheckWorkingDir(%q, %v) = %q, %v; want %q, %v", tt.path, tt.local, dir, missing, tt.wantDir, tt.wantGone)
+			}
+		})
+	}
+}
+
+func TestEnrichWithCwdDeletedDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads /proc/<pid>/cwd")
+	}
+	dir := filepath.Join(t.TempDir(), "repo")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sleep", "30")
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Session{PID: cmd.Process.Pid}
+	EnrichWithCwd([]*Session{s}, false)
+	if s.WorkingDir != dir || !s.WorkingDirMissing {
+		t.Errorf("WorkingDir, WorkingDirMissing = %q, %v; want %q, true", s.WorkingDir, s.WorkingDirMissing, dir)
+	}
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// EnrichWorkers is how many sessions Enrich works on at once by default
+const EnrichWorkers = 8
+
+// Enricher fills in part of one session, e.g. whether it has active work
+type Enricher func(ctx context.Context, s *Session)
+
+// PanicError is a panic recovered while working on one session, which is
+// skipped rather than taking the whole run down with it
+type PanicError struct {
+	// Session is the session being worked on, or nil for a panic while
+	// reading the ps output it would have come from
+	Session *Session
+	// Line is the ps output line being read, when Session is nil
+	Line  string
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	if e.Session != nil {
+		return fmt.Sprintf("%s: internal error: %v", e.Session.Label(), e.Value)
+	}
+	return fmt.Sprintf("ps line %q: internal error: %v", e.Line, e.Value)
+}
+
+// DropPanicked removes the sessions that panicked from sessions
+func DropPanicked(sessions []*Session, panics []*PanicError) []*Session {
+	if len(panics) == 0 {
+		return sessions
+	}
+	return slices.DeleteFunc(sessions, func(s *Session) bool {
+		return slices.ContainsFunc(panics, func(p *PanicError) bool { return p.Session == s })
+	})
+}
+
+// Enrich runs steps over every session, up to workers sessions at a time. A
+// session whose steps panic is left as far as they got, and returned as a
+// PanicError.
+func Enrich(sessions []*Session, workers int, steps ...Enricher) []*PanicError {
+	return EnrichContext(context.Background(), sessions, workers, steps...)
+}
+
+// EnrichContext is Enrich, not starting on any more sessions once ctx is
+// done. Each session's steps run in order on a single goroutine, so a step
+// can write to its session without locking, and later steps see earlier
+// ones' results.
+func EnrichContext(ctx context.Context, sessions []*Session, workers int, steps ...Enricher) []*PanicError {
+	if len(steps) == 0 || len(sessions) == 0 {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var panics []*PanicError
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for _, s := range sessions {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				if v := recover(); v != nil {
+					mu.Lock()
+					panics = append(panics, &PanicError{Session: s, Value: v})
+					mu.Unlock()
+				}
+			}()
+			for _, step := range steps {
+				step(ctx, s)
+			}
+		}()
+	}
+	wg.Wait()
+	return panics
+}
@@ -0,0 +1,58 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEnrichRecoversPanics(t *testing.T) {
+	sessions := []*Session{{PID: 1}, {PID: 2}, {PID: 3}}
+	fill := func(_ context.Context, s *Session) { s.Model = "opus" }
+	explode := func(_ context.Context, s *Session) {
+		if s.PID == 2 {
+			panic("bad ps line")
+		}
+		s.HasActiveWork = true
+	}
+
+	panics := Enrich(sessions, 2, fill, explode)
+	if len(panics) != 1 || panics[0].Session != sessions[1] || panics[0].Value != "bad ps line" {
+		t.Fatalf("panics = %v, want one for pid:2", panics)
+	}
+	if got, want := panics[0].Error(), "pid:2: internal error: bad ps line"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	// The other sessions get every step; the panicking one keeps what
+	// ran before the panic
+	for _, s := range sessions {
+		if s.Model != "opus" || s.HasActiveWork != (s.PID != 2) {
+			t.Errorf("session %d = %+v after Enrich", s.PID, *s)
+		}
+	}
+
+	kept := DropPanicked(sessions, panics)
+	if len(kept) != 2 || kept[0].PID != 1 || kept[1].PID != 3 {
+		t.Errorf("DropPanicked kept %v, want pids 1 and 3", kept)
+	}
+}
+
+// BenchmarkEnrich compares running a subprocess-bound step over many
+// sessions one at a time with running it on the worker pool
+func BenchmarkEnrich(b *testing.B) {
+	sessions := make([]*Session, 64)
+	for i := range sessions {
+		sessions[i] = &Session{PID: i + 1}
+	}
+	// About what spawning ps or tmux costs
+	spawn := func(context.Context, *Session) { time.Sleep(2 * time.Millisecond) }
+
+	for _, workers := range []int{1, EnrichWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				Enrich(sessions, workers, spawn)
+			}
+		})
+	}
+}
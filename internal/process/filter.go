@@ -0,0 +1,51 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NormalizePath makes paths from users and from tmux comparable: relative
+// paths become absolute, trailing slashes and ".." are cleaned, and symlinks
+// are resolved (so /tmp and /private/tmp match on macOS). If the path can't be
+// resolved (e.g. it was deleted), the cleaned absolute path is returned.
+func NormalizePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if strings.HasPrefix(path, "~/") || path == "~" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[1:])
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+// FilterByWorkingDir keeps sessions whose working dir is dir or inside it
+func FilterByWorkingDir(sessions []*Session, dir string) []*Session {
+	dir = NormalizePath(dir)
+
+	var filtered []*Session
+	for _, s := range sessions {
+		if wd := NormalizePath(s.WorkingDir); wd != "" && isWithin(wd, dir) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// isWithin reports whether path is dir or a descendant of it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
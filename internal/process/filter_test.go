@@ -0,0 +1,95 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(dir, "repo")
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(repo, link); err != nil {
+		t.Fatal(err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, _ = filepath.EvalSymlinks(home)
+	t.Chdir(dir)
+
+	tests := []struct {
+		name, path, want string
+	}{
+		{"empty", "", ""},
+		{"absolute", repo, repo},
+		{"trailing slash", repo + "/", repo},
+		{"dot dot", filepath.Join(repo, "sub", ".."), repo},
+		{"relative", "repo", repo},
+		{"symlink", link, repo},
+		{"missing", filepath.Join(dir, "gone") + "/", filepath.Join(dir, "gone")},
+		{"home", "~", home},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePath(tt.path); got != tt.want {
+				t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterByWorkingDir(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"api", "api/cmd", "api-v2", "web"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "api"), filepath.Join(dir, "api-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := []*Session{
+		{TmuxSession: "api", WorkingDir: filepath.Join(dir, "api")},
+		{TmuxSession: "api-cmd", WorkingDir: filepath.Join(dir, "api", "cmd")},
+		{TmuxSession: "api-v2", WorkingDir: filepath.Join(dir, "api-v2")},
+		{TmuxSession: "web", WorkingDir: filepath.Join(dir, "web")},
+		{TmuxSession: "linked", WorkingDir: filepath.Join(dir, "api-link")},
+		{TmuxSession: "unknown"},
+	}
+	tests := []struct {
+		name, dir string
+		want      []string
+	}{
+		{"dir and below", filepath.Join(dir, "api"), []string{"api", "api-cmd", "linked"}},
+		{"trailing slash", filepath.Join(dir, "api") + "/", []string{"api", "api-cmd", "linked"}},
+		{"through a symlink", filepath.Join(dir, "api-link"), []string{"api", "api-cmd", "linked"}},
+		{"subdir only", filepath.Join(dir, "api", "cmd"), []string{"api-cmd"}},
+		{"parent", dir, []string{"api", "api-cmd", "api-v2", "web", "linked"}},
+		{"no match", filepath.Join(dir, "docs"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range FilterByWorkingDir(sessions, tt.dir) {
+				got = append(got, s.TmuxSession)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FilterByWorkingDir(%q) = %v, want %v", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// helperSubcommands are agent subcommands that run without an interactive
+// session, e.g. an MCP server or a self-update, by agent. Only the first
+// argument counts, so a prompt mentioning one isn't mistaken for it.
+var helperSubcommands = map[string][]string{
+	"claude": {"mcp", "config", "doctor", "update", "install", "migrate-installer", "setup-token"},
+	"codex":  {"exec", "e", "mcp", "mcp-server", "app-server", "proto", "login", "logout", "apply", "a", "completion", "debug", "sandbox"},
+	"gemini": {"mcp", "extensions"},
+}
+
+// helperFlags are flags that make an agent answer and exit rather than
+// start a session, by agent. They differ per agent: codex -p picks a
+// profile, where claude -p prints one reply.
+var helperFlags = map[string][]string{
+	"claude": {"-p", "--print", "--output-format", "--input-format", "-v", "--version", "-h", "--help"},
+	"codex":  {"-V", "--version", "-h", "--help"},
+	"gemini": {"-p", "--prompt", "-v", "--version", "-h", "--help"},
+}
+
+// helperPatterns holds configured regexes, by agent, for the command lines
+// of helper processes the built-in checks miss
+var helperPatterns = make(map[string][]*regexp.Regexp)
+
+// SetHelperPatterns makes findProcesses also leave out agent processes whose
+// command line matches one of patterns, on top of the built-in helper
+// checks. No patterns restores the default.
+func SetHelperPatterns(agent string, patterns []string) error {
+	if len(patterns) == 0 {
+		delete(helperPatterns, agent)
+		return nil
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("%s helper pattern: %w", agent, err)
+		}
+		res = append(res, re)
+	}
+	helperPatterns[agent] = res
+	return nil
+}
+
+// isHelper reports whether command runs agent as a helper rather than a
+// session someone works in: a one-shot prompt, an MCP server, a --version
+// check and the like. Helpers started from a terminal have a TTY, so that
+// alone doesn't rule them out. argv is the command's words, split as the
+// process got them where that's known (see processArgs). Subcommands and
+// flags only count before any free text, so a prompt like "fix the -p
+// flag" or "install deps" doesn't make a session a helper.
+func isHelper(agent, command string, argv []string) bool {
+	args := agentArgs(agent, argv)
+	if len(args) > 0 && slices.Contains(helperSubcommands[agent], args[0]) {
+		return true
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			// A word right after a flag may be its value, as in
+			// --model opus; any other is the start of a prompt
+			prev := ""
+			if i > 0 {
+				prev = args[i-1]
+			}
+			if !strings.HasPrefix(prev, "-") || strings.Contains(prev, "=") {
+				break
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		if slices.Contains(helperFlags[agent], name) {
+			return true
+		}
+	}
+	for _, re := range helperPatterns[agent] {
+		if re.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// processArgs returns the arguments a local agent process was started
+// with, from /proc/<pid>/cmdline, keeping the boundaries between them that
+// ps's command column loses: "claude 'install deps'" shows there as
+// claude install deps. Elsewhere (macOS, or a remote host), or where the
+// process rewrote them (as node does to set its title) so they no longer
+// show it running agent, it splits command.
+func processArgs(r runner.Runner, agent string, pid int, command string) []string {
+	if r.Host() == "" {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if err == nil && len(data) > 0 {
+			argv := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+			if agentArgsStart(agent, argv) > 0 {
+				return argv
+			}
+		}
+	}
+	return strings.Fields(command)
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+func TestIsHelper(t *testing.T) {
+	tests := []struct {
+		name, agent string
+		argv        []string
+		want        bool
+	}{
+		{"session", "claude", []string{"claude"}, false},
+		{"session with flags", "claude", []string{"claude", "--model", "opus", "--verbose"}, false},
+		{"print", "claude", []string{"claude", "-p", "summarize"}, true},
+		{"print after a flag's value", "claude", []string{"claude", "--model", "opus", "-p", "hi"}, true},
+		{"print with equals", "claude", []string{"claude", "--output-format=json", "hi"}, true},
+		{"version", "codex", []string{"codex", "--version"}, true},
+		{"mcp server", "claude", []string{"claude", "mcp", "serve"}, true},
+		{"codex exec", "codex", []string{"codex", "exec", "fix the tests"}, true},
+		{"gemini prompt", "gemini", []string{"gemini", "--prompt", "hi"}, true},
+		{"codex profile", "codex", []string{"codex", "-p", "work"}, false},
+
+		// Prompts as the process got them, quoted
+		{"prompt mentioning a flag", "claude", []string{"claude", "fix the -p flag"}, false},
+		{"prompt starting with a subcommand", "claude", []string{"claude", "install deps"}, false},
+		{"codex prompt starting with a subcommand", "codex", []string{"codex", "apply the patch"}, false},
+		{"prompt after flags", "claude", []string{"claude", "--model", "opus", "explain --help"}, false},
+
+		// The same as ps shows them, quoting lost
+		{"split prompt mentioning a flag", "claude", []string{"claude", "fix", "the", "-p", "flag"}, false},
+		{"split prompt after a flag", "claude", []string{"claude", "--verbose", "fix", "the", "-p", "flag"}, false},
+		{"split prompt after --", "gemini", []string{"gemini", "--", "-p", "is", "a", "flag"}, false},
+
+		{"through npx", "claude", []string{"npx", "-y", "@anthropic-ai/claude-code", "-p", "hi"}, true},
+		{"npx's own flags", "claude", []string{"npx", "--help", "@anthropic-ai/claude-code"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command := strings.Join(tt.argv, " ")
+			if got := isHelper(tt.agent, command, tt.argv); got != tt.want {
+				t.Errorf("isHelper(%q, %q) = %v, want %v", tt.agent, tt.argv, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHelperPatterns(t *testing.T) {
+	if err := SetHelperPatterns("claude", []string{`--mcp-config \S+/bridge\.json`}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetHelperPatterns("claude", nil)
+
+	command := "claude --mcp-config /opt/editor/bridge.json"
+	if !isHelper("claude", command, strings.Fields(command)) {
+		t.Errorf("isHelper(%q) = false, want true from the configured pattern", command)
+	}
+	if isHelper("codex", "codex --mcp-config /opt/editor/bridge.json", nil) {
+		t.Error("another agent's pattern applied to codex")
+	}
+}
+
+func TestProcessArgs(t *testing.T) {
+	// A shell linked as claude, which stays around to run the second
+	// command, with a prompt as $0
+	claude := filepath.Join(t.TempDir(), "claude")
+	if err := os.Symlink("/bin/sh", claude); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(claude, "-c", "sleep 30; :", "install deps")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	pid := cmd.Process.Pid
+	command := claude + " -c sleep 30; : install deps" // As ps shows it
+
+	want := strings.Fields(command)
+	if _, err := os.Stat("/proc/self/cmdline"); err == nil {
+		want = []string{claude, "-c", "sleep 30; :", "install deps"}
+	}
+	if got := processArgs(runner.Local, "claude", pid, command); !slices.Equal(got, want) {
+		t.Errorf("processArgs = %q, want %q", got, want)
+	}
+
+	// Arguments that don't show the agent, e.g. rewritten, aren't trusted
+	if got := processArgs(runner.Local, "codex", pid, command); !slices.Equal(got, strings.Fields(command)) {
+		t.Errorf("processArgs for another agent = %q, want the command split", got)
+	}
+	remote := &runnertest.Fake{HostName: "dev@box"}
+	if got := processArgs(remote, "claude", pid, command); !slices.Equal(got, strings.Fields(command)) {
+		t.Errorf("processArgs on a remote host = %q, want the command split", got)
+	}
+}
@@ -0,0 +1,102 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+func TestAgentArgs(t *testing.T) {
+	tests := []struct {
+		name, agent, command string
+		want                 []string // nil if the command doesn't run agent
+	}{
+		{"bare", "claude", "claude --continue", []string{"--continue"}},
+		{"npx", "claude", "npx @anthropic-ai/claude-code", []string{}},
+		{"npx pinned", "codex", "npx -y @openai/codex@0.46.0 --full-auto", []string{"--full-auto"}},
+		{"npx from a path", "claude", "/usr/local/bin/npx @anthropic-ai/claude-code@latest --model opus", []string{"--model", "opus"}},
+		{"running npx", "gemini", "npm exec @google/gemini-cli --yolo", []string{"--yolo"}},
+		{"bunx", "claude", "bunx @anthropic-ai/claude-code --verbose", []string{"--verbose"}},
+		{"bunx package", "codex", "bunx -p @openai/codex codex --search", []string{"--search"}},
+		{"package equals", "codex", "bunx --package=@openai/codex@0.46.0 codex", []string{}},
+		{"bun x", "gemini", "bun x @google/gemini-cli", []string{}},
+		{"pnpm dlx", "codex", "pnpm dlx @openai/codex resume", []string{"resume"}},
+		{"yarn dlx", "claude", "yarn dlx @anthropic-ai/claude-code", []string{}},
+		{"another package", "claude", "npx prettier --write .", nil},
+		{"another agent's package", "claude", "npx @openai/codex", nil},
+		{"agent named after another package", "codex", "bunx -p @openai/codex-sdk codex", nil},
+		{"package as an argument", "claude", "npx eslint @anthropic-ai/claude-code", nil},
+		{"npm without exec", "claude", "npm install @anthropic-ai/claude-code", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := agentArgsStart(tt.agent, strings.Fields(tt.command))
+			if tt.want == nil {
+				if start >= 0 {
+					t.Errorf("agentArgsStart(%q, %q) = %d, want -1", tt.agent, tt.command, start)
+				}
+				return
+			}
+			if got := AgentArgs(tt.agent, tt.command); !slices.Equal(got, tt.want) {
+				t.Errorf("AgentArgs(%q, %q) = %q, want %q", tt.agent, tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageVersion(t *testing.T) {
+	tests := []struct {
+		agent, command, want string
+	}{
+		{"codex", "npx @openai/codex@0.46.0 --full-auto", "0.46.0"},
+		{"claude", "bunx @anthropic-ai/claude-code@2.1.14", "2.1.14"},
+		{"codex", "bunx --package=@openai/codex@0.47.0-alpha.3 codex", "0.47.0-alpha.3"},
+		{"claude", "npx @anthropic-ai/claude-code@latest", ""},
+		{"claude", "npx @anthropic-ai/claude-code", ""},
+		{"claude", "npx @openai/codex@0.46.0", ""},
+	}
+	for _, tt := range tests {
+		if got := packageVersion(tt.agent, tt.command); got != tt.want {
+			t.Errorf("packageVersion(%q, %q) = %q, want %q", tt.agent, tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestFindAgentSessionsThroughLaunchers(t *testing.T) {
+	// npx runs the package from its cache, where package.json gives the version
+	pkg := filepath.Join(t.TempDir(), "_npx", "1a2b", "node_modules", "@anthropic-ai", "claude-code")
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(pkg, "package.json"), `{"name": "@anthropic-ai/claude-code", "version": "2.1.14"}`)
+	writeFile(t, filepath.Join(pkg, "cli.js"), "")
+
+	ps := `  100 pts/1    S+   npm exec @anthropic-ai/claude-code@latest --model opus
+  200 pts/2    S+   bunx @openai/codex@0.46.0 --full-auto
+  300 pts/3    S+   npx prettier --write .
+`
+	r := (&runnertest.Fake{Func: func(string) ([]byte, error) {
+		return nil, errors.New("exit status 1") // pgrep: no children
+	}}).On("ps -eo pid=,tty=,stat=,command=", ps, nil).
+		On("pgrep -P 100", "101\n", nil).
+		On("ps -o command= -p 101", "node "+filepath.Join(pkg, "cli.js")+" --model opus\n", nil)
+
+	sessions, err := FindAgentSessions(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{100: "claude 2.1.14", 200: "codex 0.46.0"}
+	if len(sessions) != len(want) {
+		t.Errorf("found %d sessions, want %d", len(sessions), len(want))
+	}
+	for _, s := range sessions {
+		if got := s.Agent + " " + s.RunningVersion; got != want[s.PID] {
+			t.Errorf("PID %d = %q, want %q", s.PID, got, want[s.PID])
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// modelFromArgs finds the model an agent was launched with: --model or -m
+// for any agent, and for Codex also a model set with -c/--config. It returns
+// "" if none was given.
+func modelFromArgs(agent, command string) string {
+	words := strings.Fields(command)
+	for i, w := range words {
+		name, value, hasValue := strings.Cut(w, "=")
+		if !hasValue && i+1 < len(words) {
+			value = words[i+1]
+		}
+		switch {
+		case name == "--model", name == "-m" && agent != "claude":
+			return strings.Trim(value, `"'`)
+		case (name == "-c" || name == "--config") && agent == "codex":
+			if key, model, ok := strings.Cut(value, "="); ok && key == "model" {
+				return strings.Trim(model, `"'`)
+			}
+		}
+	}
+	return ""
+}
+
+// ModelContext returns the model a local session is using, for sessions not
+// launched with one on the command line: for Claude, the model of the last
+// reply in its transcript, else the one in ~/.claude/settings.json; for
+// Codex, the one in ~/.codex/config.toml. It returns "" if that can't be
+// told, and for remote sessions.
+//
+// It runs on every scan, so it only reads the transcript of a conversation
+// that is already known: from ConversationID, the command line, or the
+// files the process has open, which takes lsof outside Linux and so only
+// happens with useLsof. It never guesses the newest transcript, which
+// belongs to any of the sessions in the same dir.
+func ModelContext(ctx context.Context, s *Session, useLsof bool) string {
+	if s.Model != "" || s.Host != "" {
+		return s.Model
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	switch s.Agent {
+	case "claude":
+		// A deleted working dir can't be mapped to its project dir reliably
+		if projectDir := claudeProjectDir(s.WorkingDir); projectDir != "" && !s.WorkingDirMissing {
+			id := s.ConversationID
+			if id == "" {
+				id = conversationFromArgs(s.Command)
+			}
+			if id == "" {
+				id = openConversation(ctx, s.PID, projectDir, useLsof)
+			}
+			if id != "" {
+				if model := transcriptModel(filepath.Join(projectDir, id+".jsonl")); model != "" {
+					return model
+				}
+			}
+		}
+		return claudeSettingsModel(filepath.Join(home, ".claude", "settings.json"))
+	case "codex":
+		return codexConfigModel(filepath.Join(codexHome(), "config.toml"))
+	}
+	return ""
+}
+
+// transcriptTail is how much of the end of a transcript is searched for the
+// last reply's model; transcripts can run to many megabytes
+const transcriptTail = 256 << 10
+
+// transcriptModel returns the model of the last reply in a Claude
+// transcript, skipping the placeholder Claude uses for replies it made up
+// itself (e.g. after an interruption)
+func transcriptModel(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Size() > transcriptTail {
+		if _, err := f.Seek(-transcriptTail, io.SeekEnd); err != nil {
+			return ""
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return ""
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if !bytes.Contains(lines[i], []byte(`"model"`)) {
+			continue
+		}
+		var entry struct {
+			Type    string `json:"type"`
+			Message struct {
+				Model string `json:"model"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(lines[i], &entry) != nil || entry.Type != "assistant" {
+			continue
+		}
+		if model := entry.Message.Model; model != "" && model != "<synthetic>" {
+			return model
+		}
+	}
+	return ""
+}
+
+// claudeSettingsModel returns the default model set in Claude's settings
+func claudeSettingsModel(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var settings struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(data, &settings) != nil {
+		return ""
+	}
+	return settings.Model
+}
+
+// tomlModelRegex matches a top-level model = "..." line in a TOML file
+var tomlModelRegex = regexp.MustCompile(`^model\s*=\s*["']([^"']+)["']`)
+
+// codexConfigModel returns the default model set in Codex's config, which
+// is TOML. Only top-level keys count: ones after the first [table] belong
+// to a profile or provider.
+func codexConfigModel(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if m := tomlModelRegex.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
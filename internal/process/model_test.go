@@ -0,0 +1,48 @@
+package process
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestModelContextSessionsSharingADir(t *testing.T) {
+	const (
+		mine   = "11111111-1111-4111-8111-111111111111"
+		theirs = "22222222-2222-4222-8222-222222222222"
+	)
+	repo := t.TempDir()
+	project := claudeProject(t, nonAlnumRegex.ReplaceAllString(repo, "-"))
+	home, _ := os.UserHomeDir()
+	writeFile(t, filepath.Join(home, ".claude", "settings.json"), `{"model": "sonnet"}`)
+	writeFile(t, filepath.Join(project, mine+".jsonl"), `{"type": "assistant", "message": {"model": "claude-opus-4-1"}}`+"\n")
+	// The other session in the same dir replied last
+	writeFile(t, filepath.Join(project, theirs+".jsonl"), `{"type": "assistant", "message": {"model": "claude-haiku-4-5"}}`+"\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(project, theirs+".jsonl"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	missingPID := 1 << 30
+	tests := []struct {
+		name string
+		s    Session
+		want string
+	}{
+		{"known conversation", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, ConversationID: mine}, "claude-opus-4-1"},
+		{"resumed on the command line", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, Command: "claude --resume " + mine}, "claude-opus-4-1"},
+		{"unknown conversation", Session{Agent: "claude", PID: missingPID, WorkingDir: repo}, "sonnet"},
+		{"deleted dir", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, WorkingDirMissing: true, ConversationID: mine}, "sonnet"},
+		{"launched with one", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, Model: "opus", ConversationID: theirs}, "opus"},
+		{"remote", Session{Agent: "claude", PID: missingPID, WorkingDir: repo, Host: "dev@box", ConversationID: mine}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ModelContext(context.Background(), &tt.s, false); got != tt.want {
+				t.Errorf("ModelContext = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
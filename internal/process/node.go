@@ -0,0 +1,81 @@
+package process
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Agents installed from npm run as node scripts, so ps shows them as e.g.
+//
+//	node /usr/local/bin/gemini --model gemini-2.5-pro
+//
+// where the script is a link into the package, such as
+// /usr/local/lib/node_modules/@google/gemini-cli/dist/index.js.
+
+// scriptRunners are the runtimes that show up as argv0 for such installs
+var scriptRunners = []string{"node", "nodejs"}
+
+// nodeScriptIndex returns the index of the script a node command line runs,
+// or -1 if it isn't node running a script. Node's own flags before the
+// script are skipped.
+func nodeScriptIndex(words []string) int {
+	if len(words) == 0 || !slices.Contains(scriptRunners, filepath.Base(words[0])) {
+		return -1
+	}
+	for i := 1; i < len(words); i++ {
+		if !strings.HasPrefix(words[i], "-") {
+			return i
+		}
+	}
+	return -1
+}
+
+// isAgentScript reports whether script is agent's: its binary (a path
+// ending in the agent's name) or a file inside its npm package
+func isAgentScript(agent, script string) bool {
+	if isAgentCommand(agent, script) {
+		return true
+	}
+	pkg, ok := agentPackages[agent]
+	return ok && strings.Contains(script, "/node_modules/"+pkg+"/")
+}
+
+// nodeScriptVersion returns the version of the npm package a node command
+// line runs agent from, as its package.json gives it, or "". The script is
+// followed through links, so it only works for local processes.
+func nodeScriptVersion(agent, cmd string) string {
+	words := strings.Fields(cmd)
+	i := nodeScriptIndex(words)
+	pkg, ok := agentPackages[agent]
+	if i < 0 || !ok || !isAgentScript(agent, words[i]) {
+		return ""
+	}
+	script := words[i]
+	if resolved, err := filepath.EvalSymlinks(script); err == nil {
+		script = resolved
+	}
+	marker := "/node_modules/" + pkg + "/"
+	end := strings.Index(script, marker)
+	if end < 0 {
+		return ""
+	}
+
+	data, err := os.ReadFile(filepath.Join(script[:end+len(marker)], "package.json"))
+	if err != nil {
+		return ""
+	}
+	var manifest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(data, &manifest) != nil || manifest.Name != pkg {
+		return ""
+	}
+	if !packageVersionRegex.MatchString(manifest.Version) {
+		return ""
+	}
+	return manifest.Version
+}
@@ -0,0 +1,61 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAgentArgsStartNode(t *testing.T) {
+	tests := []struct {
+		agent, command string
+		want           int
+	}{
+		{"gemini", "node /usr/local/bin/gemini --model gemini-2.5-pro", 2},
+		{"gemini", "node --no-warnings=DEP0040 /usr/lib/node_modules/@google/gemini-cli/dist/index.js", 3},
+		{"gemini", "/opt/homebrew/bin/node /opt/homebrew/bin/gemini", 2},
+		{"gemini", "node /srv/app/server.js", -1},
+		{"codex", "node /usr/local/bin/gemini", -1},
+		{"gemini", "node", -1},
+	}
+	for _, tt := range tests {
+		if got := agentArgsStart(tt.agent, strings.Fields(tt.command)); got != tt.want {
+			t.Errorf("agentArgsStart(%q, %q) = %d, want %d", tt.agent, tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestNodeScriptVersion(t *testing.T) {
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "lib", "node_modules", "@google", "gemini-cli")
+	if err := os.MkdirAll(filepath.Join(pkg, "dist"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(pkg, "package.json"), `{"name": "@google/gemini-cli", "version": "0.9.0"}`)
+	writeFile(t, filepath.Join(pkg, "dist", "index.js"), "")
+	bin := filepath.Join(dir, "bin", "gemini")
+	if err := os.MkdirAll(filepath.Dir(bin), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(pkg, "dist", "index.js"), bin); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, agent, command, want string
+	}{
+		{"linked script", "gemini", "node " + bin, "0.9.0"},
+		{"script in package", "gemini", "node " + filepath.Join(pkg, "dist", "index.js") + " -m pro", "0.9.0"},
+		{"other agent", "codex", "node " + bin, ""},
+		{"not node", "gemini", bin, ""},
+		{"no package", "gemini", "node " + filepath.Join(dir, "gemini"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeScriptVersion(tt.agent, tt.command); got != tt.want {
+				t.Errorf("nodeScriptVersion(%q, %q) = %q, want %q", tt.agent, tt.command, got, tt.want)
+			}
+		})
+	}
+}
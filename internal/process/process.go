@@ -2,113 +2,388 @@
 package process
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/version"
 )
 
 // Session represents a running agent session
 type Session struct {
 	PID            int    `json:"pid"`
-	Agent          string `json:"agent"` // "claude" or "codex"
+	Agent          string `json:"agent"` // "claude", "codex" or "gemini"
 	TTY            string `json:"tty"`
 	RunningVersion string `json:"running_version"`
 	Command        string `json:"command"`
+	Model          string `json:"model,omitempty"` // e.g. "opus", when it can be told
 	TmuxSession    string `json:"tmux_session,omitempty"`
+	TmuxPane       string `json:"tmux_pane,omitempty"` // pane ID, e.g. "%3"
 	WorkingDir     string `json:"working_dir,omitempty"`
 	HasActiveWork  bool   `json:"has_active_work,omitempty"`
+	// WorkingDirMissing is set when WorkingDir has been deleted since the
+	// agent started in it, so nothing should be looked up or run there
+	WorkingDirMissing bool `json:"working_dir_missing,omitempty"`
+	// Attached is set when a tmux client is attached to the session, i.e.
+	// someone may be watching it
+	Attached bool `json:"attached,omitempty"`
+	// VersionRestricted is set when RunningVersion is unknown because the
+	// agent's processes couldn't be inspected, e.g. it runs as another user
+	VersionRestricted bool `json:"version_restricted,omitempty"`
+	// ActiveWorkUnknown is set when the session's pane couldn't be
+	// captured, so HasActiveWork is a guess rather than an observation
+	ActiveWorkUnknown bool `json:"active_work_unknown,omitempty"`
+
+	// Host is the remote host the session runs on; empty for local sessions
+	Host string `json:"host,omitempty"`
+	// ConversationID is the agent conversation to resume on restart, if known
+	ConversationID string `json:"conversation_id,omitempty"`
+	// ResumeBinary, if set, is the binary a restart relaunches the agent
+	// with instead of its usual one, e.g. an older version to roll back to
+	ResumeBinary string `json:"-"`
+
+	// foreground is set when the process is in its terminal's foreground
+	// process group, i.e. it's what the terminal is running right now
+	foreground bool
+
+	// InstalledVersion is the agent version installed on Host. Local
+	// sessions leave it empty and are compared against the local install.
+	InstalledVersion string `json:"installed_version,omitempty"`
+
+	// OutdatedSince is when av first saw the session running an outdated
+	// version, and Restarts how often av has restarted it, both from its
+	// history of earlier runs
+	OutdatedSince time.Time `json:"outdated_since,omitzero"`
+	Restarts      int       `json:"restarts,omitempty"`
+	// UserLabel is the user's own name for the session, from av label
+	UserLabel string `json:"user_label,omitempty"`
+
+	// VersionStatus and StatusReason classify the session's version, as
+	// set by SetStatus
+	VersionStatus VersionStatus `json:"status,omitempty"`
+	StatusReason  StatusReason  `json:"reason,omitempty"`
+}
+
+// Label names the session for display: its tmux session or PID, prefixed
+// with the host for remote sessions
+func (s *Session) Label() string {
+	label := s.TmuxSession
+	if label == "" {
+		label = fmt.Sprintf("pid:%d", s.PID)
+	}
+	if s.Host != "" {
+		label = s.Host + ":" + label
+	}
+	return label
+}
+
+// CurrentVersion returns the version the session should be running: the
+// install on its own host, looked up in installed for local sessions
+func (s *Session) CurrentVersion(installed map[string]string) string {
+	if s.Host != "" {
+		return s.InstalledVersion
+	}
+	return installed[s.Agent]
+}
+
+// Outdated reports whether the session runs a version other than the one it
+// should. A session whose running or installed version is unknown is never
+// outdated: there is nothing to compare.
+func (s *Session) Outdated(installed map[string]string) bool {
+	current := s.CurrentVersion(installed)
+	return s.RunningVersion != "" && current != "" && s.RunningVersion != current
 }
 
 // versionRegex extracts version from paths like /versions/2.1.14
 var versionRegex = regexp.MustCompile(`/versions/(\d+\.\d+\.\d+)`)
 
-// FindAgentSessions finds all running Claude and Codex sessions
-func FindAgentSessions() []*Session {
+// FindAgentSessions finds all running Claude, Codex and Gemini sessions on
+// the runner's host
+func FindAgentSessions(r runner.Runner) ([]*Session, error) {
+	return FindAgentSessionsContext(context.Background(), r)
+}
+
+// FindAgentSessionsContext is FindAgentSessions, giving up when ctx is done
+func FindAgentSessionsContext(ctx context.Context, r runner.Runner) ([]*Session, error) {
+	sessions, _, err := ScanAgentSessionsContext(ctx, r)
+	return sessions, err
+}
+
+// ScanAgentSessionsContext is FindAgentSessionsContext, also returning the
+// ps lines skipped because reading them panicked
+func ScanAgentSessionsContext(ctx context.Context, r runner.Runner) ([]*Session, []*PanicError, error) {
 	var sessions []*Session
+	var panics []*PanicError
 
-	// Find claude processes
-	claudeSessions := findProcesses("claude")
-	sessions = append(sessions, claudeSessions...)
+	for _, agent := range version.Agents {
+		found, skipped, err := findProcesses(ctx, r, agent)
+		panics = append(panics, skipped...)
+		if err != nil {
+			return sessions, panics, err
+		}
+		sessions = append(sessions, found...)
+	}
 
-	// Find codex processes
-	codexSessions := findProcesses("codex")
-	sessions = append(sessions, codexSessions...)
+	return dropBackgrounded(sessions), panics, nil
+}
 
-	return sessions
+// dropBackgrounded drops sessions sharing a terminal with one in its
+// foreground, e.g. a claude suspended with Ctrl+Z while codex runs in the
+// same pane: only the foreground one is what the pane is running, and what
+// a restart would reach. Terminals with no agent in the foreground keep all
+// of theirs.
+func dropBackgrounded(sessions []*Session) []*Session {
+	foreground := make(map[string]bool)
+	for _, s := range sessions {
+		if s.foreground {
+			foreground[s.TTY] = true
+		}
+	}
+	var kept []*Session
+	for _, s := range sessions {
+		if s.foreground || !foreground[s.TTY] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
 }
 
-func findProcesses(agent string) []*Session {
+func findProcesses(ctx context.Context, r runner.Runner, agent string) ([]*Session, []*PanicError, error) {
 	// Use ps directly instead of pgrep (more reliable across platforms)
 	// Find processes where command is exactly the agent name
-	out, err := exec.Command("ps", "-eo", "pid=,tty=,command=").Output()
+	out, err := r.Output(ctx, "ps", "-eo", "pid=,tty=,stat=,command=")
 	if err != nil {
-		return nil
+		return nil, nil, fmt.Errorf("ps: %w", err)
 	}
 
 	var sessions []*Session
-	seenTTYs := make(map[string]bool)
+	var panics []*PanicError
+	// seenTTYs indexes sessions by TTY
+	seenTTYs := make(map[string]int)
 
 	// Match lines where command is exactly "claude" or "claude --flags"
 	for _, line := range strings.Split(string(out), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
+		func() {
+			// A line av can't make sense of loses its session, not the run
+			defer func() {
+				if v := recover(); v != nil {
+					panics = append(panics, &PanicError{Line: line, Value: v})
+				}
+			}()
 
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
-			continue
-		}
+			pidField, tty, stat, command, ok := parsePSLine(line)
+			if !ok {
+				return
+			}
 
-		pid := 0
-		fmt.Sscanf(fields[0], "%d", &pid)
-		tty := fields[1]
-		command := strings.Join(fields[2:], " ")
+			pid := 0
+			fmt.Sscanf(pidField, "%d", &pid)
 
-		// Check if this is the agent we're looking for
-		// Command should start with agent name (e.g., "claude" or "claude --continue")
-		cmdParts := strings.Fields(command)
-		if len(cmdParts) == 0 || cmdParts[0] != agent {
-			continue
+			// Check if this is the agent we're looking for
+			// Command should start with agent name (e.g., "claude" or "claude --continue"),
+			// or run its package through a launcher (e.g. "npx @anthropic-ai/claude-code")
+			if agentArgsStart(agent, strings.Fields(command)) < 0 {
+				return
+			}
+
+			// Skip if no TTY or background process
+			if NormalizeTTY(tty) == "" {
+				return
+			}
+
+			// Skip helpers (e.g. `claude -p` or `codex mcp-server`) before
+			// they can take the place of the session on their terminal
+			if isHelper(agent, command, processArgs(r, agent, pid, command)) {
+				return
+			}
+
+			// Skip duplicate TTYs (keep first/main process), unless the first
+			// was backgrounded and this one is in the foreground: the
+			// terminal's current agent wins
+			foreground := strings.Contains(stat, "+")
+			i, seen := seenTTYs[tty]
+			if seen && (sessions[i].foreground || !foreground) {
+				return
+			}
+
+			// Find running version from child process, or the process itself
+			runningVersion, restricted := findRunningVersion(ctx, r, fmt.Sprintf("%d", pid), command, agent)
+
+			s := &Session{
+				PID:               pid,
+				Agent:             agent,
+				TTY:               tty,
+				RunningVersion:    runningVersion,
+				Command:           command,
+				Model:             modelFromArgs(agent, command),
+				Host:              r.Host(),
+				VersionRestricted: restricted,
+				foreground:        foreground,
+			}
+			if seen {
+				sessions[i] = s
+			} else {
+				seenTTYs[tty] = len(sessions)
+				sessions = append(sessions, s)
+			}
+		}()
+	}
+
+	return sessions, panics, nil
+}
+
+// isAgentCommand reports whether argv0 launches agent: the bare name, or a
+// path to its binary, including a specific Claude version run directly
+// (e.g. after a restart onto a picked version)
+func isAgentCommand(agent, argv0 string) bool {
+	if argv0 == agent || (strings.Contains(argv0, "/") && filepath.Base(argv0) == agent) {
+		return true
+	}
+	return agent == "claude" && claudeVersionRegex.MatchString(argv0)
+}
+
+// agentPackages are the npm packages the agents are published as
+var agentPackages = map[string]string{
+	"claude": "@anthropic-ai/claude-code",
+	"codex":  "@openai/codex",
+	"gemini": "@google/gemini-cli",
+}
+
+// launchers run a package's binary without installing it, listed by the
+// words their command lines start with; a running npx shows as "npm exec"
+var launchers = [][]string{
+	{"npx"}, {"bunx"}, {"pnpx"},
+	{"npm", "exec"}, {"bun", "x"}, {"pnpm", "dlx"}, {"yarn", "dlx"},
+}
+
+// agentArgsStart returns the index in a command's words where the agent's
+// own arguments start: 1 when the command runs the agent directly, just
+// past the script when node runs it, or just past the package when a
+// launcher runs it, as in
+//
+//	node /usr/local/bin/gemini --model gemini-2.5-pro
+//	npx -y @anthropic-ai/claude-code@latest --model opus
+//	bunx -p @openai/codex codex
+//
+// It returns -1 if the command doesn't run agent.
+func agentArgsStart(agent string, words []string) int {
+	if len(words) == 0 {
+		return -1
+	}
+	if isAgentCommand(agent, words[0]) {
+		return 1
+	}
+	if i := nodeScriptIndex(words); i > 0 {
+		if isAgentScript(agent, words[i]) {
+			return i + 1
 		}
+		return -1
+	}
 
-		// Skip if no TTY or background process
-		if tty == "??" || tty == "" {
+	i := launcherLen(words)
+	if i == 0 {
+		return -1
+	}
+	packaged := false // the package was given with -p, so its binary follows
+	for ; i < len(words); i++ {
+		w := words[i]
+		name, value, hasValue := strings.Cut(w, "=")
+		if name == "-p" || name == "--package" {
+			if !hasValue && i+1 < len(words) {
+				value = words[i+1]
+				i++
+			}
+			packaged = packaged || isAgentPackage(agent, value)
 			continue
 		}
+		if strings.HasPrefix(w, "-") {
+			continue // The launcher's own flags, e.g. -y
+		}
+		// The first positional is the package, or its binary after -p
+		if isAgentPackage(agent, w) || (packaged && w == agent) {
+			return i + 1
+		}
+		return -1
+	}
+	return -1
+}
 
-		// Skip duplicate TTYs (keep first/main process)
-		if seenTTYs[tty] {
+// launcherLen returns how many of the leading words name a package
+// launcher, or 0 if the command isn't run through one
+func launcherLen(words []string) int {
+	for _, l := range launchers {
+		if len(words) < len(l) || filepath.Base(words[0]) != l[0] {
 			continue
 		}
-		seenTTYs[tty] = true
+		if len(l) == 1 || words[1] == l[1] {
+			return len(l)
+		}
+	}
+	return 0
+}
 
-		// Find running version from child process
-		runningVersion := findRunningVersion(fmt.Sprintf("%d", pid), agent)
+// isAgentPackage reports whether a launcher's package spec is the agent's
+// package, at any version
+func isAgentPackage(agent, spec string) bool {
+	pkg, ok := agentPackages[agent]
+	return ok && (spec == pkg || strings.HasPrefix(spec, pkg+"@"))
+}
+
+// AgentArgs returns the arguments an agent's command line gives the agent
+// itself: those after its binary, or after the launcher and package that
+// run it
+func AgentArgs(agent, command string) []string {
+	return agentArgs(agent, strings.Fields(command))
+}
 
-		sessions = append(sessions, &Session{
-			PID:            pid,
-			Agent:          agent,
-			TTY:            tty,
-			RunningVersion: runningVersion,
-			Command:        command,
-		})
+// agentArgs is AgentArgs for a command already split into words
+func agentArgs(agent string, words []string) []string {
+	if start := agentArgsStart(agent, words); start > 0 {
+		return words[start:]
 	}
+	if len(words) == 0 {
+		return nil
+	}
+	return words[1:]
+}
 
-	return sessions
+// packageVersionRegex matches a pinned version in a package spec
+var packageVersionRegex = regexp.MustCompile(`^\d+\.\d+\.\d+\S*$`)
+
+// packageVersion returns the version a launcher's package spec pins the
+// agent to, e.g. 0.46.0 for npx @openai/codex@0.46.0, or "" if none is
+func packageVersion(agent, cmd string) string {
+	pkg, ok := agentPackages[agent]
+	if !ok {
+		return ""
+	}
+	for _, w := range strings.Fields(cmd) {
+		w = strings.TrimPrefix(w, "--package=")
+		if v, ok := strings.CutPrefix(w, pkg+"@"); ok && packageVersionRegex.MatchString(v) {
+			return v
+		}
+	}
+	return ""
 }
 
 // claudeVersionRegex extracts version from Claude binary paths like /share/claude/versions/2.1.14
 var claudeVersionRegex = regexp.MustCompile(`/share/claude/versions/(\d+\.\d+\.\d+)`)
 
-// findRunningVersion looks at child processes to find the actual running binary version
-func findRunningVersion(parentPID string, agent string) string {
+// findRunningVersion looks at child processes to find the actual running
+// binary version, falling back to the parent's own command (parentCmd) for
+// installs that exec the versioned binary directly. restricted reports that
+// no version was found and looking was refused permission somewhere.
+func findRunningVersion(ctx context.Context, r runner.Runner, parentPID, parentCmd string, agent string) (v string, restricted bool) {
 	// Get child process commands
-	out, err := exec.Command("pgrep", "-P", parentPID).Output()
+	out, err := r.Output(ctx, "pgrep", "-P", parentPID)
 	if err != nil {
-		return ""
+		// pgrep fails when there are no children
+		v = commandVersion(r, agent, parentCmd)
+		return v, v == "" && runner.PermissionDenied(err)
 	}
 
 	childPids := strings.Split(strings.TrimSpace(string(out)), "\n")
@@ -117,47 +392,97 @@ func findRunningVersion(parentPID string, agent string) string {
 			continue
 		}
 
-		cmdOut, err := exec.Command("ps", "-o", "command=", "-p", childPid).Output()
+		cmdOut, err := r.Output(ctx, "ps", "-o", "command=", "-p", childPid)
 		if err != nil {
+			restricted = restricted || runner.PermissionDenied(err)
 			continue
 		}
 
-		cmd := string(cmdOut)
+		// A launcher's child may be the package's node script, e.g. npx
+		// running @anthropic-ai/claude-code from its cache
+		if v := commandVersion(r, agent, strings.TrimSpace(string(cmdOut))); v != "" {
+			return v, false
+		}
+	}
 
-		// For Claude: look for /share/claude/versions/X.X.X
-		if agent == "claude" {
-			if matches := claudeVersionRegex.FindStringSubmatch(cmd); len(matches) > 1 {
-				return matches[1]
-			}
+	v = commandVersion(r, agent, parentCmd)
+	return v, v == "" && restricted
+}
+
+// commandVersion reads the running version from an agent process's command
+// line, or for a local node script from its package
+func commandVersion(r runner.Runner, agent, cmd string) string {
+	if v := versionFromCommand(agent, cmd); v != "" || r.Host() != "" {
+		return v
+	}
+	return nodeScriptVersion(agent, cmd)
+}
+
+// versionFromCommand extracts an agent's version from a process command line
+func versionFromCommand(agent, cmd string) string {
+	// The user's own patterns come first
+	if v := matchVersionPattern(agent, cmd); v != "" {
+		return v
+	}
+
+	// A launcher run can pin it, e.g. npx @anthropic-ai/claude-code@2.1.14
+	if v := packageVersion(agent, cmd); v != "" {
+		return v
+	}
+
+	// For Claude: look for /share/claude/versions/X.X.X
+	if agent == "claude" {
+		if matches := claudeVersionRegex.FindStringSubmatch(cmd); len(matches) > 1 {
+			return matches[1]
 		}
+	}
 
-		// For Codex: look for generic version pattern but only in codex paths
-		if agent == "codex" && strings.Contains(cmd, "codex") {
-			if matches := versionRegex.FindStringSubmatch(cmd); len(matches) > 1 {
-				return matches[1]
-			}
+	// For Codex/Gemini: look for generic version pattern but only in the agent's own paths
+	if agent != "claude" && strings.Contains(cmd, agent) {
+		if matches := versionRegex.FindStringSubmatch(cmd); len(matches) > 1 {
+			return matches[1]
 		}
 	}
 
 	return ""
 }
 
-// EnrichWithTmux adds tmux session info to sessions
+// EnrichWithTmux adds tmux session info to sessions. panes is keyed by
+// pane_tty; session TTYs are normalized to the same /dev form before lookup.
 func EnrichWithTmux(sessions []*Session, panes map[string]TmuxPane) {
+	step := TmuxEnricher(panes)
 	for _, s := range sessions {
-		ttyPath := "/dev/" + s.TTY
+		step(context.Background(), s)
+	}
+}
+
+// TmuxEnricher returns the step that adds tmux info to one session from
+// panes, which one tmux list-panes call gathers for every session
+func TmuxEnricher(panes map[string]TmuxPane) Enricher {
+	return func(_ context.Context, s *Session) {
+		ttyPath := NormalizeTTY(s.TTY)
+		if ttyPath == "" {
+			return
+		}
 		if pane, ok := panes[ttyPath]; ok {
 			s.TmuxSession = pane.Session
+			s.TmuxPane = pane.ID
 			s.WorkingDir = pane.Path
+			s.WorkingDirMissing = pane.PathMissing
+			s.Attached = pane.Attached
 		}
 	}
 }
 
 // TmuxPane represents a tmux pane's info
 type TmuxPane struct {
-	TTY     string
-	Session string
-	Path    string
+	ID       string
+	TTY      string
+	Session  string
+	Path     string
+	Attached bool // a client is attached to the pane's session
+	// PathMissing is set when the pane's current path no longer exists
+	PathMissing bool
 }
 
 // ShortenPath converts /Users/buddy/repos/foo to ~/repos/foo
@@ -0,0 +1,195 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+func TestEnrichWithTmux(t *testing.T) {
+	panes := map[string]TmuxPane{
+		"/dev/pts/1": {ID: "%0", TTY: "/dev/pts/1", Session: "api", Path: "/repos/api", Attached: true},
+		"/dev/pts/2": {ID: "%1", TTY: "/dev/pts/2", Session: "web", Path: "/repos/web", PathMissing: true},
+	}
+	sessions := []*Session{
+		{PID: 1, TTY: "pts/1"},
+		{PID: 2, TTY: "/dev/pts/2"},
+		{PID: 3, TTY: "pts/9", WorkingDir: "/elsewhere"},
+		{PID: 4, TTY: "?"},
+	}
+	EnrichWithTmux(sessions, panes)
+
+	want := []Session{
+		{PID: 1, TTY: "pts/1", TmuxSession: "api", TmuxPane: "%0", WorkingDir: "/repos/api", Attached: true},
+		{PID: 2, TTY: "/dev/pts/2", TmuxSession: "web", TmuxPane: "%1", WorkingDir: "/repos/web", WorkingDirMissing: true},
+		{PID: 3, TTY: "pts/9", WorkingDir: "/elsewhere"},
+		{PID: 4, TTY: "?"},
+	}
+	for i, s := range sessions {
+		w := want[i]
+		if s.TmuxSession != w.TmuxSession || s.TmuxPane != w.TmuxPane || s.WorkingDir != w.WorkingDir ||
+			s.WorkingDirMissing != w.WorkingDirMissing || s.Attached != w.Attached {
+			t.Errorf("session %d = %+v, want %+v", s.PID, *s, w)
+		}
+	}
+}
+
+// exitError returns the error of a command that failed printing stderr,
+// as ps and pgrep do when they aren't permitted to look at a process
+func exitError(t *testing.T, stderr string) error {
+	t.Helper()
+	_, err := exec.Command("sh", "-c", "echo \"$0\" >&2; exit 1", stderr).Output()
+	if err == nil {
+		t.Fatal("sh -c 'exit 1' succeeded")
+	}
+	return err
+}
+
+func TestFindRunningVersion(t *testing.T) {
+	noChildren := errors.New("exit status 1")
+	notPermitted := exitError(t, "ps: Operation not permitted")
+	tests := []struct {
+		name, agent, parentCmd string
+		script                 map[string]string
+		errs                   map[string]error
+		want                   string
+		restricted             bool
+	}{
+		{
+			name:      "parent only, no children",
+			agent:     "claude",
+			parentCmd: "/home/me/.local/share/claude/versions/2.1.14 --continue",
+			errs:      map[string]error{"pgrep -P 100": noChildren},
+			want:      "2.1.14",
+		},
+		{
+			name:      "parent only, children without it",
+			agent:     "codex",
+			parentCmd: "node /usr/bin/npx @openai/codex@0.46.0 --full-auto",
+			script: map[string]string{
+				"pgrep -P 100":          "101\n102\n",
+				"ps -o command= -p 101": "/bin/zsh\n",
+				"ps -o command= -p 102": "node mcp-server.js\n",
+			},
+			want: "0.46.0",
+		},
+		{
+			name:      "child first",
+			agent:     "claude",
+			parentCmd: "npx @anthropic-ai/claude-code@2.0.1",
+			script: map[string]string{
+				"pgrep -P 100":          "101\n",
+				"ps -o command= -p 101": "/home/me/.local/share/claude/versions/2.1.14\n",
+			},
+			want: "2.1.14",
+		},
+		{
+			name:       "children hidden, parent without it",
+			agent:      "claude",
+			parentCmd:  "claude",
+			script:     map[string]string{"pgrep -P 100": "101\n"},
+			errs:       map[string]error{"ps -o command= -p 101": fs.ErrPermission},
+			restricted: true,
+		},
+		{
+			name:      "children hidden, parent with it",
+			agent:     "claude",
+			parentCmd: "/home/me/.local/share/claude/versions/2.1.14",
+			script:    map[string]string{"pgrep -P 100": "101\n"},
+			errs:      map[string]error{"ps -o command= -p 101": fs.ErrPermission},
+			want:      "2.1.14",
+		},
+		{
+			name:       "children not permitted",
+			agent:      "claude",
+			parentCmd:  "claude",
+			script:     map[string]string{"pgrep -P 100": "101\n102\n"},
+			errs:       map[string]error{"ps -o command= -p 101": notPermitted, "ps -o command= -p 102": noChildren},
+			restricted: true,
+		},
+		{
+			name:       "pgrep not permitted",
+			agent:      "codex",
+			parentCmd:  "codex",
+			errs:       map[string]error{"pgrep -P 100": exitError(t, "pgrep: cannot open /proc/100/task: Permission denied")},
+			restricted: true,
+		},
+		{
+			name:      "children gone",
+			agent:     "claude",
+			parentCmd: "claude",
+			script:    map[string]string{"pgrep -P 100": "101\n"},
+			errs:      map[string]error{"ps -o command= -p 101": exitError(t, "")},
+		},
+		{
+			name:      "child found despite another not permitted",
+			agent:     "claude",
+			parentCmd: "claude",
+			script: map[string]string{
+				"pgrep -P 100":          "101\n102\n",
+				"ps -o command= -p 102": "/home/me/.local/share/claude/versions/2.1.14\n",
+			},
+			errs: map[string]error{"ps -o command= -p 101": notPermitted},
+			want: "2.1.14",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &runnertest.Fake{}
+			for cmdline, out := range tt.script {
+				r.On(cmdline, out, nil)
+			}
+			for cmdline, err := range tt.errs {
+				r.On(cmdline, "", err)
+			}
+			v, restricted := findRunningVersion(context.Background(), r, "100", tt.parentCmd, tt.agent)
+			if v != tt.want || restricted != tt.restricted {
+				t.Errorf("findRunningVersion = %q, %v; want %q, %v", v, restricted, tt.want, tt.restricted)
+			}
+		})
+	}
+}
+
+func TestFindAgentSessionsPrefersForeground(t *testing.T) {
+	ps := `  100 pts/1    T    claude
+  101 pts/1    S+   codex
+  200 pts/2    S    claude
+  201 pts/2    S+   claude --continue
+  300 pts/3    S    claude
+  301 pts/3    Ss   codex
+`
+	r := (&runnertest.Fake{Func: func(string) ([]byte, error) {
+		return nil, errors.New("exit status 1") // pgrep: no children
+	}}).On("ps -eo pid=,tty=,stat=,command=", ps, nil)
+
+	sessions, err := FindAgentSessions(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for _, s := range sessions {
+		got[s.TTY] = append(got[s.TTY], fmt.Sprintf("%d %s", s.PID, s.Agent))
+	}
+	want := map[string][]string{
+		// codex runs while claude is suspended with Ctrl+Z
+		"pts/1": {"101 codex"},
+		// The same agent twice: the foreground one
+		"pts/2": {"201 claude"},
+		// Nothing in the foreground, e.g. both started with &
+		"pts/3": {"300 claude", "301 codex"},
+	}
+	for tty, w := range want {
+		if !slices.Equal(got[tty], w) {
+			t.Errorf("%s: sessions %q, want %q", tty, got[tty], w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("sessions on %d terminals, want %d: %v", len(got), len(want), got)
+	}
+}
@@ -0,0 +1,387 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/buddyh/av/internal/version"
+)
+
+// Selector is a parsed --select expression: a boolean expression over a
+// session's fields, such as
+//
+//	agent==claude && outdated && !busy
+//	workdir~=repos/api || (remote && version<2.1.0)
+//
+// From loosest to tightest binding the operators are || (or), && (and),
+// ! (not) and the comparisons == != ~= < <= > >=; parentheses group. ~=
+// matches a regular expression, and the ordering comparisons work on
+// versions and numbers. A bool field on its own is true when set. Values
+// are bare words, or quoted with " or ' if they contain spaces or any of
+// ()!&|=<>~.
+type Selector struct {
+	expr selectorNode
+}
+
+// selectorNode is a node of a parsed Selector
+type selectorNode interface {
+	eval(s *Session, installed map[string]string) bool
+}
+
+// fieldKind is the type of a Selector field, which decides the operators
+// it takes
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindVersion
+	kindInt
+	kindBool
+)
+
+// selectorField is a session field a Selector can test. installed is only
+// needed for fields comparing against the installed version.
+type selectorField struct {
+	kind fieldKind
+	get  func(s *Session, installed map[string]string) any
+}
+
+// selectorFields lists the fields a Selector can test, by name
+var selectorFields = map[string]selectorField{
+	"agent":        {kindString, func(s *Session, _ map[string]string) any { return s.Agent }},
+	"session":      {kindString, func(s *Session, _ map[string]string) any { return s.TmuxSession }},
+	"label":        {kindString, func(s *Session, _ map[string]string) any { return s.Label() }},
+	"user_label":   {kindString, func(s *Session, _ map[string]string) any { return s.UserLabel }},
+	"host":         {kindString, func(s *Session, _ map[string]string) any { return s.Host }},
+	"workdir":      {kindString, func(s *Session, _ map[string]string) any { return s.WorkingDir }},
+	"command":      {kindString, func(s *Session, _ map[string]string) any { return s.Command }},
+	"model":        {kindString, func(s *Session, _ map[string]string) any { return s.Model }},
+	"tty":          {kindString, func(s *Session, _ map[string]string) any { return s.TTY }},
+	"conversation": {kindString, func(s *Session, _ map[string]string) any { return s.ConversationID }},
+	"version":      {kindVersion, func(s *Session, _ map[string]string) any { return s.RunningVersion }},
+	"installed":    {kindVersion, func(s *Session, installed map[string]string) any { return s.CurrentVersion(installed) }},
+	"pid":          {kindInt, func(s *Session, _ map[string]string) any { return s.PID }},
+	"restarts":     {kindInt, func(s *Session, _ map[string]string) any { return s.Restarts }},
+	"outdated":     {kindBool, func(s *Session, installed map[string]string) any { return s.Outdated(installed) }},
+	"busy":         {kindBool, func(s *Session, _ map[string]string) any { return s.HasActiveWork }},
+	"attached":     {kindBool, func(s *Session, _ map[string]string) any { return s.Attached }},
+	"tmux":         {kindBool, func(s *Session, _ map[string]string) any { return s.TmuxSession != "" }},
+	"remote":       {kindBool, func(s *Session, _ map[string]string) any { return s.Host != "" }},
+	"path_missing": {kindBool, func(s *Session, _ map[string]string) any { return s.WorkingDirMissing }},
+}
+
+// SelectorFieldNames returns the fields a Selector can test, sorted
+func SelectorFieldNames() []string {
+	names := make([]string, 0, len(selectorFields))
+	for name := range selectorFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ParseSelector parses a --select expression
+func ParseSelector(expr string) (*Selector, error) {
+	tokens, err := lexSelector(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &selectorParser{tokens: tokens}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+	return &Selector{expr: node}, nil
+}
+
+// Match reports whether the session satisfies the selector
+func (sel *Selector) Match(s *Session, installed map[string]string) bool {
+	return sel.expr.eval(s, installed)
+}
+
+// FilterBySelector keeps the sessions matching sel
+func FilterBySelector(sessions []*Session, sel *Selector, installed map[string]string) []*Session {
+	var filtered []*Session
+	for _, s := range sessions {
+		if sel.Match(s, installed) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+type andNode struct{ left, right selectorNode }
+
+func (n andNode) eval(s *Session, installed map[string]string) bool {
+	return n.left.eval(s, installed) && n.right.eval(s, installed)
+}
+
+type orNode struct{ left, right selectorNode }
+
+func (n orNode) eval(s *Session, installed map[string]string) bool {
+	return n.left.eval(s, installed) || n.right.eval(s, installed)
+}
+
+type notNode struct{ x selectorNode }
+
+func (n notNode) eval(s *Session, installed map[string]string) bool {
+	return !n.x.eval(s, installed)
+}
+
+// compareNode tests a field against a value; a bool field on its own is
+// compared with true
+type compareNode struct {
+	field selectorField
+	op    string
+	value string
+	re    *regexp.Regexp // for ~=
+	n     int            // the value, for int fields
+	b     bool           // the value, for bool fields
+}
+
+func (n compareNode) eval(s *Session, installed map[string]string) bool {
+	switch v := n.field.get(s, installed).(type) {
+	case bool:
+		return (v == n.b) == (n.op == "==")
+	case int:
+		return compareOrdered(n.op, v, n.n)
+	case string:
+		switch {
+		case n.op == "~=":
+			return n.re.MatchString(v)
+		case n.field.kind == kindVersion && n.op != "==" && n.op != "!=":
+			// An unknown version is neither older nor newer than anything
+			return v != "" && compareOrdered(n.op, version.Compare(v, n.value), 0)
+		default:
+			return compareOrdered(n.op, strings.Compare(v, n.value), 0)
+		}
+	}
+	return false
+}
+
+// compareOrdered applies a comparison operator to a and b
+func compareOrdered(op string, a, b int) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// Selector tokens
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+)
+
+type selectorToken struct {
+	kind tokenKind
+	text string
+}
+
+// selectorOps are the operator tokens, longest first so "<=" isn't read
+// as "<"
+var selectorOps = []string{"&&", "||", "==", "!=", "~=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+// selectorSpecial are the characters that end a bare word
+const selectorSpecial = `()!&|=<>~"'`
+
+func lexSelector(expr string) ([]selectorToken, error) {
+	var tokens []selectorToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			i++
+			continue
+		}
+		if c == '"' || c == '\'' {
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c quote", c)
+			}
+			tokens = append(tokens, selectorToken{tokString, expr[i+1 : i+1+end]})
+			i += end + 2
+			continue
+		}
+		if op := matchOp(expr[i:]); op != "" {
+			tokens = append(tokens, selectorToken{tokOp, op})
+			i += len(op)
+			continue
+		}
+		if strings.IndexByte(selectorSpecial, c) >= 0 {
+			return nil, fmt.Errorf("unexpected %q", string(c))
+		}
+		start := i
+		for i < len(expr) && !strings.ContainsAny(expr[i:i+1], " \t\n"+selectorSpecial) {
+			i++
+		}
+		tokens = append(tokens, selectorToken{tokWord, expr[start:i]})
+	}
+	return append(tokens, selectorToken{kind: tokEOF}), nil
+}
+
+func matchOp(s string) string {
+	for _, op := range selectorOps {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// selectorParser is a recursive descent parser over selector tokens
+type selectorParser struct {
+	tokens []selectorToken
+	pos    int
+}
+
+func (p *selectorParser) peek() selectorToken {
+	return p.tokens[p.pos]
+}
+
+func (p *selectorParser) next() selectorToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the operator op
+func (p *selectorParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) or() (selectorNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) and() (selectorNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) unary() (selectorNode, error) {
+	if p.accept("!") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	if p.accept("(") {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return x, nil
+	}
+	return p.comparison()
+}
+
+func (p *selectorParser) comparison() (selectorNode, error) {
+	tok := p.next()
+	if tok.kind != tokWord {
+		if tok.kind == tokEOF {
+			return nil, fmt.Errorf("expression ends where a field was expected")
+		}
+		return nil, fmt.Errorf("expected a field, got %q", tok.text)
+	}
+	field, ok := selectorFields[tok.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q (want one of %s)", tok.text, strings.Join(SelectorFieldNames(), ", "))
+	}
+	name := tok.text
+
+	op := p.peek()
+	if op.kind != tokOp || !slices.Contains([]string{"==", "!=", "~=", "<", "<=", ">", ">="}, op.text) {
+		if field.kind != kindBool {
+			return nil, fmt.Errorf("%s needs a comparison, e.g. %s==value", name, name)
+		}
+		return compareNode{field: field, op: "==", b: true}, nil
+	}
+	p.next()
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString {
+		return nil, fmt.Errorf("expected a value after %s%s", name, op.text)
+	}
+
+	n := compareNode{field: field, op: op.text, value: value.text}
+	ordering := op.text != "==" && op.text != "!=" && op.text != "~="
+	switch {
+	case op.text == "~=" && (field.kind == kindInt || field.kind == kindBool):
+		return nil, fmt.Errorf("%s can't be matched with ~=", name)
+	case op.text == "~=":
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s~=%s: %w", name, value.text, err)
+		}
+		n.re = re
+	case field.kind == kindBool:
+		if ordering {
+			return nil, fmt.Errorf("%s can only be compared with == or !=", name)
+		}
+		b, err := strconv.ParseBool(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s%s: want true or false", name, op.text, value.text)
+		}
+		n.b = b
+	case field.kind == kindInt:
+		i, err := strconv.Atoi(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s%s: want a number", name, op.text, value.text)
+		}
+		n.n = i
+	case field.kind == kindString && ordering:
+		return nil, fmt.Errorf("%s can only be compared with ==, != or ~=", name)
+	}
+	return n, nil
+}
@@ -0,0 +1,63 @@
+package process
+
+import "github.com/buddyh/av/internal/version"
+
+// VersionStatus is what a session's running version says about it, as the
+// sessions table shows it and JSON reports it
+type VersionStatus string
+
+const (
+	// StatusCurrent runs the version it should
+	StatusCurrent VersionStatus = "current"
+	// StatusOutdated runs another version, and a restart would fix it
+	StatusOutdated VersionStatus = "outdated"
+	// StatusBelowMinimum runs a version below its agent's minimum
+	StatusBelowMinimum VersionStatus = "below_minimum"
+	// StatusUnknown can't be compared; the reason says why
+	StatusUnknown VersionStatus = "unknown"
+)
+
+// StatusReason says why a session has its VersionStatus
+type StatusReason string
+
+const (
+	// ReasonVersionMatch: the running version is the installed one
+	ReasonVersionMatch StatusReason = "version_match"
+	// ReasonVersionMismatch: the running version isn't the installed one
+	ReasonVersionMismatch StatusReason = "version_mismatch"
+	// ReasonBelowMinimum: the running version is below the minimum
+	ReasonBelowMinimum StatusReason = "below_minimum"
+	// ReasonVersionUndetected: the running version couldn't be found
+	ReasonVersionUndetected StatusReason = "version_undetected"
+	// ReasonVersionRestricted: the running version couldn't be found for
+	// lack of permission to inspect the agent's processes
+	ReasonVersionRestricted StatusReason = "version_restricted"
+	// ReasonInstallUndetected: the installed version isn't known, so there
+	// is nothing to compare with
+	ReasonInstallUndetected StatusReason = "install_undetected"
+)
+
+// Status classifies the session against the version it should run, from
+// installed, and its agent's minimum version in minimums, if any
+func (s *Session) Status(installed, minimums map[string]string) (VersionStatus, StatusReason) {
+	current := s.CurrentVersion(installed)
+	switch {
+	case version.BelowMinimum(s.RunningVersion, minimums[s.Agent]):
+		return StatusBelowMinimum, ReasonBelowMinimum
+	case s.RunningVersion == "" && s.VersionRestricted:
+		return StatusUnknown, ReasonVersionRestricted
+	case s.RunningVersion == "":
+		return StatusUnknown, ReasonVersionUndetected
+	case current == "":
+		return StatusUnknown, ReasonInstallUndetected
+	case s.RunningVersion == current:
+		return StatusCurrent, ReasonVersionMatch
+	default:
+		return StatusOutdated, ReasonVersionMismatch
+	}
+}
+
+// SetStatus fills in the session's Status and StatusReason for JSON
+func (s *Session) SetStatus(installed, minimums map[string]string) {
+	s.VersionStatus, s.StatusReason = s.Status(installed, minimums)
+}
@@ -0,0 +1,73 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// Tree maps each process ID to its parent's, as seen by one ps run
+type Tree map[int]int
+
+// GetTree snapshots the parent of every process on the runner's host
+func GetTree(r runner.Runner) (Tree, error) {
+	return GetTreeContext(context.Background(), r)
+}
+
+// GetTreeContext is GetTree, giving up when ctx is done
+func GetTreeContext(ctx context.Context, r runner.Runner) (Tree, error) {
+	out, err := r.Output(ctx, "ps", "-eo", "pid=,ppid=")
+	if err != nil {
+		return nil, fmt.Errorf("ps: %w", err)
+	}
+	return parseTree(string(out)), nil
+}
+
+func parseTree(out string) Tree {
+	tree := make(Tree)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		tree[pid] = ppid
+	}
+	return tree
+}
+
+// IsDescendant reports whether pid is ancestor or runs below it
+func (t Tree) IsDescendant(pid, ancestor int) bool {
+	// The walk is bounded by the tree's size in case of a loop, as a
+	// snapshot taken while PIDs are reused could contain one
+	for range len(t) + 1 {
+		if pid == ancestor {
+			return true
+		}
+		parent, ok := t[pid]
+		if !ok || parent == pid || parent == 0 {
+			return false
+		}
+		pid = parent
+	}
+	return false
+}
+
+// FilterByAncestor keeps the local sessions whose process is ancestor or
+// one of its descendants in tree
+func FilterByAncestor(sessions []*Session, tree Tree, ancestor int) []*Session {
+	var filtered []*Session
+	for _, s := range sessions {
+		if s.Host == "" && tree.IsDescendant(s.PID, ancestor) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
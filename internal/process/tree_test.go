@@ -0,0 +1,88 @@
+package process
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+// fixtureTree is ps -eo pid=,ppid= output for:
+//
+//	1 init
+//	└─ 100 tmux server
+//	   ├─ 200 zsh ─ 201 claude ─ 202 node (MCP server)
+//	   └─ 300 zsh ─ 301 codex
+//	400 ─ 401 ─ 400 (a loop from PID reuse)
+const fixtureTree = `    1     0
+  100     1
+  200   100
+  201   200
+  202   201
+  300   100
+  301   300
+  400   401
+  401   400
+garbage line
+`
+
+func TestIsDescendant(t *testing.T) {
+	tree := parseTree(fixtureTree)
+	tests := []struct {
+		pid, ancestor int
+		want          bool
+	}{
+		{201, 201, true},
+		{201, 200, true},
+		{202, 100, true},
+		{301, 1, true},
+		{301, 200, false},
+		{200, 201, false},
+		{999, 1, false},
+		{999, 999, true},
+		{400, 100, false},
+		{400, 401, true},
+	}
+	for _, tt := range tests {
+		if got := tree.IsDescendant(tt.pid, tt.ancestor); got != tt.want {
+			t.Errorf("IsDescendant(%d, %d) = %v, want %v", tt.pid, tt.ancestor, got, tt.want)
+		}
+	}
+}
+
+func TestFilterByAncestor(t *testing.T) {
+	r := (&runnertest.Fake{}).On("ps -eo pid=,ppid=", fixtureTree, nil)
+	tree, err := GetTreeContext(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := []*Session{
+		{PID: 201, Agent: "claude"},
+		{PID: 301, Agent: "codex"},
+		{PID: 201, Agent: "claude", Host: "dev@box"},
+	}
+
+	pids := func(sessions []*Session) []int {
+		var pids []int
+		for _, s := range sessions {
+			pids = append(pids, s.PID)
+		}
+		return pids
+	}
+	tests := []struct {
+		ancestor int
+		want     []int
+	}{
+		{100, []int{201, 301}},
+		{200, []int{201}},
+		{301, []int{301}},
+		{202, nil},
+		{999, nil},
+	}
+	for _, tt := range tests {
+		if got := pids(FilterByAncestor(sessions, tree, tt.ancestor)); !slices.Equal(got, tt.want) {
+			t.Errorf("FilterByAncestor(%d) = %v, want %v", tt.ancestor, got, tt.want)
+		}
+	}
+}
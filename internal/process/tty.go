@@ -0,0 +1,91 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// bsdShortTTYRegex matches the abbreviated TTY names BSD ps prints, like s000
+var bsdShortTTYRegex = regexp.MustCompile(`^s\d+$`)
+
+// NormalizeTTY converts a TTY as printed by ps into the /dev path tmux reports
+// as pane_tty, so the two can be matched:
+//
+//	macOS:  s000 or ttys000 -> /dev/ttys000
+//	Linux:  pts/3           -> /dev/pts/3
+//
+// It returns "" for processes without a controlling terminal ("?" on Linux,
+// "??" on macOS).
+func NormalizeTTY(tty string) string {
+	switch {
+	case tty == "", tty == "?", tty == "??", tty == "-":
+		return ""
+	case strings.HasPrefix(tty, "/dev/"):
+		return tty
+	case runtime.GOOS != "linux" && bsdShortTTYRegex.MatchString(tty):
+		return "/dev/tty" + tty
+	default:
+		return "/dev/" + tty
+	}
+}
+
+// parsePSLine splits a "pid tty stat command" line from ps. The command is
+// everything after the state column, with its internal spacing preserved.
+func parsePSLine(line string) (pid, tty, stat, command string, ok bool) {
+	line = strings.TrimSpace(line)
+	pid, rest, found := cutField(line)
+	if !found {
+		return "", "", "", "", false
+	}
+	tty, rest, found = cutField(rest)
+	if !found {
+		return "", "", "", "", false
+	}
+	stat, command, found = cutField(rest)
+	if !found || command == "" {
+		return "", "", "", "", false
+	}
+	return pid, tty, stat, command, true
+}
+
+// cutField splits off the first whitespace-delimited field of s
+func cutField(s string) (field, rest string, ok bool) {
+	s = strings.TrimLeft(s, " \t")
+	i := strings.IndexAny(s, " \t")
+	if i == -1 {
+		return s, "", s != ""
+	}
+	return s[:i], strings.TrimLeft(s[i:], " \t"), true
+}
+
+// FilterByTTY keeps the sessions on terminal tty, given in any of the forms
+// NormalizeTTY accepts
+func FilterByTTY(sessions []*Session, tty string) []*Session {
+	tty = NormalizeTTY(tty)
+	var filtered []*Session
+	for _, s := range sessions {
+		if NormalizeTTY(s.TTY) == tty {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// NoSessionOnTTY is the error for a --tty that none of sessions is on,
+// listing the terminals they are on instead
+func NoSessionOnTTY(tty string, sessions []*Session) error {
+	var ttys []string
+	for _, s := range sessions {
+		if t := NormalizeTTY(s.TTY); t != "" && !slices.Contains(ttys, t) {
+			ttys = append(ttys, t)
+		}
+	}
+	if len(ttys) == 0 {
+		return fmt.Errorf("no agent session on %s: no agent sessions found", NormalizeTTY(tty))
+	}
+	slices.Sort(ttys)
+	return fmt.Errorf("no agent session on %s (sessions are on %s)", NormalizeTTY(tty), strings.Join(ttys, ", "))
+}
@@ -0,0 +1,63 @@
+package process
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestNormalizeTTY(t *testing.T) {
+	tests := []struct {
+		tty, want string
+	}{
+		{"", ""},
+		{"?", ""},
+		{"??", ""},
+		{"-", ""},
+		{"pts/3", "/dev/pts/3"},
+		{"/dev/pts/3", "/dev/pts/3"},
+		{"ttys003", "/dev/ttys003"},
+		{"/dev/ttys003", "/dev/ttys003"},
+		{"tty1", "/dev/tty1"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTTY(tt.tty); got != tt.want {
+			t.Errorf("NormalizeTTY(%q) = %q, want %q", tt.tty, got, tt.want)
+		}
+	}
+
+	// BSD ps abbreviates ttys003 to s003; on Linux that's just a name
+	want := "/dev/ttys003"
+	if runtime.GOOS == "linux" {
+		want = "/dev/s003"
+	}
+	if got := NormalizeTTY("s003"); got != want {
+		t.Errorf("NormalizeTTY(%q) = %q, want %q", "s003", got, want)
+	}
+}
+
+func TestParsePSLine(t *testing.T) {
+	tests := []struct {
+		name, line              string
+		pid, tty, stat, command string
+		ok                      bool
+	}{
+		{"linux", "  4242 pts/3    Sl+  claude --continue", "4242", "pts/3", "Sl+", "claude --continue", true},
+		{"macOS", "81234 s003     S+   /Users/me/.local/bin/claude", "81234", "s003", "S+", "/Users/me/.local/bin/claude", true},
+		{"no tty", "17 ?        Ss   codex exec fix", "17", "?", "Ss", "codex exec fix", true},
+		{"tabs", "17\tpts/0\tS\tgemini", "17", "pts/0", "S", "gemini", true},
+		{"spacing kept", "17 pts/0 S claude -p 'a  b'", "17", "pts/0", "S", "claude -p 'a  b'", true},
+		{"empty", "", "", "", "", "", false},
+		{"blank", "    ", "", "", "", "", false},
+		{"no command", "17 pts/0 S", "", "", "", "", false},
+		{"no stat", "17 pts/0", "", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pid, tty, stat, command, ok := parsePSLine(tt.line)
+			if pid != tt.pid || tty != tt.tty || stat != tt.stat || command != tt.command || ok != tt.ok {
+				t.Errorf("parsePSLine(%q) = %q, %q, %q, %q, %v; want %q, %q, %q, %q, %v",
+					tt.line, pid, tty, stat, command, ok, tt.pid, tt.tty, tt.stat, tt.command, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// versionPatterns holds user-configured regexes for finding an agent's
+// running version in a process command line, by agent
+var versionPatterns = make(map[string][]*regexp.Regexp)
+
+// SetVersionPatterns makes findRunningVersion try patterns, in order, before
+// the built-in ones for agent, e.g. for Nix store paths. Each must capture the
+// version in its first group. No patterns restores the default.
+func SetVersionPatterns(agent string, patterns []string) error {
+	if len(patterns) == 0 {
+		delete(versionPatterns, agent)
+		return nil
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := CompileVersionPattern(p)
+		if err != nil {
+			return fmt.Errorf("%s version pattern: %w", agent, err)
+		}
+		res = append(res, re)
+	}
+	versionPatterns[agent] = res
+	return nil
+}
+
+// CompileVersionPattern compiles a version pattern, checking it has a
+// capture group for the version
+func CompileVersionPattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("%q has no capture group for the version", pattern)
+	}
+	return re, nil
+}
+
+// matchVersionPattern returns the version the first of agent's configured
+// patterns to match cmd captures
+func matchVersionPattern(agent, cmd string) string {
+	for _, re := range versionPatterns[agent] {
+		if matches := re.FindStringSubmatch(cmd); len(matches) > 1 && matches[1] != "" {
+			return matches[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+// Package runner runs the external commands session detection is built on,
+// either locally or on a remote host over SSH
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Runner runs commands on one host
+type Runner interface {
+	// Output runs name with args and returns its stdout. A missing command
+	// is reported as exec.ErrNotFound on every host. The command is killed
+	// if ctx is done before it finishes.
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Host is the remote host commands run on, or "" for this machine
+	Host() string
+}
+
+// Local runs commands on this machine
+var Local Runner = local{}
+
+type local struct{}
+
+func (local) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return command(ctx, name, args...).Output()
+}
+
+// waitDelay is how long a killed command's output is still waited for.
+// Without it a grandchild holding the pipe open (say, a script's sleep)
+// keeps Output blocked after the command itself was killed.
+const waitDelay = 500 * time.Millisecond
+
+// command is exec.CommandContext, with waitDelay applied
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+func (local) Host() string { return "" }
+
+// PermissionDenied reports whether err is a command failing because it wasn't
+// allowed to do something, e.g. ps inspecting another user's process. Tools
+// report that on stderr rather than in their exit status, so it is told
+// from the message.
+func PermissionDenied(err error) bool {
+	if errors.Is(err, fs.ErrPermission) {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	stderr := strings.ToLower(string(exitErr.Stderr))
+	return strings.Contains(stderr, "operation not permitted") || strings.Contains(stderr, "permission denied")
+}
+
+// For returns the runner for host: Local for "", SSH otherwise
+func For(host string) Runner {
+	if host == "" {
+		return Local
+	}
+	return SSH{Target: host}
+}
+
+// SSH runs commands on Target (user@host) via ssh. It never prompts, so
+// key-based auth must already work.
+type SSH struct {
+	Target string
+}
+
+// sshExitError is the status ssh itself exits with when it can't connect
+const sshExitError = 255
+
+func (s SSH) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	words := make([]string, 0, len(args)+1)
+	words = append(words, ShellQuote(name))
+	for _, a := range args {
+		words = append(words, ShellQuote(a))
+	}
+
+	sshArgs := append([]string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=5"}, multiplexArgs()...)
+	sshArgs = append(sshArgs, s.Target, "--", strings.Join(words, " "))
+	out, err := command(ctx, "ssh", sshArgs...).Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case 127:
+			return out, fmt.Errorf("%s on %s: %w", name, s.Target, exec.ErrNotFound)
+		case sshExitError:
+			return out, fmt.Errorf("ssh %s: %s", s.Target, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+	}
+	return out, err
+}
+
+func (s SSH) Host() string { return s.Target }
+
+// multiplexArgs makes consecutive ssh calls to a host share one connection.
+// A scan runs several commands per session, and a fresh handshake for each
+// would dominate the scan time.
+func multiplexArgs() []string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	dir = filepath.Join(dir, "av", "ssh")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil
+	}
+	return []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(dir, "%C"),
+		"-o", "ControlPersist=60",
+	}
+}
+
+// ShellQuote single-quotes s for the shell if it contains anything special
+func ShellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"testing"
+)
+
+func TestPermissionDenied(t *testing.T) {
+	tests := []struct {
+		name, stderr string
+		want         bool
+	}{
+		{"ps", "ps: Operation not permitted", true},
+		{"pgrep", "pgrep: cannot open /proc/7/status: Permission denied", true},
+		{"no such process", "", false},
+		{"other failure", "pgrep: invalid option -- 'Q'", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A real failed command, so its stderr travels in an *exec.ExitError
+			_, err := Local.Output(context.Background(), "sh", "-c", fmt.Sprintf("echo %q >&2; exit 1", tt.stderr))
+			if err == nil {
+				t.Fatal("sh -c 'exit 1' succeeded")
+			}
+			if got := PermissionDenied(err); got != tt.want {
+				t.Errorf("PermissionDenied(%v, stderr %q) = %v, want %v", err, tt.stderr, got, tt.want)
+			}
+		})
+	}
+
+	others := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("open /proc/7/cwd: %w", fs.ErrPermission), true},
+		{exec.ErrNotFound, false},
+		{nil, false},
+	}
+	for _, tt := range others {
+		if got := PermissionDenied(tt.err); got != tt.want {
+			t.Errorf("PermissionDenied(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
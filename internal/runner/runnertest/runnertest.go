@@ -0,0 +1,79 @@
+// Package runnertest provides a scripted runner.Runner for tests
+package runnertest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Fake is a runner.Runner that answers commands from a script instead of
+// running them, and records every command it was asked to run. Commands
+// are matched by their words joined with single spaces, e.g.
+// "tmux list-panes -a".
+type Fake struct {
+	// HostName is what Host returns; "" for a local runner
+	HostName string
+	// Func, if set, answers commands On didn't script
+	Func func(cmdline string) ([]byte, error)
+
+	mu        sync.Mutex
+	responses map[string]response
+	calls     []string
+}
+
+type response struct {
+	out string
+	err error
+}
+
+// On scripts the result of cmdline, replacing any earlier one, and returns
+// f for chaining
+func (f *Fake) On(cmdline, out string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.responses == nil {
+		f.responses = make(map[string]response)
+	}
+	f.responses[cmdline] = response{out, err}
+	return f
+}
+
+// Output answers from the script, then Func; a command neither knows fails
+func (f *Fake) Output(_ context.Context, name string, args ...string) ([]byte, error) {
+	cmdline := strings.Join(append([]string{name}, args...), " ")
+	f.mu.Lock()
+	f.calls = append(f.calls, cmdline)
+	r, ok := f.responses[cmdline]
+	f.mu.Unlock()
+
+	if ok {
+		return []byte(r.out), r.err
+	}
+	if f.Func != nil {
+		return f.Func(cmdline)
+	}
+	return nil, fmt.Errorf("runnertest: unscripted command %q", cmdline)
+}
+
+// Host returns HostName
+func (f *Fake) Host() string { return f.HostName }
+
+// Calls returns the commands run so far, in order
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Count returns how many of the commands run so far start with prefix
+func (f *Fake) Count(prefix string) int {
+	n := 0
+	for _, c := range f.Calls() {
+		if strings.HasPrefix(c, prefix) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+// Package termcaps works out what the terminal av runs in can render
+package termcaps
+
+import (
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// ColorDepth is how many colors a terminal can show
+type ColorDepth int
+
+// Color depths, from none to 24-bit
+const (
+	ColorNone ColorDepth = iota
+	Color16
+	Color256
+	ColorTrue
+)
+
+func (d ColorDepth) String() string {
+	switch d {
+	case Color16:
+		return "16"
+	case Color256:
+		return "256"
+	case ColorTrue:
+		return "truecolor"
+	default:
+		return "none"
+	}
+}
+
+// MarshalText shows the depth by name in JSON
+func (d ColorDepth) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Caps is what the terminal can render, as far as its environment says
+type Caps struct {
+	// Term and Program are $TERM and $TERM_PROGRAM
+	Term    string `json:"term"`
+	Program string `json:"program,omitempty"`
+	// Colors is the color depth, ColorNone with NO_COLOR or TERM=dumb
+	Colors ColorDepth `json:"colors"`
+	// Unicode is unset for terminals known not to draw non-ASCII glyphs
+	Unicode bool `json:"unicode"`
+	// Multiplexer is set inside tmux or screen, which pass on only what
+	// their own config allows, whatever the outer terminal can do
+	Multiplexer bool `json:"multiplexer"`
+	// Width is how many columns stdout's terminal has; 0 if stdout isn't
+	// a terminal and $COLUMNS doesn't say. It's for doctor to show; tables
+	// keep fixed column widths whatever it is
+	Width int `json:"width,omitempty"`
+}
+
+// Detect probes the terminal av runs in
+func Detect() Caps {
+	return detect(os.Getenv)
+}
+
+// Programs known to render truecolor without saying so in COLORTERM
+var truecolorPrograms = []string{"iTerm.app", "WezTerm", "vscode", "ghostty", "Hyper"}
+
+// Terminals that can't draw anything beyond ASCII
+var asciiTerms = []string{"dumb", "linux", "vt100", "vt102", "vt220", "cons25"}
+
+func detect(getenv func(string) string) Caps {
+	c := Caps{
+		Term:    getenv("TERM"),
+		Program: getenv("TERM_PROGRAM"),
+		Width:   width(getenv),
+	}
+	c.Multiplexer = getenv("TMUX") != "" || getenv("STY") != "" ||
+		strings.HasPrefix(c.Term, "tmux") || strings.HasPrefix(c.Term, "screen")
+
+	colorTerm := strings.ToLower(getenv("COLORTERM"))
+	switch {
+	case getenv("NO_COLOR") != "" || c.Term == "dumb":
+		c.Colors = ColorNone
+	case colorTerm == "truecolor" || colorTerm == "24bit" || slices.Contains(truecolorPrograms, c.Program):
+		c.Colors = ColorTrue
+	case strings.Contains(c.Term, "256color"):
+		c.Colors = Color256
+	default:
+		c.Colors = Color16
+	}
+
+	c.Unicode = !slices.Contains(asciiTerms, c.Term) && utf8Locale(getenv)
+	return c
+}
+
+// utf8Locale reports whether the locale allows UTF-8. A locale that's unset,
+// C or POSIX counts, since containers often leave it there while their
+// terminal renders UTF-8 fine; one naming another charset doesn't.
+func utf8Locale(getenv func(string) string) bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		locale := getenv(name)
+		if locale == "" {
+			continue
+		}
+		if locale == "C" || locale == "POSIX" {
+			return true
+		}
+		lower := strings.ToLower(locale)
+		return strings.Contains(lower, "utf-8") || strings.Contains(lower, "utf8")
+	}
+	return true
+}
+
+// IsTerminal reports whether w writes to a terminal, rather than a file or
+// pipe
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(f.Fd())
+}
+
+// width returns stdout's terminal width, else $COLUMNS, else 0
+func width(getenv func(string) string) int {
+	if w, _, err := term.GetSize(os.Stdout.Fd()); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 0
+}
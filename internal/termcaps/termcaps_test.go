@@ -0,0 +1,58 @@
+package termcaps
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		colors      ColorDepth
+		unicode     bool
+		multiplexer bool
+	}{
+		{"plain xterm", map[string]string{"TERM": "xterm"}, Color16, true, false},
+		{"256 colors", map[string]string{"TERM": "xterm-256color"}, Color256, true, false},
+		{"COLORTERM", map[string]string{"TERM": "xterm-256color", "COLORTERM": "TrueColor"}, ColorTrue, true, false},
+		{"known program", map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "WezTerm"}, ColorTrue, true, false},
+		{"NO_COLOR", map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor", "NO_COLOR": "1"}, ColorNone, true, false},
+		{"dumb", map[string]string{"TERM": "dumb"}, ColorNone, false, false},
+		{"linux console", map[string]string{"TERM": "linux"}, Color16, false, false},
+		{"C locale", map[string]string{"TERM": "xterm", "LANG": "C"}, Color16, true, false},
+		{"Latin-1 locale", map[string]string{"TERM": "xterm", "LANG": "en_US.ISO-8859-1"}, Color16, false, false},
+		{"LC_ALL first", map[string]string{"TERM": "xterm", "LC_ALL": "en_US.UTF-8", "LANG": "en_US.ISO-8859-1"}, Color16, true, false},
+		{"TMUX", map[string]string{"TERM": "xterm-256color", "TMUX": "/tmp/tmux-1000/default,1,0"}, Color256, true, true},
+		{"TERM=tmux", map[string]string{"TERM": "tmux-256color"}, Color256, true, true},
+		{"TERM=screen", map[string]string{"TERM": "screen"}, Color16, true, true},
+		{"STY", map[string]string{"TERM": "xterm", "STY": "1234.pts-0.host"}, Color16, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := detect(func(name string) string { return tt.env[name] })
+			if c.Colors != tt.colors || c.Unicode != tt.unicode || c.Multiplexer != tt.multiplexer {
+				t.Errorf("detect = colors %s, unicode %v, multiplexer %v; want %s, %v, %v",
+					c.Colors, c.Unicode, c.Multiplexer, tt.colors, tt.unicode, tt.multiplexer)
+			}
+		})
+	}
+}
+
+func TestDetectWidthFromColumns(t *testing.T) {
+	if w := width(func(string) string { return "" }); w != 0 {
+		t.Skipf("stdout is a %d column terminal", w)
+	}
+	tests := []struct {
+		columns string
+		want    int
+	}{
+		{"", 0},
+		{"120", 120},
+		{"0", 0},
+		{"wide", 0},
+	}
+	for _, tt := range tests {
+		c := detect(func(name string) string { return map[string]string{"COLUMNS": tt.columns}[name] })
+		if c.Width != tt.want {
+			t.Errorf("COLUMNS=%q: Width = %d, want %d", tt.columns, c.Width, tt.want)
+		}
+	}
+}
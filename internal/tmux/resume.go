@@ -0,0 +1,252 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/version"
+)
+
+// resumeTemplates holds user-configured resume commands, by agent
+var resumeTemplates = make(map[string]string)
+
+// placeholderRegex matches {name} placeholders in a resume command template
+var placeholderRegex = regexp.MustCompile(`\{[a-z_]*\}`)
+
+// SetResumeCommand makes restarts relaunch an agent with template instead of
+// the built-in resume command. An empty template restores the default.
+func SetResumeCommand(agent, template string) error {
+	if template == "" {
+		delete(resumeTemplates, agent)
+		return nil
+	}
+	if err := ValidateResumeCommand(template); err != nil {
+		return fmt.Errorf("%s resume command: %w", agent, err)
+	}
+	resumeTemplates[agent] = template
+	return nil
+}
+
+// resumePlaceholders are the placeholders a resume command template may use
+var resumePlaceholders = []string{"{session_id}", "{tmux_session}", "{working_dir}"}
+
+// ValidateResumeCommand checks that a template only uses the placeholders
+// BuildResumeCommand knows: {session_id} (the agent's conversation ID),
+// {tmux_session} and {working_dir}
+func ValidateResumeCommand(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("empty command")
+	}
+	for _, p := range placeholderRegex.FindAllString(template, -1) {
+		if !slices.Contains(resumePlaceholders, p) {
+			return fmt.Errorf("unknown placeholder %s (want one of %s)", p, strings.Join(resumePlaceholders, ", "))
+		}
+	}
+	return nil
+}
+
+// BuildResumeCommand returns the shell command that relaunches a session's
+// agent and resumes its conversation: the configured template for the agent
+// if there is one, otherwise the built-in default run with the session's
+// ResumeBinary or the agent's binary. A template using {session_id} can't
+// be filled in for a session whose conversation isn't known.
+func BuildResumeCommand(s *process.Session) (string, error) {
+	if template, ok := resumeTemplate(s); ok {
+		if strings.Contains(template, "{session_id}") && s.ConversationID == "" {
+			return "", fmt.Errorf("%s: conversation ID unknown, so the resume command's {session_id} can't be filled in", s.Label())
+		}
+		return strings.NewReplacer(
+			"{session_id}", runner.ShellQuote(s.ConversationID),
+			"{tmux_session}", runner.ShellQuote(s.TmuxSession),
+			"{working_dir}", runner.ShellQuote(s.WorkingDir),
+		).Replace(template), nil
+	}
+
+	// Resume the exact conversation when we know it. Otherwise --continue
+	// resumes the most recent one in the current directory.
+	var args string
+	switch s.Agent {
+	case "claude":
+		args = "--continue"
+		if resumesByID(s) {
+			args = "--resume " + runner.ShellQuote(s.ConversationID)
+		}
+	case "codex":
+		args = "--continue"
+		if resumesByID(s) {
+			args = "resume " + runner.ShellQuote(s.ConversationID)
+		}
+	case "gemini":
+		args = "--resume latest"
+	default:
+		return "", fmt.Errorf("unknown agent: %s", s.Agent)
+	}
+
+	// Binary overrides only apply locally; remote hosts use their PATH
+	bin := s.Agent
+	if s.ResumeBinary != "" {
+		bin = s.ResumeBinary
+	} else if s.Host == "" {
+		bin = version.Binary(s.Agent)
+	}
+
+	words := []string{runner.ShellQuote(bin)}
+	for _, f := range launchFlags(s.Agent, s.Command) {
+		words = append(words, runner.ShellQuote(f))
+	}
+	return strings.Join(words, " ") + " " + args, nil
+}
+
+// resumeTemplate returns the configured resume command for the session's
+// agent. A session given an explicit ResumeBinary ignores it, since the
+// template names its own binary.
+func resumeTemplate(s *process.Session) (string, bool) {
+	if s.ResumeBinary != "" {
+		return "", false
+	}
+	template, ok := resumeTemplates[s.Agent]
+	return template, ok
+}
+
+// resumesByID reports whether the default resume command would resume the
+// session's conversation by ID. The transcript is checked right before
+// use, since it may have been deleted since the scan.
+func resumesByID(s *process.Session) bool {
+	_, templated := resumeTemplate(s)
+	return !templated && (s.Agent == "claude" || s.Agent == "codex") && s.ConversationID != "" && process.TranscriptExists(s)
+}
+
+// resumeCheckDelay is how long a resume gets to fail before it's checked
+var resumeCheckDelay = 3 * time.Second
+
+// launchResumed relaunches the session's agent with launch, which runs a
+// command in its pane, and returns the last command it launched. If that
+// resumed a conversation by ID but no agent is running in the pane shortly
+// after, the ID was stale, so it launches again with --continue.
+func launchResumed(ctx context.Context, r runner.Runner, s *process.Session, launch func(cmd string) error) (string, error) {
+	cmd, err := BuildResumeCommand(s)
+	if err != nil {
+		return "", err
+	}
+	if err := launch(cmd); err != nil {
+		return cmd, err
+	}
+	if !resumesByID(s) || s.TmuxPane == "" {
+		return cmd, nil
+	}
+
+	logStep(ctx, "check agent resumed")
+	if sleep(ctx, resumeCheckDelay) != nil {
+		return cmd, nil // Launched; there's just no time left to check it
+	}
+	if agentInPane(ctx, r, s.Agent, s.TmuxPane) {
+		return cmd, nil
+	}
+	logStep(ctx, "retry with --continue")
+	fallback := *s
+	fallback.ConversationID = ""
+	cmd, err = BuildResumeCommand(&fallback)
+	if err != nil {
+		return "", err
+	}
+	if err := launch(cmd); err != nil {
+		return cmd, fmt.Errorf("retry with --continue: %w", err)
+	}
+	return cmd, nil
+}
+
+// agentInPane reports whether agent is running in the tmux pane with ID pane
+func agentInPane(ctx context.Context, r runner.Runner, agent, pane string) bool {
+	sessions, err := process.FindAgentSessionsContext(ctx, r)
+	if err != nil {
+		return true // Can't tell; don't launch a second copy
+	}
+	panes, _ := GetPanesContext(ctx, r)
+	process.EnrichWithTmux(sessions, panes)
+	for _, s := range sessions {
+		if s.Agent == agent && s.TmuxPane == pane {
+			return true
+		}
+	}
+	return false
+}
+
+// agentFlags describes an agent's command-line flags well enough to carry
+// them over a restart
+type agentFlags struct {
+	// noValue flags are booleans, so a following word isn't theirs
+	noValue map[string]bool
+	// resume flags select or start a conversation and would conflict with
+	// the resume args; the value is whether the flag may take a value
+	resume map[string]bool
+}
+
+var launchFlagSpecs = map[string]agentFlags{
+	"claude": {
+		noValue: flagSet("--dangerously-skip-permissions", "--allow-dangerously-skip-permissions", "--verbose", "--ide", "--strict-mcp-config", "--chrome", "--no-chrome"),
+		resume:  map[string]bool{"--continue": false, "-c": false, "--resume": true, "-r": true, "--session-id": true, "--fork-session": false, "--print": false, "-p": false},
+	},
+	"codex": {
+		noValue: flagSet("--full-auto", "--dangerously-bypass-approvals-and-sandbox", "--search", "--oss"),
+		resume:  map[string]bool{"--continue": false, "--last": false},
+	},
+	"gemini": {
+		noValue: flagSet("--yolo", "-y", "--sandbox", "-s", "--debug", "-d", "--checkpointing", "-c", "--screen-reader"),
+		resume:  map[string]bool{"--resume": true, "-r": true, "--prompt": true, "-p": true, "--prompt-interactive": true, "-i": true},
+	},
+}
+
+func flagSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+// launchFlags extracts the flags an agent was launched with from its ps
+// command line, past any launcher such as npx, dropping resume/prompt flags
+// and positional arguments (an initial prompt or subcommand) that shouldn't
+// be replayed. ps doesn't keep quoting, so a value containing spaces is
+// carried over only in part.
+func launchFlags(agent, command string) []string {
+	spec, ok := launchFlagSpecs[agent]
+	if !ok {
+		return nil
+	}
+	words := process.AgentArgs(agent, command)
+
+	var flags []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if w == "--" {
+			break // Everything after is positional
+		}
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			continue // Positional: prompt or subcommand
+		}
+
+		name, _, hasValue := strings.Cut(w, "=")
+		nextIsValue := !hasValue && i+1 < len(words) && !strings.HasPrefix(words[i+1], "-")
+
+		if takesValue, ok := spec.resume[name]; ok {
+			if takesValue && nextIsValue {
+				i++
+			}
+			continue
+		}
+
+		flags = append(flags, w)
+		if nextIsValue && !spec.noValue[name] {
+			flags = append(flags, words[i+1])
+			i++
+		}
+	}
+	return flags
+}
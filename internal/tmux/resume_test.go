@@ -0,0 +1,126 @@
+package tmux
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+func TestBuildResumeCommandTemplate(t *testing.T) {
+	t.Cleanup(func() { SetResumeCommand("claude", "") })
+	if err := SetResumeCommand("claude", "cd {working_dir} && claude --resume {session_id} # {tmux_session}"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &process.Session{Agent: "claude", TmuxSession: "api", WorkingDir: "/repos/my api", ConversationID: "0b5e6f1c"}
+	got, err := BuildResumeCommand(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "cd '/repos/my api' && claude --resume 0b5e6f1c # api"; got != want {
+		t.Errorf("BuildResumeCommand = %q, want %q", got, want)
+	}
+
+	// The tmux session name is no stand-in for a conversation ID
+	s.ConversationID = ""
+	if got, err := BuildResumeCommand(s); err == nil || !strings.Contains(err.Error(), "{session_id}") {
+		t.Errorf("BuildResumeCommand without a conversation ID = %q, %v; want an error", got, err)
+	}
+}
+
+func TestValidateResumeCommand(t *testing.T) {
+	tests := []struct {
+		template string
+		ok       bool
+	}{
+		{"claude --continue", true},
+		{"claude --resume {session_id}", true},
+		{"cd {working_dir} && wrapper {tmux_session}", true},
+		{"", false},
+		{"   ", false},
+		{"claude --resume {conversation}", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateResumeCommand(tt.template); (err == nil) != tt.ok {
+			t.Errorf("ValidateResumeCommand(%q) = %v, want ok %v", tt.template, err, tt.ok)
+		}
+	}
+}
+
+func TestLaunchFlags(t *testing.T) {
+	tests := []struct {
+		name, agent, command string
+		want                 []string
+	}{
+		{"bare", "claude", "claude", nil},
+		{"model", "claude", "claude --model opus", []string{"--model", "opus"}},
+		{"model equals", "claude", "/usr/local/bin/claude --model=sonnet", []string{"--model=sonnet"}},
+		{"boolean before prompt", "claude", "claude --dangerously-skip-permissions fix the tests", []string{"--dangerously-skip-permissions"}},
+		{"continue dropped", "claude", "claude --continue --model opus", []string{"--model", "opus"}},
+		{"resume id dropped", "claude", "claude --resume 0b5e6f1c --verbose", []string{"--verbose"}},
+		{"bare resume dropped", "claude", "claude -r --model opus", []string{"--model", "opus"}},
+		{"print dropped", "claude", "claude -p --output-format json", []string{"--output-format", "json"}},
+		{"after --", "claude", "claude --model opus -- --verbose", []string{"--model", "opus"}},
+		{"codex", "codex", "codex --full-auto -m gpt-5 fix it", []string{"--full-auto", "-m", "gpt-5"}},
+		{"codex last dropped", "codex", "codex --last --search", []string{"--search"}},
+		{"gemini", "gemini", "gemini --yolo -m gemini-2.5-pro", []string{"--yolo", "-m", "gemini-2.5-pro"}},
+		{"gemini prompt dropped", "gemini", "gemini -i 'hello' --sandbox", []string{"--sandbox"}},
+		{"npx", "codex", "npx @openai/codex@0.46.0 --full-auto", []string{"--full-auto"}},
+		{"npx flags not replayed", "claude", "npx -y @anthropic-ai/claude-code@latest --model opus", []string{"--model", "opus"}},
+		{"bunx package", "codex", "bunx -p @openai/codex codex --search", []string{"--search"}},
+		{"npm exec", "gemini", "npm exec @google/gemini-cli --yolo", []string{"--yolo"}},
+		{"unknown agent", "aider", "aider --model gpt-4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := launchFlags(tt.agent, tt.command)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("launchFlags(%q, %q) = %q, want %q", tt.agent, tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartSessionFallsBackToContinue(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	const id = "0b7c3a4e-5f61-4d2a-9e8b-1c2d3e4f5a6b"
+	projectDir := filepath.Join(home, ".claude", "projects", "-repos-api")
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, id+".jsonl"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(wait, check time.Duration) { exitWait, resumeCheckDelay = wait, check }(exitWait, resumeCheckDelay)
+	exitWait, resumeCheckDelay = 0, 0
+
+	// No agent turns up in ps after the resume, as when the ID was stale
+	r := &runnertest.Fake{Func: func(string) ([]byte, error) { return nil, nil }}
+	s := &process.Session{Agent: "claude", TmuxSession: "api", TmuxPane: "%1", WorkingDir: "/repos/api", ConversationID: id, ResumeBinary: "claude"}
+	cmd, err := RestartSession(r, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != "claude --continue" {
+		t.Errorf("cmd = %q, want the --continue fallback", cmd)
+	}
+
+	var launched []string
+	for _, c := range r.Calls() {
+		if k, ok := strings.CutPrefix(c, "tmux send-keys -t api "); ok && strings.HasPrefix(k, "claude ") {
+			launched = append(launched, k)
+		}
+	}
+	want := []string{"claude --resume " + id, "claude --continue"}
+	if !slices.Equal(launched, want) {
+		t.Errorf("launched %q\nwant %q", launched, want)
+	}
+}
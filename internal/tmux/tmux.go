@@ -2,6 +2,8 @@
 package tmux
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"regexp"
@@ -9,21 +11,38 @@ import (
 	"time"
 
 	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
 )
 
-// IsAvailable checks if tmux is running
-func IsAvailable() bool {
-	_, err := exec.Command("tmux", "list-sessions").Output()
+// IsInstalled checks if the tmux binary exists, whether or not a server is
+// running
+func IsInstalled(r runner.Runner) bool {
+	_, err := r.Output(context.Background(), "tmux", "-V")
 	return err == nil
 }
 
-// GetPanes returns a map of TTY -> TmuxPane for all tmux panes
-func GetPanes() map[string]process.TmuxPane {
+// IsAvailable checks if a tmux server is running, even one with no
+// sessions. Unlike list-sessions, which some tmux releases fail on an empty
+// server, display-message only needs a server to answer.
+func IsAvailable(r runner.Runner) bool {
+	_, err := r.Output(context.Background(), "tmux", "display-message", "-p", "")
+	return err == nil
+}
+
+// GetPanes returns a map of TTY -> TmuxPane for all tmux panes. The error
+// wraps exec.ErrNotFound if tmux isn't installed; any other error (usually
+// no tmux server running) just means there are no panes.
+func GetPanes(r runner.Runner) (map[string]process.TmuxPane, error) {
+	return GetPanesContext(context.Background(), r)
+}
+
+// GetPanesContext is GetPanes, giving up when ctx is done
+func GetPanesContext(ctx context.Context, r runner.Runner) (map[string]process.TmuxPane, error) {
 	panes := make(map[string]process.TmuxPane)
 
-	out, err := exec.Command("tmux", "list-panes", "-a", "-F", "#{pane_tty}:#{session_name}:#{pane_current_path}").Output()
+	out, err := r.Output(ctx, "tmux", "list-panes", "-a", "-F", "#{pane_id}:#{pane_tty}:#{session_name}:#{session_attached}:#{pane_current_path}")
 	if err != nil {
-		return panes
+		return panes, err
 	}
 
 	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
@@ -31,113 +50,326 @@ func GetPanes() map[string]process.TmuxPane {
 			continue
 		}
 
-		parts := strings.SplitN(line, ":", 3)
-		if len(parts) < 3 {
+		// The path goes last since it may itself contain colons
+		parts := strings.SplitN(line, ":", 5)
+		if len(parts) < 5 {
 			continue
 		}
 
-		panes[parts[0]] = process.TmuxPane{
-			TTY:     parts[0],
-			Session: parts[1],
-			Path:    parts[2],
+		tty := process.NormalizeTTY(parts[1])
+		if tty == "" {
+			continue
+		}
+		// A pane's path goes stale when its directory is deleted
+		path, missing := process.CheckWorkingDir(parts[4], r.Host() == "")
+		// session_attached counts the clients attached to the session
+		panes[tty] = process.TmuxPane{
+			ID:          parts[0],
+			TTY:         tty,
+			Session:     parts[2],
+			Path:        path,
+			PathMissing: missing,
+			Attached:    parts[3] != "" && parts[3] != "0",
 		}
 	}
 
-	return panes
+	return panes, nil
 }
 
 // CapturePane captures the last N lines from a tmux pane
-func CapturePane(sessionName string, lines int) (string, error) {
-	out, err := exec.Command("tmux", "capture-pane", "-t", sessionName, "-p", "-S", fmt.Sprintf("-%d", lines)).Output()
+func CapturePane(r runner.Runner, sessionName string, lines int) (string, error) {
+	return CapturePaneContext(context.Background(), r, sessionName, lines)
+}
+
+// CapturePaneContext is CapturePane, giving up when ctx is done
+func CapturePaneContext(ctx context.Context, r runner.Runner, sessionName string, lines int) (string, error) {
+	out, err := r.Output(ctx, "tmux", "capture-pane", "-t", sessionName, "-p", "-S", fmt.Sprintf("-%d", lines))
 	if err != nil {
 		return "", err
 	}
 	return string(out), nil
 }
 
-// Patterns for detecting active work
-var (
+// ActiveWorkLines is how many lines of scrollback, above what's on screen,
+// active-work detection captures
+const ActiveWorkLines = 20
+
+// activeWorkPattern is a sign of work in progress in a pane
+type activeWorkPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Patterns for detecting active work, clearest signal first
+var activeWorkPatterns = []activeWorkPattern{
 	// Active operation - shows "ctrl+c to interrupt"
-	ctrlCPattern = regexp.MustCompile(`ctrl\+c to interrupt`)
+	{"ctrl-c", regexp.MustCompile(`ctrl\+c to interrupt`)},
 	// Running indicator with ellipsis (… or ...)
-	runningPattern = regexp.MustCompile(`Running[….]+`)
+	{"running", regexp.MustCompile(`Running[….]+`)},
 	// Active spinner patterns
-	spinnerPattern = regexp.MustCompile(`[⏺✻].*(?:Thinking|Reading|Writing|Manifesting|Editing)[….]*`)
-)
+	{"spinner", regexp.MustCompile(`[⏺✻].*(?:Thinking|Reading|Writing|Manifesting|Editing)[….]*`)},
+}
 
-// HasActiveWork checks if the session has background tasks running
-func HasActiveWork(sessionName string) bool {
-	content, err := CapturePane(sessionName, 20)
-	if err != nil {
-		return false
+// ActiveWorkMatch reports which active-work pattern, if any, captured pane
+// content matches: the pattern's name and the text it matched, or "", ""
+func ActiveWorkMatch(content string) (pattern, match string) {
+	for _, p := range activeWorkPatterns {
+		if m := p.re.FindString(content); m != "" {
+			return p.name, m
+		}
 	}
+	return "", ""
+}
 
-	// Check for active work indicators - only the last 20 lines
-	// The "ctrl+c to interrupt" is the clearest signal of active work
-	if ctrlCPattern.MatchString(content) {
-		return true
+// HasActiveWork checks if the session has background tasks running
+func HasActiveWork(r runner.Runner, sessionName string) bool {
+	return HasActiveWorkContext(context.Background(), r, sessionName)
+}
+
+// HasActiveWorkContext is HasActiveWork, giving up when ctx is done. A
+// pane that can't be captured counts as idle; ActiveWorkContext tells
+// that apart.
+func HasActiveWorkContext(ctx context.Context, r runner.Runner, sessionName string) bool {
+	busy, _ := ActiveWorkContext(ctx, r, sessionName)
+	return busy
+}
+
+// captureAttempts is how often active-work detection tries to capture a
+// pane before giving up on telling whether it's busy
+const captureAttempts = 2
+
+// ErrCaptureUnsupported is returned by ActiveWorkContext when panes can't
+// be captured at all: tmux isn't installed, or it refuses capture-pane
+var ErrCaptureUnsupported = errors.New("capture-pane unsupported")
+
+// ActiveWorkContext reports whether the session's pane shows work in
+// progress. A session that has gone away since it was found isn't busy.
+// It returns an error if the pane couldn't be captured even on a retry,
+// when whether the session is busy is unknown; one wrapping
+// ErrCaptureUnsupported means no other pane on r's host can be captured
+// either, so there's no point trying.
+func ActiveWorkContext(ctx context.Context, r runner.Runner, sessionName string) (bool, error) {
+	var err error
+	for attempt := 0; attempt < captureAttempts; attempt++ {
+		if attempt > 0 {
+			if serr := sleep(ctx, sendKeysBackoff); serr != nil {
+				break
+			}
+		}
+		var content string
+		if content, err = CapturePaneContext(ctx, r, sessionName, ActiveWorkLines); err == nil {
+			pattern, _ := ActiveWorkMatch(content)
+			return pattern != "", nil
+		}
+		switch msg := tmuxError(err); {
+		case strings.Contains(msg, "can't find"), strings.Contains(msg, "no server running"):
+			return false, nil
+		case errors.Is(err, exec.ErrNotFound), strings.Contains(msg, "unknown command"), strings.Contains(msg, "not allowed"):
+			return false, fmt.Errorf("%w: %w", ErrCaptureUnsupported, err)
+		}
 	}
-	if runningPattern.MatchString(content) {
-		return true
+	return false, fmt.Errorf("capture-pane: %w", err)
+}
+
+// tmuxError returns what a failed tmux command printed to stderr, in lower
+// case, or "" if it didn't get to run
+func tmuxError(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
 	}
-	if spinnerPattern.MatchString(content) {
-		return true
+	return strings.ToLower(string(exitErr.Stderr))
+}
+
+// IsAttached reports whether a client is attached to the tmux session
+func IsAttached(r runner.Runner, sessionName string) bool {
+	return IsAttachedContext(context.Background(), r, sessionName)
+}
+
+// IsAttachedContext is IsAttached, giving up when ctx is done
+func IsAttachedContext(ctx context.Context, r runner.Runner, sessionName string) bool {
+	out, err := r.Output(ctx, "tmux", "display-message", "-p", "-t", sessionName, "#{session_attached}")
+	if err != nil {
+		return false
 	}
-	return false
+	n := strings.TrimSpace(string(out))
+	return n != "" && n != "0"
+}
+
+// RestartSession sends exit to a session's tmux pane, waits, then relaunches
+// the agent with its resume command, for Codex after a cd back to the
+// session's working dir. It returns the command it sent.
+func RestartSession(r runner.Runner, s *process.Session) (string, error) {
+	return RestartSessionContext(context.Background(), r, s)
 }
 
-// RestartSession sends exit to a tmux session, waits, then resumes with --continue
-func RestartSession(sessionName string, agent string) error {
+// RestartSessionContext is RestartSession, stopping between steps once ctx
+// is done
+func RestartSessionContext(ctx context.Context, r runner.Runner, s *process.Session) (string, error) {
+	sessionName := s.TmuxSession
+
 	// Send Ctrl+C multiple times to:
 	// 1. Interrupt any running operation
 	// 2. Clear any suggested text in the prompt
+	logStep(ctx, "send Ctrl+C x3")
 	for i := 0; i < 3; i++ {
-		if err := sendKeys(sessionName, "C-c"); err != nil {
-			return fmt.Errorf("failed to send Ctrl+C: %w", err)
+		if err := sendKeys(ctx, r, sessionName, "C-c"); err != nil {
+			return "", fmt.Errorf("failed to send Ctrl+C: %w", err)
+		}
+		if err := sleep(ctx, 200*time.Millisecond); err != nil {
+			return "", err
 		}
-		time.Sleep(200 * time.Millisecond)
 	}
 
 	// Clear the input line (Ctrl+U) to remove any partial text
-	if err := sendKeys(sessionName, "C-u"); err != nil {
-		return fmt.Errorf("failed to send Ctrl+U: %w", err)
+	logStep(ctx, "send Ctrl+U")
+	if err := sendKeys(ctx, r, sessionName, "C-u"); err != nil {
+		return "", fmt.Errorf("failed to send Ctrl+U: %w", err)
+	}
+	if err := sleep(ctx, 100*time.Millisecond); err != nil {
+		return "", err
+	}
+
+	// Send exit command. If Enter doesn't go through, clear "exit" off the
+	// prompt again so the agent is left as it was.
+	logStep(ctx, "send exit")
+	if err := sendKeys(ctx, r, sessionName, "exit"); err != nil {
+		return "", fmt.Errorf("failed to send exit: %w", err)
+	}
+	if err := sendKeys(ctx, r, sessionName, "Enter"); err != nil {
+		_ = sendKeys(ctx, r, sessionName, "C-u")
+		return "", fmt.Errorf("failed to send Enter after exit: %w", err)
+	}
+
+	// Wait for process to exit. From here on the agent is gone, so a
+	// failure says how to get it back.
+	logStep(ctx, "wait for exit")
+	if err := sleep(ctx, exitWait); err != nil {
+		return "", exitedError(s, err)
 	}
-	time.Sleep(100 * time.Millisecond)
 
-	// Send exit command
-	if err := sendKeys(sessionName, "exit"); err != nil {
-		return fmt.Errorf("failed to send exit: %w", err)
+	// Codex's --continue picks the conversation by the shell's cwd, which
+	// may have wandered from the session's working dir since it launched
+	if s.Agent == "codex" && s.WorkingDir != "" && !s.WorkingDirMissing {
+		logStep(ctx, "send cd")
+		if err := sendKeys(ctx, r, sessionName, "cd "+runner.ShellQuote(s.WorkingDir)); err != nil {
+			return "", exitedError(s, fmt.Errorf("failed to send cd: %w", err))
+		}
+		if err := sendKeys(ctx, r, sessionName, "Enter"); err != nil {
+			_ = sendKeys(ctx, r, sessionName, "C-u")
+			return "", exitedError(s, fmt.Errorf("failed to send Enter after cd: %w", err))
+		}
 	}
-	if err := sendKeys(sessionName, "Enter"); err != nil {
-		return fmt.Errorf("failed to send Enter: %w", err)
+
+	cmd, err := launchResumed(ctx, r, s, func(cmd string) error {
+		logStep(ctx, "send resume command")
+		if err := sendKeys(ctx, r, sessionName, cmd); err != nil {
+			return fmt.Errorf("failed to send resume command: %w", err)
+		}
+		if err := sendKeys(ctx, r, sessionName, "Enter"); err != nil {
+			_ = sendKeys(ctx, r, sessionName, "C-u")
+			return fmt.Errorf("failed to send Enter after resume command: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return cmd, exitedError(s, err)
 	}
+	return cmd, nil
+}
 
-	// Wait for process to exit
-	time.Sleep(2 * time.Second)
+// exitWait is how long RestartSession gives the agent to exit before
+// relaunching it
+var exitWait = 2 * time.Second
 
-	// Build resume command - use --continue which resumes the most recent
-	// session in the current directory (handled correctly by Claude)
-	var cmd string
-	switch agent {
-	case "claude":
-		cmd = "claude --continue"
-	case "codex":
-		cmd = "codex --continue"
-	default:
-		return fmt.Errorf("unknown agent: %s", agent)
+// exitedError reports a restart that failed after the agent had already
+// exited, with the command to resume it by hand
+func exitedError(s *process.Session, err error) error {
+	cmd, cerr := BuildResumeCommand(s)
+	if cerr != nil {
+		return fmt.Errorf("agent exited but wasn't resumed: %w", err)
 	}
+	return fmt.Errorf("agent exited but wasn't resumed (run %q in the pane): %w", cmd, err)
+}
 
-	if err := sendKeys(sessionName, cmd); err != nil {
-		return fmt.Errorf("failed to send command: %w", err)
+// RespawnSession kills the session's pane and relaunches the agent in the
+// same pane with its resume command, keeping the window name and layout.
+// Unlike RestartSession it doesn't need the agent to respond to keys. It
+// returns the command the pane was respawned with.
+func RespawnSession(r runner.Runner, s *process.Session) (string, error) {
+	return RespawnSessionContext(context.Background(), r, s)
+}
+
+// RespawnSessionContext is RespawnSession, giving up when ctx is done
+func RespawnSessionContext(ctx context.Context, r runner.Runner, s *process.Session) (string, error) {
+	if s.TmuxPane == "" {
+		return "", fmt.Errorf("no tmux pane known for %s", s.TmuxSession)
 	}
-	if err := sendKeys(sessionName, "Enter"); err != nil {
-		return fmt.Errorf("failed to send Enter: %w", err)
+	return launchResumed(ctx, r, s, func(cmd string) error {
+		logStep(ctx, "respawn pane")
+		args := []string{"respawn-pane", "-k", "-t", s.TmuxPane}
+		if s.WorkingDir != "" && !s.WorkingDirMissing {
+			args = append(args, "-c", s.WorkingDir)
+		}
+		// Drop back to a shell when the agent exits, as after RestartSession
+		args = append(args, cmd+`; exec "${SHELL:-/bin/sh}"`)
+		if _, err := r.Output(ctx, "tmux", args...); err != nil {
+			return fmt.Errorf("failed to respawn pane: %w", err)
+		}
+		return nil
+	})
+}
+
+// send-keys is retried a few times, with growing pauses, since a pane can be
+// briefly unavailable (e.g. mid-resize) and giving up would leave a restart
+// half done
+const (
+	sendKeysAttempts = 3
+	sendKeysBackoff  = 100 * time.Millisecond
+)
+
+func sendKeys(ctx context.Context, r runner.Runner, sessionName string, keys string) error {
+	var err error
+	for attempt := 0; attempt < sendKeysAttempts; attempt++ {
+		if attempt > 0 {
+			if serr := sleep(ctx, sendKeysBackoff<<(attempt-1)); serr != nil {
+				return err
+			}
+		}
+		_, err = r.Output(ctx, "tmux", "send-keys", "-t", sessionName, keys)
+		// No point retrying without tmux
+		if err == nil || errors.Is(err, exec.ErrNotFound) {
+			return err
+		}
 	}
+	return fmt.Errorf("after %d attempts: %w", sendKeysAttempts, err)
+}
+
+// stepsKey is the context key WithSteps stores its callback under
+type stepsKey struct{}
 
-	return nil
+// WithSteps returns a copy of ctx under which restarting a session reports
+// each step it takes to step as it starts it, e.g. "send exit", so a
+// failure can be traced to the step it happened in
+func WithSteps(ctx context.Context, step func(string)) context.Context {
+	return context.WithValue(ctx, stepsKey{}, step)
 }
 
-func sendKeys(sessionName string, keys string) error {
-	_, err := exec.Command("tmux", "send-keys", "-t", sessionName, keys).Output()
-	return err
+// logStep reports a step to the callback set with WithSteps, if any
+func logStep(ctx context.Context, step string) {
+	if f, ok := ctx.Value(stepsKey{}).(func(string)); ok {
+		f(step)
+	}
+}
+
+// sleep waits for d, returning ctx's error instead if it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
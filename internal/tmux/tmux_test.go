@@ -0,0 +1,269 @@
+package tmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/runner"
+	"github.com/buddyh/av/internal/runner/runnertest"
+)
+
+// listPanes is the command GetPanes runs
+const listPanes = "tmux list-panes -a -F #{pane_id}:#{pane_tty}:#{session_name}:#{session_attached}:#{pane_current_path}"
+
+func TestGetPanes(t *testing.T) {
+	dir := t.TempDir()
+	out := fmt.Sprintf(`%%0:/dev/pts/1:api:1:%[1]s
+%%1:/dev/pts/2:web:0:%[1]s/with:colon
+%%2:?:detached:0:%[1]s
+%%3:/dev/pts/4:gone:2:%[1]s/deleted
+
+`, dir)
+	r := (&runnertest.Fake{}).On(listPanes, out, nil)
+
+	panes, err := GetPanes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]process.TmuxPane{
+		"/dev/pts/1": {ID: "%0", TTY: "/dev/pts/1", Session: "api", Path: dir, Attached: true},
+		"/dev/pts/2": {ID: "%1", TTY: "/dev/pts/2", Session: "web", Path: dir + "/with:colon", PathMissing: true},
+		"/dev/pts/4": {ID: "%3", TTY: "/dev/pts/4", Session: "gone", Path: dir + "/deleted", PathMissing: true, Attached: true},
+	}
+	if len(panes) != len(want) {
+		t.Errorf("got %d panes, want %d: %+v", len(panes), len(want), panes)
+	}
+	for tty, w := range want {
+		if got := panes[tty]; got != w {
+			t.Errorf("pane %s = %+v, want %+v", tty, got, w)
+		}
+	}
+}
+
+func TestGetPanesRemoteKeepsPaths(t *testing.T) {
+	r := (&runnertest.Fake{HostName: "dev@box"}).On(listPanes, "%0:/dev/pts/1:api:0:/home/dev/api\n", nil)
+	panes, err := GetPanes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Remote paths can't be checked on this machine's disk
+	if p := panes["/dev/pts/1"]; p.Path != "/home/dev/api" || p.PathMissing {
+		t.Errorf("remote pane = %+v, want path kept and not missing", p)
+	}
+}
+
+func TestGetPanesErrors(t *testing.T) {
+	notFound := fmt.Errorf("tmux: %w", exec.ErrNotFound)
+	r := (&runnertest.Fake{}).On(listPanes, "", notFound)
+	panes, err := GetPanes(r)
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("err = %v, want exec.ErrNotFound", err)
+	}
+	if panes == nil || len(panes) != 0 {
+		t.Errorf("panes = %v, want an empty map", panes)
+	}
+}
+
+func TestIsAvailable(t *testing.T) {
+	const probe = "tmux display-message -p "
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server with sessions", nil, true},
+		{"no server", errors.New("exit status 1"), false},
+		{"no tmux", exec.ErrNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := (&runnertest.Fake{}).On(probe, "\n", tt.err)
+			if got := IsAvailable(r); got != tt.want {
+				t.Errorf("IsAvailable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIsAvailableEmptyServer runs the real tmux against a private socket
+// dir, with no server and then with a server that has no sessions
+func TestIsAvailableEmptyServer(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+
+	if IsAvailable(runner.Local) {
+		t.Error("IsAvailable with no server = true, want false")
+	}
+
+	start := exec.Command("tmux", "start-server", ";", "set-option", "-g", "exit-empty", "off")
+	if out, err := start.CombinedOutput(); err != nil {
+		t.Skipf("can't start a tmux server: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+
+	if !IsAvailable(runner.Local) {
+		t.Error("IsAvailable with an empty server = false, want true")
+	}
+}
+
+func TestSendKeysRetries(t *testing.T) {
+	const cmdline = "tmux send-keys -t api Enter"
+	busy := errors.New("exit status 1")
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"first try", 0, busy, 1, false},
+		{"after a retry", 1, busy, 2, false},
+		{"last attempt", sendKeysAttempts - 1, busy, sendKeysAttempts, false},
+		{"gives up", sendKeysAttempts, busy, sendKeysAttempts, true},
+		{"no tmux", 1, exec.ErrNotFound, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			r := &runnertest.Fake{Func: func(got string) ([]byte, error) {
+				if got != cmdline {
+					t.Fatalf("ran %q, want %q", got, cmdline)
+				}
+				calls++
+				if calls <= tt.failures {
+					return nil, tt.err
+				}
+				return nil, nil
+			}}
+			err := sendKeys(context.Background(), r, "api", "Enter")
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("sendKeys = %v, want error %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("send-keys ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSendKeysStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &runnertest.Fake{Func: func(string) ([]byte, error) {
+		cancel()
+		return nil, errors.New("exit status 1")
+	}}
+	if err := sendKeys(ctx, r, "api", "Enter"); err == nil {
+		t.Error("sendKeys = nil, want the failed attempt's error")
+	}
+	if n := len(r.Calls()); n != 1 {
+		t.Errorf("send-keys ran %d times after cancel, want 1", n)
+	}
+}
+
+func TestRestartSessionCdsForCodex(t *testing.T) {
+	dir := "/repos/it's here"
+	tests := []struct {
+		name   string
+		s      process.Session
+		wantCd bool
+	}{
+		{"codex", process.Session{Agent: "codex", TmuxSession: "api", WorkingDir: dir}, true},
+		{"codex, dir deleted", process.Session{Agent: "codex", TmuxSession: "api", WorkingDir: dir, WorkingDirMissing: true}, false},
+		{"codex, dir unknown", process.Session{Agent: "codex", TmuxSession: "api"}, false},
+		{"claude", process.Session{Agent: "claude", TmuxSession: "api", WorkingDir: dir}, false},
+	}
+	defer func(wait time.Duration) { exitWait = wait }(exitWait)
+	exitWait = 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &runnertest.Fake{Func: func(string) ([]byte, error) { return nil, nil }}
+			cmd, err := RestartSession(r, &tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			for _, c := range r.Calls() {
+				k, ok := strings.CutPrefix(c, "tmux send-keys -t api ")
+				if !ok {
+					t.Fatalf("ran %q, want only send-keys to api", c)
+				}
+				keys = append(keys, k)
+			}
+			want := []string{"C-c", "C-c", "C-c", "C-u", "exit", "Enter"}
+			if tt.wantCd {
+				want = append(want, `cd '/repos/it'\''s here'`, "Enter")
+			}
+			want = append(want, cmd, "Enter")
+			if !slices.Equal(keys, want) {
+				t.Errorf("sent keys %q\nwant %q", keys, want)
+			}
+		})
+	}
+}
+
+// exitError returns the error of a command that failed printing stderr, as
+// tmux does when it refuses one
+func exitError(t *testing.T, stderr string) error {
+	t.Helper()
+	_, err := exec.Command("sh", "-c", `echo "$0" >&2; exit 1`, stderr).Output()
+	if err == nil {
+		t.Fatal("sh -c 'exit 1' succeeded")
+	}
+	return err
+}
+
+func TestActiveWork(t *testing.T) {
+	const capture = "tmux capture-pane -t api -p -S -20"
+	tests := []struct {
+		name            string
+		results         []error // each attempt's error; past the end, success
+		content         string
+		wantBusy        bool
+		wantErr         bool
+		wantUnsupported bool
+		wantCalls       int
+	}{
+		{"busy", nil, "✻ Thinking…\n", true, false, false, 1},
+		{"idle", nil, "> \n", false, false, false, 1},
+		{"flaky", []error{exitError(t, "")}, "esc to interrupt · ctrl+c to interrupt\n", true, false, false, 2},
+		{"keeps failing", []error{exitError(t, ""), exitError(t, "")}, "", false, true, false, 2},
+		{"session gone", []error{exitError(t, "can't find session: api")}, "", false, false, false, 1},
+		{"server gone", []error{exitError(t, "no server running on /tmp/tmux-1000/default")}, "", false, false, false, 1},
+		{"no tmux", []error{fmt.Errorf("tmux: %w", exec.ErrNotFound)}, "", false, true, true, 1},
+		{"rejected", []error{exitError(t, "unknown command: capture-pane")}, "", false, true, true, 1},
+		{"not allowed", []error{exitError(t, "command capture-pane not allowed")}, "", false, true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			r := &runnertest.Fake{Func: func(got string) ([]byte, error) {
+				if got != capture {
+					t.Fatalf("ran %q, want %q", got, capture)
+				}
+				calls++
+				if calls <= len(tt.results) {
+					return nil, tt.results[calls-1]
+				}
+				return []byte(tt.content), nil
+			}}
+			busy, err := ActiveWorkContext(context.Background(), r, "api")
+			if busy != tt.wantBusy || (err != nil) != tt.wantErr || errors.Is(err, ErrCaptureUnsupported) != tt.wantUnsupported {
+				t.Errorf("ActiveWorkContext = %v, %v; want %v, error %v, unsupported %v", busy, err, tt.wantBusy, tt.wantErr, tt.wantUnsupported)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("capture-pane ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
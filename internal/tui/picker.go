@@ -2,12 +2,17 @@
 package tui
 
 import (
+	"cmp"
 	"fmt"
 	"strings"
 
 	"github.com/buddyh/av/internal/process"
+	"github.com/buddyh/av/internal/termcaps"
+	"github.com/buddyh/av/internal/tmux"
+	"github.com/buddyh/av/internal/version"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 var (
@@ -22,34 +27,60 @@ var (
 	helpStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))   // dark gray
 )
 
+// Styles for how far behind a session is, most prominent for major versions
+var (
+	deltaMajorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true) // bold red
+	deltaMinorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))           // yellow
+	deltaPatchStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))            // dark gray
+)
+
 // SessionItem represents a session in the picker
 type SessionItem struct {
 	Session        *process.Session
 	Selected       bool
-	CurrentVersion string // installed version to compare against
-	Disabled       bool   // can't restart (has active work)
+	CurrentVersion string // version the session is restarted onto
+	Disabled       bool   // can't restart (has active work, or may have)
+	// Latest is the newer release the session was found outdated against,
+	// when it isn't installed yet so a restart doesn't reach it
+	Latest string
 }
 
 // PickerModel is the bubbletea model for session picker
 type PickerModel struct {
 	items      []SessionItem
 	cursor     int
+	confirming bool // showing the final summary before submitting
 	submitted  bool
 	cancelled  bool
-	newVersion string
+	symbols    bool
+	ascii      bool
+	// agentColors holds the ANSI color number each agent's name is shown
+	// in, by agent
+	agentColors map[string]string
+}
+
+// colorProfiles maps termcaps' color depths onto lipgloss's profiles
+var colorProfiles = map[termcaps.ColorDepth]termenv.Profile{
+	termcaps.ColorNone: termenv.Ascii,
+	termcaps.Color16:   termenv.ANSI,
+	termcaps.Color256:  termenv.ANSI256,
+	termcaps.ColorTrue: termenv.TrueColor,
 }
 
-// NewPicker creates a new session picker
-func NewPicker(sessions []*process.Session, installedClaude, installedCodex string) PickerModel {
+// NewPicker creates a new session picker, drawn in the colors and glyphs
+// termcaps finds the terminal can show
+func NewPicker(sessions []*process.Session, installed map[string]string) PickerModel {
+	caps := termcaps.Detect()
+	lipgloss.SetColorProfile(colorProfiles[caps.Colors])
+
 	var items []SessionItem
 	for _, s := range sessions {
-		currentVersion := installedClaude
-		if s.Agent == "codex" {
-			currentVersion = installedCodex
-		}
+		currentVersion := s.CurrentVersion(installed)
 		// Only include sessions that need restart
-		if s.RunningVersion != "" && s.RunningVersion != currentVersion && s.TmuxSession != "" {
-			disabled := s.HasActiveWork
+		if s.Outdated(installed) && s.TmuxSession != "" {
+			// A pane that couldn't be captured may be busy; WithUnknownWork
+			// decides whether to chance it
+			disabled := s.HasActiveWork || s.ActiveWorkUnknown
 			items = append(items, SessionItem{
 				Session:        s,
 				Selected:       !disabled, // default selected unless disabled
@@ -59,9 +90,58 @@ func NewPicker(sessions []*process.Session, installedClaude, installedCodex stri
 		}
 	}
 	return PickerModel{
-		items:      items,
-		newVersion: installedClaude,
+		items: items,
+		ascii: !caps.Unicode,
+	}
+}
+
+// WithSymbols marks selected and busy items with symbols rather than relying
+// on color alone
+func (m PickerModel) WithSymbols(on bool) PickerModel {
+	m.symbols = on
+	return m
+}
+
+// WithASCII draws the picker with ASCII characters only, for terminals that
+// can't render Unicode; ones termcaps knows can't are drawn that way anyway
+func (m PickerModel) WithASCII(on bool) PickerModel {
+	m.ascii = m.ascii || on
+	return m
+}
+
+// WithInstalled shows each session restarted onto its installed version,
+// for a picker whose sessions were found outdated against something else
+// (av restart --compare-to latest). Where the installed version is older,
+// the newer one it was compared against is noted.
+func (m PickerModel) WithInstalled(installed map[string]string) PickerModel {
+	for i, item := range m.items {
+		target := item.Session.CurrentVersion(installed)
+		if target == "" || version.Compare(target, item.CurrentVersion) < 0 {
+			m.items[i].Latest = item.CurrentVersion
+		}
+		m.items[i].CurrentVersion = cmp.Or(target, "?")
+	}
+	return m
+}
+
+// WithAgentColors shows each agent's name in its color, given as an ANSI
+// color number by agent; agents without one are shown uncolored
+func (m PickerModel) WithAgentColors(colors map[string]string) PickerModel {
+	m.agentColors = colors
+	return m
+}
+
+// WithUnknownWork lets sessions whose pane couldn't be checked for active
+// work be restarted (and preselects them) when proceed is set; otherwise
+// they're shown but can't be picked
+func (m PickerModel) WithUnknownWork(proceed bool) PickerModel {
+	for i, item := range m.items {
+		if item.Session.ActiveWorkUnknown && !item.Session.HasActiveWork {
+			m.items[i].Disabled = !proceed
+			m.items[i].Selected = proceed
+		}
 	}
+	return m
 }
 
 // Init implements tea.Model
@@ -73,13 +153,31 @@ func (m PickerModel) Init() tea.Cmd {
 func (m PickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.confirming {
+			switch msg.String() {
+			case "ctrl+c", "q":
+				m.cancelled = true
+				return m, tea.Quit
+			case "y", "enter":
+				m.submitted = true
+				return m, tea.Quit
+			case "esc", "n", "backspace":
+				m.confirming = false
+			}
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
 			m.cancelled = true
 			return m, tea.Quit
 		case "enter":
-			m.submitted = true
-			return m, tea.Quit
+			// Nothing selected needs no confirming
+			if len(m.SelectedSessions()) == 0 {
+				m.submitted = true
+				return m, tea.Quit
+			}
+			m.confirming = true
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
@@ -115,6 +213,10 @@ func (m PickerModel) View() string {
 		return "No sessions need restart.\n"
 	}
 
+	if m.confirming {
+		return m.confirmView()
+	}
+
 	var b strings.Builder
 
 	b.WriteString(headerStyle.Render("Select sessions to restart:"))
@@ -130,9 +232,15 @@ func (m PickerModel) View() string {
 		style := unselectedStyle
 		if item.Disabled {
 			checkbox = "[-]"
+			if m.symbols {
+				checkbox = "[~]"
+			}
 			style = disabledStyle
 		} else if item.Selected {
 			checkbox = "[x]"
+			if m.symbols && !m.ascii {
+				checkbox = "[✓]"
+			}
 			style = selectedStyle
 		}
 
@@ -141,21 +249,37 @@ func (m PickerModel) View() string {
 			path = "..." + path[len(path)-32:]
 		}
 
-		version := fmt.Sprintf("%s -> %s",
+		versions := fmt.Sprintf("%s -> %s%s",
 			versionOld.Render(item.Session.RunningVersion),
-			versionNew.Render(item.CurrentVersion))
+			versionNew.Render(item.CurrentVersion),
+			renderDelta(item.Session.RunningVersion, item.CurrentVersion))
+		if item.Latest != "" {
+			versions += helpStyle.Render(fmt.Sprintf(" (latest %s not installed)", item.Latest))
+		}
 
 		status := ""
-		if item.Disabled {
+		switch {
+		case item.Session.ActiveWorkUnknown && !item.Session.HasActiveWork:
+			status = activeWorkStyle.Render(" (activity unknown)")
+		case item.Disabled:
 			status = activeWorkStyle.Render(" (busy)")
 		}
+		if item.Session.Attached {
+			status += helpStyle.Render(" (attached)")
+		}
+
+		agent := fmt.Sprintf("%-*s", version.AgentWidth, item.Session.Agent)
+		if c, ok := m.agentColors[item.Session.Agent]; ok {
+			agent = lipgloss.NewStyle().Foreground(lipgloss.Color(c)).Render(agent)
+		}
 
-		line := fmt.Sprintf("%s %s %-20s %-38s %s%s",
+		line := fmt.Sprintf("%s %s %-20s %s %-38s %s%s",
 			cursor,
 			checkbox,
-			item.Session.TmuxSession,
+			item.Session.Label(),
+			agent,
 			path,
-			version,
+			versions,
 			status)
 
 		b.WriteString(style.Render(line))
@@ -163,7 +287,94 @@ func (m PickerModel) View() string {
 	}
 
 	b.WriteString("\n")
-	b.WriteString(helpStyle.Render("↑/↓ navigate • space toggle • a all • n none • enter confirm • q quit"))
+	if m.anyUnknownDisabled() {
+		b.WriteString(helpStyle.Render("activity unknown: the pane couldn't be captured, so it's left alone (--unknown-work=proceed allows it)"))
+		b.WriteString("\n")
+	}
+	sep := helpStyle.Render(m.separator())
+	b.WriteString(helpStyle.Render("behind by: ") +
+		deltaMajorStyle.Render("major") + sep +
+		deltaMinorStyle.Render("minor") + sep +
+		deltaPatchStyle.Render("patch"))
+	b.WriteString("\n")
+	navigate := "↑/↓ navigate"
+	if m.ascii {
+		navigate = "up/down navigate"
+	}
+	b.WriteString(helpStyle.Render(strings.Join([]string{navigate, "space toggle", "a all", "n none", "enter confirm", "q quit"}, m.separator())))
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// anyUnknownDisabled reports whether an item can't be picked only because
+// its pane couldn't be checked for active work
+func (m PickerModel) anyUnknownDisabled() bool {
+	for _, item := range m.items {
+		if item.Disabled && item.Session.ActiveWorkUnknown && !item.Session.HasActiveWork {
+			return true
+		}
+	}
+	return false
+}
+
+// anyLatestMissing reports whether a selected item would be restarted onto
+// an older version than the latest it was compared against
+func (m PickerModel) anyLatestMissing() bool {
+	for _, item := range m.items {
+		if item.Selected && item.Latest != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// separator goes between key hints in the help line
+func (m PickerModel) separator() string {
+	if m.ascii {
+		return " | "
+	}
+	return " • "
+}
+
+// renderDelta annotates how far behind a session is, e.g. " (+2 major)",
+// so sessions several majors behind stand out
+func renderDelta(running, current string) string {
+	major, minor, patch := version.Delta(running, current)
+	switch {
+	case major > 0:
+		return deltaMajorStyle.Render(fmt.Sprintf(" (+%d major)", major))
+	case minor > 0:
+		return deltaMinorStyle.Render(fmt.Sprintf(" (+%d minor)", minor))
+	case patch > 0:
+		return deltaPatchStyle.Render(fmt.Sprintf(" (+%d patch)", patch))
+	}
+	return ""
+}
+
+// confirmView lists the selected sessions with the command each will be
+// resumed with, for a final go-ahead
+func (m PickerModel) confirmView() string {
+	var b strings.Builder
+
+	selected := m.SelectedSessions()
+	b.WriteString(headerStyle.Render(fmt.Sprintf("Restart %d session(s)?", len(selected))))
+	b.WriteString("\n\n")
+
+	for _, s := range selected {
+		cmd, err := tmux.BuildResumeCommand(s)
+		if err != nil {
+			cmd = "(" + err.Error() + ")"
+		}
+		b.WriteString(fmt.Sprintf("  %-20s %s\n", s.Label(), helpStyle.Render("$ "+cmd)))
+	}
+
+	b.WriteString("\n")
+	if m.anyLatestMissing() {
+		b.WriteString(helpStyle.Render("Sessions restart onto the installed version; run av upgrade first to get the latest"))
+		b.WriteString("\n")
+	}
+	b.WriteString(helpStyle.Render(strings.Join([]string{"y/enter restart", "esc back", "q quit"}, m.separator())))
 	b.WriteString("\n")
 
 	return b.String()
@@ -0,0 +1,37 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/buddyh/av/internal/process"
+)
+
+func TestPickerShowsInstalledTarget(t *testing.T) {
+	sessions := []*process.Session{
+		{PID: 1, Agent: "claude", RunningVersion: "2.1.10", TmuxSession: "api"},
+		{PID: 2, Agent: "codex", RunningVersion: "0.40.0", TmuxSession: "web"},
+	}
+	latest := map[string]string{"claude": "2.1.14", "codex": "0.46.0"}
+	installed := map[string]string{"claude": "2.1.12", "codex": "0.46.0"}
+
+	m := NewPicker(sessions, latest).WithInstalled(installed)
+	want := []struct{ current, latest string }{
+		{"2.1.12", "2.1.14"},
+		{"0.46.0", ""},
+	}
+	for i, w := range want {
+		if got := m.items[i]; got.CurrentVersion != w.current || got.Latest != w.latest {
+			t.Errorf("%s: target %q, latest %q; want %q, %q", got.Session.Label(), got.CurrentVersion, got.Latest, w.current, w.latest)
+		}
+	}
+
+	view := m.View()
+	if !strings.Contains(view, "latest 2.1.14 not installed") {
+		t.Errorf("view doesn't note the uninstalled latest:\n%s", view)
+	}
+	m.confirming = true
+	if view := m.View(); !strings.Contains(view, "restart onto the installed version") {
+		t.Errorf("confirm view doesn't say sessions restart onto the installed version:\n%s", view)
+	}
+}
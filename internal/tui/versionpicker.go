@@ -0,0 +1,126 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buddyh/av/internal/version"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// VersionPickerModel is the bubbletea model for picking one of an agent's
+// locally installed versions
+type VersionPickerModel struct {
+	title     string
+	versions  []version.LocalVersion
+	cursor    int
+	submitted bool
+	cancelled bool
+	ascii     bool
+}
+
+// NewVersionPicker creates a picker over versions with the cursor on the
+// active one
+func NewVersionPicker(title string, versions []version.LocalVersion) VersionPickerModel {
+	m := VersionPickerModel{title: title, versions: versions}
+	for i, v := range versions {
+		if v.Active {
+			m.cursor = i
+		}
+	}
+	return m
+}
+
+// WithASCII draws the picker with ASCII characters only
+func (m VersionPickerModel) WithASCII(on bool) VersionPickerModel {
+	m.ascii = on
+	return m
+}
+
+// Init implements tea.Model
+func (m VersionPickerModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m VersionPickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cancelled = true
+			return m, tea.Quit
+		case "enter":
+			if len(m.versions) > 0 {
+				m.submitted = true
+			} else {
+				m.cancelled = true
+			}
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.versions)-1 {
+				m.cursor++
+			}
+		}
+	}
+	return m, nil
+}
+
+// View implements tea.Model
+func (m VersionPickerModel) View() string {
+	if len(m.versions) == 0 {
+		return "No installed versions found.\n"
+	}
+
+	var b strings.Builder
+
+	b.WriteString(headerStyle.Render(m.title))
+	b.WriteString("\n\n")
+
+	for i, v := range m.versions {
+		cursor := "  "
+		style := unselectedStyle
+		if i == m.cursor {
+			cursor = cursorStyle.Render("> ")
+			style = selectedStyle
+		}
+
+		note := ""
+		if v.Active {
+			note = " (active)"
+		}
+		installed := ""
+		if !v.InstalledAt.IsZero() {
+			installed = v.InstalledAt.Local().Format("2006-01-02")
+		}
+
+		b.WriteString(style.Render(fmt.Sprintf("%s %-12s %-10s", cursor, v.Version, installed)))
+		b.WriteString(helpStyle.Render(note))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	navigate := "↑/↓ navigate"
+	sep := " • "
+	if m.ascii {
+		navigate = "up/down navigate"
+		sep = " | "
+	}
+	b.WriteString(helpStyle.Render(strings.Join([]string{navigate, "enter choose", "q quit"}, sep)))
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// Cancelled returns true if user cancelled
+func (m VersionPickerModel) Cancelled() bool {
+	return m.cancelled
+}
+
+// Selected returns the chosen version; only meaningful unless Cancelled
+func (m VersionPickerModel) Selected() version.LocalVersion {
+	return m.versions[m.cursor]
+}
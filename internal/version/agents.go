@@ -0,0 +1,195 @@
+package version
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// Agents lists the supported agents in display order
+var Agents = []string{"claude", "codex", "gemini"}
+
+// AgentWidth is the width of an agent column in tables, enough for the
+// longest name in Agents
+const AgentWidth = len("gemini")
+
+// DisplayName returns the human-readable name of an agent
+func DisplayName(agent string) string {
+	switch agent {
+	case "claude":
+		return "Claude Code"
+	case "codex":
+		return "Codex"
+	case "gemini":
+		return "Gemini CLI"
+	default:
+		return agent
+	}
+}
+
+// GetInstalled returns the installed version of an agent
+func GetInstalled(agent string) (string, error) {
+	return GetInstalledContext(context.Background(), agent)
+}
+
+// GetInstalledContext is GetInstalled, giving up when ctx is done
+func GetInstalledContext(ctx context.Context, agent string) (string, error) {
+	switch agent {
+	case "claude":
+		return installedClaude(ctx)
+	case "codex", "gemini":
+		return installedFromVersion(ctx, agent)
+	default:
+		return "", ErrNotInstalled
+	}
+}
+
+// GetInstalledOn returns the installed version of an agent on the runner's
+// host. Remote hosts are asked via "<agent> --version" on their PATH.
+func GetInstalledOn(r runner.Runner, agent string) (string, error) {
+	return GetInstalledOnContext(context.Background(), r, agent)
+}
+
+// GetInstalledOnContext is GetInstalledOn, giving up when ctx is done
+func GetInstalledOnContext(ctx context.Context, r runner.Runner, agent string) (string, error) {
+	if r.Host() == "" {
+		return GetInstalledContext(ctx, agent)
+	}
+	out, err := r.Output(ctx, agent, "--version")
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("%s on %s: %w", agent, r.Host(), ErrNotInstalled)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s --version on %s: %w", agent, r.Host(), err)
+	}
+	return parseVersionOutput(agent, strings.TrimSpace(string(out)))
+}
+
+// FetchLatest returns the latest upstream version of an agent
+func FetchLatest(agent string) (string, error) {
+	return FetchLatestContext(context.Background(), agent)
+}
+
+// FetchLatestContext is FetchLatest, giving up when ctx is done
+func FetchLatestContext(ctx context.Context, agent string) (string, error) {
+	switch agent {
+	case "claude":
+		return fetchLatestClaude(ctx)
+	case "codex":
+		return fetchNpmLatest(ctx, "@openai/codex", codexChannel)
+	case "gemini":
+		return fetchNpmLatest(ctx, "@google/gemini-cli", DefaultChannel)
+	default:
+		return "", fmt.Errorf("unknown agent: %s", agent)
+	}
+}
+
+// Retries for FetchLatestRetryContext: the first retry waits fetchBackoff,
+// and each one after that twice as long as the last
+const (
+	fetchAttempts = 3
+	fetchBackoff  = 500 * time.Millisecond
+)
+
+// FetchLatestRetryContext is FetchLatestContext, retrying a fetch that
+// failed to reach the registry or got an HTTP error, which is often
+// momentary. A response without a version in it isn't retried.
+func FetchLatestRetryContext(ctx context.Context, agent string) (string, error) {
+	var err error
+	for attempt := 0; attempt < fetchAttempts; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(fetchBackoff << (attempt - 1))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return "", err
+			case <-t.C:
+			}
+		}
+		var v string
+		v, err = FetchLatestContext(ctx, agent)
+		if err == nil || !(errors.Is(err, ErrNetwork) || errors.Is(err, ErrBadStatus)) {
+			return v, err
+		}
+	}
+	return "", fmt.Errorf("after %d attempts: %w", fetchAttempts, err)
+}
+
+// DefaultChannel is the npm dist-tag an agent's latest version is read from
+// unless another channel is configured
+const DefaultChannel = "latest"
+
+// codexChannel is the npm dist-tag treated as the latest Codex release
+var codexChannel = DefaultChannel
+
+// channelRegex matches an npm dist-tag name
+var channelRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateChannel checks that channel could be an npm dist-tag
+func ValidateChannel(channel string) error {
+	if !channelRegex.MatchString(channel) {
+		return fmt.Errorf("%q is not an npm dist-tag like latest or next", channel)
+	}
+	return nil
+}
+
+// SetCodexChannel makes update checks compare Codex against an npm dist-tag
+// such as "next" or "beta" instead of "latest". An empty channel restores
+// the default.
+func SetCodexChannel(channel string) error {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	if err := ValidateChannel(channel); err != nil {
+		return fmt.Errorf("codex channel: %w", err)
+	}
+	codexChannel = channel
+	return nil
+}
+
+// claudePrerelease makes Claude Code's latest version the newest release,
+// pre-releases included
+var claudePrerelease bool
+
+// SetClaudePrerelease makes update checks compare Claude Code against the
+// newest GitHub release including pre-releases, for users running betas
+func SetClaudePrerelease(on bool) {
+	claudePrerelease = on
+}
+
+// binOverrides holds user-configured binary paths, by agent
+var binOverrides = make(map[string]string)
+
+// SetBinary makes detection and restart use path as the agent's binary
+// instead of looking it up on PATH. An empty path clears the override.
+func SetBinary(agent, path string) error {
+	if path == "" {
+		delete(binOverrides, agent)
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s binary: %w", agent, err)
+	}
+	if info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%s binary: %s is not executable", agent, path)
+	}
+	binOverrides[agent] = path
+	return nil
+}
+
+// Binary returns the binary to run for an agent: the configured override,
+// or just the agent name to be resolved via PATH
+func Binary(agent string) string {
+	if path, ok := binOverrides[agent]; ok {
+		return path
+	}
+	return agent
+}
@@ -0,0 +1,109 @@
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LatestCache is the on-disk cache of latest upstream versions, keyed by agent
+type LatestCache struct {
+	Latest    map[string]string `json:"latest"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	// CodexChannel is the npm dist-tag the Codex version was read from
+	CodexChannel string `json:"codex_channel,omitempty"`
+	// ClaudePrerelease is set when the Claude version includes pre-releases
+	ClaudePrerelease bool `json:"claude_prerelease,omitempty"`
+
+	// FromCache is set when FetchLatestCached served these from disk
+	FromCache bool `json:"-"`
+	// Errors holds per-agent fetch failures from a live fetch
+	Errors map[string]error `json:"-"`
+}
+
+// CachePath returns the location of the latest-version cache file
+func CachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "av", "latest.json")
+}
+
+// LoadCache reads the latest-version cache from disk
+func LoadCache() (*LatestCache, error) {
+	data, err := os.ReadFile(CachePath())
+	if err != nil {
+		return nil, err
+	}
+	var c LatestCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save writes the cache to disk
+func (c *LatestCache) Save() error {
+	path := CachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ClearCache deletes the cache file, so the next cached fetch goes to the
+// network. It returns an fs.ErrNotExist error if there was none.
+func ClearCache() error {
+	return os.Remove(CachePath())
+}
+
+// Fresh reports whether the cache was fetched within ttl
+func (c *LatestCache) Fresh(ttl time.Duration) bool {
+	return c != nil && ttl > 0 && time.Since(c.FetchedAt) < ttl
+}
+
+// FetchLatestCached returns the latest version of every agent, hitting the
+// network only if the cache is older than ttl. A ttl of zero always fetches.
+// Fresh results are written back so later callers can reuse them.
+func FetchLatestCached(ttl time.Duration) *LatestCache {
+	return FetchLatestCachedContext(context.Background(), ttl)
+}
+
+// FetchLatestCachedContext is FetchLatestCached, giving up on fetches when
+// ctx is done
+func FetchLatestCachedContext(ctx context.Context, ttl time.Duration) *LatestCache {
+	// A cache filled from another channel doesn't count
+	if c, err := LoadCache(); err == nil && c.Fresh(ttl) && c.CodexChannel == codexChannel && c.ClaudePrerelease == claudePrerelease {
+		c.FromCache = true
+		return c
+	}
+
+	c := &LatestCache{
+		Latest:           make(map[string]string),
+		FetchedAt:        time.Now(),
+		CodexChannel:     codexChannel,
+		ClaudePrerelease: claudePrerelease,
+		Errors:           make(map[string]error),
+	}
+	fetched := false
+	for _, agent := range Agents {
+		v, err := FetchLatestContext(ctx, agent)
+		c.Latest[agent] = v
+		if err != nil {
+			c.Errors[agent] = err
+		}
+		fetched = fetched || v != ""
+	}
+	// Don't cache a total failure (e.g. offline), so the next call retries
+	if fetched {
+		_ = c.Save()
+	}
+	return c
+}
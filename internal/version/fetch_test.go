@@ -0,0 +1,197 @@
+package version
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// fixtureServer answers every fetch, whatever host it's for, and records
+// what was asked
+type fixtureServer struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+// Requests returns the URLs fetched so far, as host and path
+func (f *fixtureServer) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// serveFixtures points every fetch at handler for the rest of the test.
+// The handler sees the host the request was meant for in r.Host.
+func serveFixtures(t *testing.T, handler http.HandlerFunc) *fixtureServer {
+	t.Helper()
+	f := &fixtureServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Host+r.URL.Path)
+		f.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	to, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetTransport(redirectTransport{to: to, next: srv.Client().Transport})
+	t.Cleanup(func() { SetTransport(nil) })
+	return f
+}
+
+// redirectTransport sends requests to another server, keeping their Host
+type redirectTransport struct {
+	to   *url.URL
+	next http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme, req.URL.Host = t.to.Scheme, t.to.Host
+	return t.next.RoundTrip(req)
+}
+
+func TestFetchNpmLatestChannels(t *testing.T) {
+	srv := serveFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/@openai/codex" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name": "@openai/codex", "dist-tags": {"latest": "0.46.0", "next": "0.47.0-alpha.3", "beta": "0.47.0-beta.1"}}`))
+	})
+
+	tests := []struct {
+		channel, want string
+		wantErr       error
+	}{
+		{"latest", "0.46.0", nil},
+		{"next", "0.47.0-alpha.3", nil},
+		{"beta", "0.47.0-beta.1", nil},
+		{"canary", "", ErrBadResponse},
+	}
+	for _, tt := range tests {
+		got, err := fetchNpmLatest(context.Background(), "@openai/codex", tt.channel)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("fetchNpmLatest(%q) = %q, %v; want %q, %v", tt.channel, got, err, tt.want, tt.wantErr)
+		}
+	}
+	for _, req := range srv.Requests() {
+		if req != "registry.npmjs.org/@openai/codex" {
+			t.Errorf("fetched %s, want registry.npmjs.org/@openai/codex", req)
+		}
+	}
+
+	if _, err := fetchNpmLatest(context.Background(), "@openai/nope", "latest"); !errors.Is(err, ErrBadStatus) {
+		t.Errorf("fetchNpmLatest of a missing package: err = %v, want ErrBadStatus", err)
+	}
+}
+
+func TestFetchNewestClaudeRelease(t *testing.T) {
+	tests := []struct {
+		name, releases, want string
+	}{
+		{"pre-release of the next version", `[{"tag_name": "v2.1.14"}, {"tag_name": "v2.2.0-beta.1", "prerelease": true}]`, "2.2.0-beta.1"},
+		{"release beats its own pre-releases", `[{"tag_name": "v2.2.0-beta.1", "prerelease": true}, {"tag_name": "v2.2.0"}, {"tag_name": "v2.2.0-rc.1", "prerelease": true}]`, "2.2.0"},
+		{"highest pre-release", `[{"tag_name": "v2.2.0-beta.2"}, {"tag_name": "v2.2.0-beta.11"}, {"tag_name": "v2.2.0-alpha.30"}]`, "2.2.0-beta.11"},
+		{"drafts and junk skipped", `[{"tag_name": "v3.0.0", "draft": true}, {"tag_name": "nightly"}, {"tag_name": "v2.1.14"}]`, "2.1.14"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.releases))
+			})
+			got, err := fetchNewestClaudeRelease(context.Background(), newClient())
+			if err != nil || got != tt.want {
+				t.Errorf("fetchNewestClaudeRelease = %q, %v; want %q", got, err, tt.want)
+			}
+			if reqs := srv.Requests(); len(reqs) != 1 || reqs[0] != "api.github.com/repos/anthropics/claude-code/releases" {
+				t.Errorf("fetched %q, want the releases list", reqs)
+			}
+		})
+	}
+
+	serveFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	if _, err := fetchNewestClaudeRelease(context.Background(), newClient()); !errors.Is(err, ErrBadResponse) {
+		t.Errorf("fetchNewestClaudeRelease with no releases: err = %v, want ErrBadResponse", err)
+	}
+}
+
+// failingTransport fails every request with err
+type failingTransport struct{ err error }
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, t.err }
+
+func TestFetchProblem(t *testing.T) {
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: err}}
+	}
+	tests := []struct {
+		name       string
+		err        error // from the transport; nil to serve a response
+		status     int
+		body       string
+		wantStatus string
+		want       string
+	}{
+		{"DNS", &net.DNSError{Err: "no such host", Name: "registry.npmjs.org", IsNotFound: true}, 0, "",
+			"network_error", "offline: registry.npmjs.org unreachable (DNS lookup failed)"},
+		{"timeout", dial(os.ErrDeadlineExceeded), 0, "",
+			"network_error", "timeout: registry.npmjs.org didn't answer in time"},
+		{"TLS", &tls.CertificateVerificationError{Err: errors.New("x509: certificate signed by unknown authority")}, 0, "",
+			"network_error", "TLS error talking to registry.npmjs.org"},
+		{"refused", dial(syscall.ECONNREFUSED), 0, "",
+			"network_error", "registry.npmjs.org refused the connection"},
+		{"no route", dial(syscall.ENETUNREACH), 0, "",
+			"network_error", "offline: registry.npmjs.org unreachable (no route)"},
+		{"other network error", errors.New("connection reset"), 0, "",
+			"network_error", "network error reaching registry.npmjs.org"},
+		{"non-200", nil, http.StatusServiceUnavailable, "",
+			"http_error", "registry.npmjs.org answered HTTP 503 Service Unavailable"},
+		{"no version", nil, http.StatusOK, `{"dist-tags": {}}`,
+			"parse_error", "unexpected response: no version in it"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err != nil {
+				SetTransport(failingTransport{tt.err})
+				t.Cleanup(func() { SetTransport(nil) })
+			} else {
+				serveFixtures(t, func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+				})
+			}
+			_, err := fetchNpmLatest(context.Background(), "@openai/codex", "latest")
+			if got := FetchStatus(err); got != tt.wantStatus {
+				t.Errorf("FetchStatus(%v) = %q, want %q", err, got, tt.wantStatus)
+			}
+			if got := FetchProblem(err); got != tt.want {
+				t.Errorf("FetchProblem(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+
+	SetOffline(true)
+	defer SetOffline(false)
+	_, err := fetchNpmLatest(context.Background(), "@openai/codex", "latest")
+	if got, want := FetchProblem(err), "fetching is turned off"; got != want {
+		t.Errorf("FetchProblem offline = %q, want %q", got, want)
+	}
+	if got := FetchProblem(nil); got != "" {
+		t.Errorf("FetchProblem(nil) = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,102 @@
+package version
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// claudeHome sets HOME to a temp dir holding the native installer's
+// versions dir with the given versions, and PATH to an empty dir so
+// --version can't answer
+func claudeHome(t *testing.T, versions ...string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", t.TempDir())
+	for _, dir := range []string{".claude", ".local/bin", ".local/share/claude/versions"} {
+		if err := os.MkdirAll(filepath.Join(home, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range versions {
+		path := filepath.Join(home, ".local/share/claude/versions", v)
+		if err := os.WriteFile(path, nil, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestClaudeConfigVersion(t *testing.T) {
+	tests := []struct {
+		name, config string
+		want         string
+	}{
+		{"installed", `{"version": "2.1.14", "autoUpdates": true}`, "2.1.14"},
+		{"not installed any more", `{"version": "2.0.1"}`, ""},
+		{"no version", `{"autoUpdates": true}`, ""},
+		{"a number", `{"version": 2}`, ""},
+		{"not a version", `{"version": "latest"}`, ""},
+		{"not JSON", `version=2.1.14`, ""},
+		{"empty", ``, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := claudeHome(t, "2.1.14")
+			path := filepath.Join(home, ".claude", "config.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := claudeConfigVersion(path); got != tt.want {
+				t.Errorf("claudeConfigVersion(%s) = %q, want %q", tt.config, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		home := claudeHome(t, "2.1.14")
+		if got := claudeConfigVersion(filepath.Join(home, ".claude", "config.json")); got != "" {
+			t.Errorf("claudeConfigVersion of a missing file = %q, want \"\"", got)
+		}
+	})
+}
+
+func TestInstalledClaude(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    string // ~/.local/bin/claude's target, relative to the versions dir
+		config  string
+		want    string
+		wantErr error
+	}{
+		{"symlink only", "2.1.14", "", "2.1.14", nil},
+		{"config only", "", `{"version": "2.1.14"}`, "2.1.14", nil},
+		{"agree", "2.1.14", `{"version": "2.1.14"}`, "2.1.14", nil},
+		{"config left behind", "2.1.14", `{"version": "2.0.1"}`, "2.1.14", nil},
+		{"neither", "", `{"version": "1.0.0"}`, "", ErrNotInstalled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := claudeHome(t, "2.0.1", "2.1.14")
+			if tt.link != "" {
+				target := filepath.Join(home, ".local/share/claude/versions", tt.link)
+				if err := os.Symlink(target, filepath.Join(home, ".local/bin/claude")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.config != "" {
+				path := filepath.Join(home, ".claude", "config.json")
+				if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := installedClaude(context.Background())
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("installedClaude = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
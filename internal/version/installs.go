@@ -0,0 +1,228 @@
+package version
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// Install is one copy of an agent binary found on disk
+type Install struct {
+	Path    string `json:"path"`
+	Target  string `json:"target,omitempty"` // resolved symlink target
+	Version string `json:"version,omitempty"`
+	Active  bool   `json:"active"` // what running the bare command picks up
+}
+
+// knownInstallDirs are common install locations that may not be on PATH
+func knownInstallDirs() []string {
+	home, _ := os.UserHomeDir()
+	return []string{
+		filepath.Join(home, ".local", "bin"),
+		filepath.Join(home, ".claude", "local"),
+		filepath.Join(home, ".npm-global", "bin"),
+		filepath.Join(home, ".bun", "bin"),
+		filepath.Join(home, ".volta", "bin"),
+		"/opt/homebrew/bin",
+		"/usr/local/bin",
+	}
+}
+
+// FindInstalls returns every distinct binary for an agent on PATH and in
+// common install dirs, in PATH order. Binaries that resolve to the same file
+// are reported once. Versions are only looked up when there is more than one
+// install, since a lone install's version is what GetInstalled reports.
+func FindInstalls(agent string) []Install {
+	return FindInstallsContext(context.Background(), agent)
+}
+
+// FindInstallsContext is FindInstalls, giving up on version lookups when ctx
+// is done
+func FindInstallsContext(ctx context.Context, agent string) []Install {
+	active, _ := exec.LookPath(agent)
+
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	dirs = append(dirs, knownInstallDirs()...)
+
+	var installs []Install
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, agent)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			target = path
+		}
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		install := Install{Path: path, Active: path == active}
+		if target != path {
+			install.Target = target
+		}
+		installs = append(installs, install)
+	}
+
+	if len(installs) > 1 {
+		for i := range installs {
+			target := installs[i].Target
+			if target == "" {
+				target = installs[i].Path
+			}
+			installs[i].Version = versionOf(ctx, installs[i].Path, target)
+		}
+	}
+	return installs
+}
+
+// installVersions caches the versions versionOf got by running --version,
+// by binary as it was on disk then, so a watch or daemon runs each install
+// once rather than on every scan
+var (
+	installVersions   = make(map[installKey]string)
+	installVersionsMu sync.Mutex
+)
+
+// installKey identifies a binary's contents well enough to notice an upgrade
+type installKey struct {
+	target string
+	mod    time.Time
+	size   int64
+}
+
+// versionOf determines the version of one binary, from a versioned symlink
+// target like .../versions/2.1.14 if possible, else by running --version
+func versionOf(ctx context.Context, path, target string) string {
+	if v := filepath.Base(target); semverRegex.MatchString(v) {
+		return v
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return ""
+	}
+	key := installKey{target, info.ModTime(), info.Size()}
+	installVersionsMu.Lock()
+	v, ok := installVersions[key]
+	installVersionsMu.Unlock()
+	if ok {
+		return v
+	}
+
+	out, err := runner.Local.Output(ctx, path, "--version")
+	if err != nil {
+		return ""
+	}
+	for _, field := range strings.Fields(string(out)) {
+		if semverRegex.MatchString(field) {
+			v = field
+			break
+		}
+	}
+	installVersionsMu.Lock()
+	installVersions[key] = v
+	installVersionsMu.Unlock()
+	return v
+}
+
+// ConflictingInstalls reports whether installs disagree on version, which
+// usually means one is shadowing another on PATH. Installs whose version
+// couldn't be read don't count either way.
+func ConflictingInstalls(installs []Install) bool {
+	first := ""
+	for _, i := range installs {
+		switch {
+		case i.Version == "":
+		case first == "":
+			first = i.Version
+		case i.Version != first:
+			return true
+		}
+	}
+	return false
+}
+
+// Install methods, as InstallMethod reports them
+const (
+	// MethodLocal is Claude's own installer: a binary under ~/.local, or
+	// the older local install in ~/.claude/local
+	MethodLocal = "local"
+	// MethodHomebrew is a Homebrew formula or cask
+	MethodHomebrew = "homebrew"
+	// MethodNpm is a global npm (or compatible) package install
+	MethodNpm = "npm"
+	// MethodNix is a package from the Nix store
+	MethodNix = "nix"
+	// MethodPath is any other binary found on PATH
+	MethodPath = "path"
+)
+
+// InstallMethod says how the agent's active binary was installed, which
+// decides how to upgrade it, and returns the file the binary resolves to.
+// Both are "" if the agent isn't installed.
+func InstallMethod(agent string) (method, target string) {
+	path, err := exec.LookPath(Binary(agent))
+	if err != nil {
+		return "", ""
+	}
+	target, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		target = path
+	}
+	home, _ := os.UserHomeDir()
+	return installMethodOf(path, target, home), target
+}
+
+// installMethodOf tells the install method from where a binary is and the
+// file it resolves to. The order matters: the Nix store and Homebrew keep
+// npm packages' node_modules too, as does ~/.claude/local.
+func installMethodOf(path, target, home string) string {
+	inHome := func(p string, elem ...string) bool {
+		if home == "" {
+			return false
+		}
+		dir := filepath.Join(append([]string{home}, elem...)...)
+		return strings.HasPrefix(p, dir+string(filepath.Separator))
+	}
+	npm := strings.Contains(target, "/node_modules/")
+
+	switch {
+	case strings.HasPrefix(target, "/nix/store/"):
+		return MethodNix
+	case strings.Contains(target, "/Cellar/"), strings.Contains(target, "/Caskroom/"):
+		return MethodHomebrew
+	case inHome(target, ".claude", "local"), inHome(target, ".local", "share"), inHome(path, ".local", "bin") && !npm:
+		return MethodLocal
+	case npm:
+		return MethodNpm
+	default:
+		return MethodPath
+	}
+}
+
+// BrewPackage returns the Homebrew formula or cask a binary installed with
+// Homebrew belongs to, from its path in the Cellar or Caskroom, or "" if
+// it isn't in either
+func BrewPackage(target string) (name string, cask bool) {
+	for _, dir := range []string{"/Cellar/", "/Caskroom/"} {
+		if _, rest, ok := strings.Cut(target, dir); ok {
+			name, _, _ = strings.Cut(rest, "/")
+			return name, dir == "/Caskroom/"
+		}
+	}
+	return "", false
+}
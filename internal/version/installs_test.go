@@ -0,0 +1,123 @@
+package version
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConflictingInstalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		want     bool
+	}{
+		{"none", nil, false},
+		{"one", []string{"2.1.14"}, false},
+		{"agree", []string{"2.1.14", "2.1.14"}, false},
+		{"disagree", []string{"2.1.14", "2.0.1"}, true},
+		{"one unreadable", []string{"2.1.14", ""}, false},
+		{"first unreadable", []string{"", "2.1.14", "2.1.14"}, false},
+		{"unreadable between", []string{"2.1.14", "", "2.0.1"}, true},
+		{"all unreadable", []string{"", ""}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var installs []Install
+			for _, v := range tt.versions {
+				installs = append(installs, Install{Version: v})
+			}
+			if got := ConflictingInstalls(installs); got != tt.want {
+				t.Errorf("ConflictingInstalls(%q) = %v, want %v", tt.versions, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionOfCachesVersionRuns(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "codex")
+	script := "#!/bin/sh\necho run >> " + calls + "\necho codex-cli 0.46.0\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		if v := versionOf(context.Background(), bin, bin); v != "0.46.0" {
+			t.Fatalf("versionOf = %q, want 0.46.0", v)
+		}
+	}
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "run"); n != 1 {
+		t.Errorf("--version ran %d times, want 1", n)
+	}
+}
+
+func TestInstallMethodOf(t *testing.T) {
+	const home = "/home/me"
+	tests := []struct {
+		name, path, target, want string
+	}{
+		{"native installer", "/home/me/.local/bin/claude", "/home/me/.local/share/claude/versions/2.1.14", MethodLocal},
+		{"binary in ~/.local/bin", "/home/me/.local/bin/claude", "/home/me/.local/bin/claude", MethodLocal},
+		{"older local install", "/home/me/.claude/local/claude", "/home/me/.claude/local/node_modules/@anthropic-ai/claude-code/cli.js", MethodLocal},
+		{"npm prefix in ~/.local", "/home/me/.local/bin/codex", "/home/me/.local/lib/node_modules/@openai/codex/bin/codex.js", MethodNpm},
+		{"Homebrew formula", "/opt/homebrew/bin/gemini", "/opt/homebrew/Cellar/gemini-cli/0.9.0/libexec/lib/node_modules/@google/gemini-cli/dist/index.js", MethodHomebrew},
+		{"Homebrew cask", "/opt/homebrew/bin/claude", "/opt/homebrew/Caskroom/claude-code/2.1.14/claude", MethodHomebrew},
+		{"Linuxbrew", "/home/linuxbrew/.linuxbrew/bin/codex", "/home/linuxbrew/.linuxbrew/Cellar/codex/0.46.0/bin/codex", MethodHomebrew},
+		{"npm global", "/usr/local/bin/codex", "/usr/local/lib/node_modules/@openai/codex/bin/codex.js", MethodNpm},
+		{"nvm", "/home/me/.nvm/versions/node/v22.0.0/bin/gemini", "/home/me/.nvm/versions/node/v22.0.0/lib/node_modules/@google/gemini-cli/dist/index.js", MethodNpm},
+		{"Nix store", "/home/me/.nix-profile/bin/claude", "/nix/store/abc123-claude-code-2.1.14/bin/claude", MethodNix},
+		{"Nix store npm package", "/run/current-system/sw/bin/codex", "/nix/store/def456-codex-0.46.0/lib/node_modules/@openai/codex/bin/codex.js", MethodNix},
+		{"elsewhere on PATH", "/usr/bin/claude", "/usr/bin/claude", MethodPath},
+		{"another user's ~/.local", "/home/you/.local/bin/claude", "/home/you/.local/bin/claude", MethodPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := installMethodOf(tt.path, tt.target, home); got != tt.want {
+				t.Errorf("installMethodOf(%q, %q) = %q, want %q", tt.path, tt.target, got, tt.want)
+			}
+		})
+	}
+
+	if got := installMethodOf("/home/me/.local/bin/claude", "/home/me/.local/bin/claude", ""); got != MethodPath {
+		t.Errorf("installMethodOf with no home = %q, want %q", got, MethodPath)
+	}
+}
+
+func TestInstallMethod(t *testing.T) {
+	// An install laid out like Homebrew's, found through PATH by its link
+	dir := t.TempDir()
+	target := filepath.Join(dir, "Cellar", "gemini-cli", "0.9.0", "bin", "gemini")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(bin, "gemini")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	method, got := InstallMethod("gemini")
+	if method != MethodHomebrew || got != target {
+		t.Errorf("InstallMethod = %q, %q; want %q, %q", method, got, MethodHomebrew, target)
+	}
+	if name, cask := BrewPackage(got); name != "gemini-cli" || cask {
+		t.Errorf("BrewPackage(%q) = %q, %v; want gemini-cli, false", got, name, cask)
+	}
+	if method, got := InstallMethod("codex"); method != "" || got != "" {
+		t.Errorf("InstallMethod of a missing agent = %q, %q; want nothing", method, got)
+	}
+}
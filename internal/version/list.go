@@ -0,0 +1,89 @@
+package version
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// LocalVersion is one version of an agent present on disk
+type LocalVersion struct {
+	Version     string    `json:"version"`
+	Active      bool      `json:"active"`
+	Path        string    `json:"path"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// claudeVersionsDir is where the Claude installer keeps every downloaded version
+func claudeVersionsDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "claude", "versions")
+}
+
+// ListInstalledClaude returns every Claude version in the local versions
+// directory, newest first. Install times come from the entries' mtimes.
+func ListInstalledClaude() ([]LocalVersion, error) {
+	dir := claudeVersionsDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	active, _ := GetInstalledClaude()
+
+	var versions []LocalVersion
+	for _, e := range entries {
+		if !semverRegex.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, LocalVersion{
+			Version:     e.Name(),
+			Active:      e.Name() == active,
+			Path:        filepath.Join(dir, e.Name()),
+			InstalledAt: info.ModTime(),
+		})
+	}
+
+	sortNewestFirst(versions)
+	return versions, nil
+}
+
+// ListInstalled returns the versions of an agent present on disk, newest
+// first. Only Claude's native installer keeps multiple versions side by side;
+// otherwise this is the single active install, if any.
+func ListInstalled(agent string) ([]LocalVersion, error) {
+	if agent == "claude" {
+		if versions, err := ListInstalledClaude(); err == nil && len(versions) > 0 {
+			return versions, nil
+		}
+	}
+
+	v, err := GetInstalled(agent)
+	if err != nil {
+		return nil, err
+	}
+	path, err := exec.LookPath(Binary(agent))
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	lv := LocalVersion{Version: v, Active: true, Path: path}
+	if info, err := os.Stat(path); err == nil {
+		lv.InstalledAt = info.ModTime()
+	}
+	return []LocalVersion{lv}, nil
+}
+
+func sortNewestFirst(versions []LocalVersion) {
+	sort.Slice(versions, func(i, j int) bool {
+		return Compare(versions[i].Version, versions[j].Version) > 0
+	})
+}
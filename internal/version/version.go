@@ -2,125 +2,443 @@
 package version
 
 import (
+	"cmp"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/buddyh/av/internal/runner"
+)
+
+// Errors returned by the GetInstalled* functions
+var (
+	// ErrNotInstalled means the agent binary couldn't be found
+	ErrNotInstalled = errors.New("not installed")
+	// ErrVersionUnparseable means the binary exists but its version couldn't be determined
+	ErrVersionUnparseable = errors.New("version unparseable")
+)
+
+// ErrOffline is returned by every fetch while SetOffline is on
+var ErrOffline = errors.New("offline: fetching latest versions is disabled")
+
+// Errors wrapped by the FetchLatest* functions, telling why a fetch failed
+var (
+	// ErrNetwork means the registry couldn't be reached
+	ErrNetwork = errors.New("network error")
+	// ErrBadStatus means the registry answered with an HTTP error
+	ErrBadStatus = errors.New("bad HTTP status")
+	// ErrBadResponse means the registry's answer had no version in it
+	ErrBadResponse = errors.New("unparseable response")
 )
 
+// offline makes get fail without touching the network
+var offline bool
+
+// SetOffline turns off all network access in this package, for commands
+// that promise not to make any
+func SetOffline(on bool) {
+	offline = on
+}
+
+// semverRegex matches a bare version like 2.1.14
+var semverRegex = regexp.MustCompile(`^\d+\.\d+\.\d+`)
+
 // GetInstalledClaude returns the installed Claude Code version
-func GetInstalledClaude() string {
-	// Method 1: Check symlink target
+func GetInstalledClaude() (string, error) {
+	return installedClaude(context.Background())
+}
+
+func installedClaude(ctx context.Context) (string, error) {
+	// Method 1: check symlink target (unless the user pointed us at another
+	// binary, which the native install's files say nothing about)
+	claudePath := Binary("claude")
+	_, overridden := binOverrides["claude"]
 	home, _ := os.UserHomeDir()
-	claudePath := filepath.Join(home, ".local", "bin", "claude")
+	if !overridden {
+		claudePath = filepath.Join(home, ".local", "bin", "claude")
+	}
 
 	target, err := os.Readlink(claudePath)
 	if err == nil {
 		// Extract version from path like /Users/buddy/.local/share/claude/versions/2.1.14
-		if idx := strings.LastIndex(target, "/"); idx != -1 {
-			return target[idx+1:]
+		if v := filepath.Base(target); semverRegex.MatchString(v) {
+			return v, nil
+		}
+	}
+
+	// Method 2: Read the version Claude records in its config. Only when
+	// there's no symlink to go by, as the record can outlive a switch to
+	// another install.
+	if !overridden {
+		if v := claudeConfigVersion(filepath.Join(home, ".claude", "config.json")); v != "" {
+			return v, nil
 		}
 	}
 
-	// Method 2: Run claude --version
-	out, err := exec.Command("claude", "--version").Output()
+	// Method 3: Run claude --version
+	return installedFromVersion(ctx, "claude")
+}
+
+// claudeConfigVersion returns the version Claude's config file records as
+// installed, {"version": "2.1.14", ...}. It returns "" if the file is
+// missing, isn't shaped like that, or names a version the native installer's
+// versions dir doesn't hold, as a record left behind by an older install
+// would.
+func claudeConfigVersion(path string) string {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return ""
 	}
-
-	// Parse "2.1.14 (Claude Code)"
-	version := strings.TrimSpace(string(out))
-	if idx := strings.Index(version, " "); idx != -1 {
-		return version[:idx]
+	var cfg struct {
+		Version any `json:"version"`
+	}
+	if json.Unmarshal(data, &cfg) != nil {
+		return ""
+	}
+	v, ok := cfg.Version.(string)
+	if !ok || !semverRegex.MatchString(v) {
+		return ""
+	}
+	if _, err := os.Stat(claudeVersionsDir()); err == nil {
+		if _, err := os.Stat(filepath.Join(claudeVersionsDir(), v)); err != nil {
+			return ""
+		}
 	}
-	return version
+	return v
 }
 
 // GetInstalledCodex returns the installed Codex version
-func GetInstalledCodex() string {
-	out, err := exec.Command("codex", "--version").Output()
+func GetInstalledCodex() (string, error) {
+	return installedFromVersion(context.Background(), "codex")
+}
+
+// GetInstalledGemini returns the installed Gemini CLI version
+func GetInstalledGemini() (string, error) {
+	return installedFromVersion(context.Background(), "gemini")
+}
+
+// installedFromVersion asks the agent's binary for its version
+func installedFromVersion(ctx context.Context, agent string) (string, error) {
+	out, err := runVersion(ctx, agent)
 	if err != nil {
-		return ""
+		return "", err
+	}
+	return parseVersionOutput(agent, out)
+}
+
+// parseVersionOutput extracts the version from an agent's --version output
+func parseVersionOutput(agent, out string) (string, error) {
+	version := out
+	switch agent {
+	case "claude":
+		// Parse "2.1.14 (Claude Code)"
+		if idx := strings.Index(version, " "); idx != -1 {
+			version = version[:idx]
+		}
+	default:
+		// Parse "codex-cli 0.80.0"; older gemini releases print just "0.9.0"
+		if parts := strings.Fields(out); len(parts) >= 2 {
+			version = parts[len(parts)-1]
+		}
+	}
+	if !semverRegex.MatchString(version) {
+		return "", fmt.Errorf("%s: %w: %q", agent, ErrVersionUnparseable, out)
+	}
+	return version, nil
+}
+
+// runVersion runs "<bin> --version" for an agent and returns its trimmed output
+func runVersion(ctx context.Context, agent string) (string, error) {
+	bin := Binary(agent)
+	if _, err := exec.LookPath(bin); err != nil {
+		return "", fmt.Errorf("%s: %w", agent, ErrNotInstalled)
+	}
+	out, err := runner.Local.Output(ctx, bin, "--version")
+	if err != nil {
+		return "", fmt.Errorf("%s --version: %w", bin, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// InstallStatus summarizes an error from GetInstalled* for JSON output:
+// "installed", "not_installed" or "version_unknown"
+func InstallStatus(err error) string {
+	switch {
+	case err == nil:
+		return "installed"
+	case errors.Is(err, ErrNotInstalled):
+		return "not_installed"
+	default:
+		return "version_unknown"
+	}
+}
+
+// FetchStatus summarizes an error from FetchLatest* for JSON output: "ok",
+// "offline", "network_error", "http_error", "parse_error" or "error"
+func FetchStatus(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrOffline):
+		return "offline"
+	case errors.Is(err, ErrNetwork):
+		return "network_error"
+	case errors.Is(err, ErrBadStatus):
+		return "http_error"
+	case errors.Is(err, ErrBadResponse):
+		return "parse_error"
+	default:
+		return "error"
+	}
+}
+
+// FetchProblem explains in a line why a FetchLatest* fetch failed, naming
+// the host where it can, e.g. "offline: api.github.com unreachable (DNS
+// lookup failed)". It returns "" for a nil error.
+func FetchProblem(err error) string {
+	host := "the registry"
+	var urlErr *neturl.Error
+	var statusErr *statusError
+	if errors.As(err, &urlErr) {
+		if u, perr := neturl.Parse(urlErr.URL); perr == nil && u.Host != "" {
+			host = u.Host
+		}
+	} else if errors.As(err, &statusErr) {
+		if u, perr := neturl.Parse(statusErr.url); perr == nil && u.Host != "" {
+			host = u.Host
+		}
 	}
 
-	// Parse "codex-cli 0.80.0"
-	version := strings.TrimSpace(string(out))
-	parts := strings.Fields(version)
-	if len(parts) >= 2 {
-		return parts[len(parts)-1]
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrOffline):
+		return "fetching is turned off"
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("offline: %s unreachable (DNS lookup failed)", host)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Sprintf("timeout: %s didn't answer in time", host)
+	case errors.As(err, &certErr), errors.As(err, &recordErr):
+		return fmt.Sprintf("TLS error talking to %s", host)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("%s refused the connection", host)
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return fmt.Sprintf("offline: %s unreachable (no route)", host)
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("%s answered HTTP %s", host, statusErr.status)
+	case errors.Is(err, ErrNetwork):
+		return fmt.Sprintf("network error reaching %s", host)
+	case errors.Is(err, ErrBadResponse):
+		return "unexpected response: no version in it"
+	default:
+		return err.Error()
 	}
-	return version
 }
 
 // FetchLatestClaude gets the latest Claude Code version from GitHub
-func FetchLatestClaude() string {
+func FetchLatestClaude() (string, error) {
+	return fetchLatestClaude(context.Background())
+}
+
+func fetchLatestClaude(ctx context.Context) (string, error) {
 	// Try GitHub releases API first
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := newClient()
 
-	resp, err := client.Get("https://api.github.com/repos/anthropics/claude-code/releases/latest")
-	if err == nil && resp.StatusCode == 200 {
-		defer resp.Body.Close()
-		var release struct {
-			TagName string `json:"tag_name"`
+	if claudePrerelease {
+		if v, err := fetchNewestClaudeRelease(ctx, client); err == nil {
+			return v, nil
 		}
-		if json.NewDecoder(resp.Body).Decode(&release) == nil {
-			// Remove 'v' prefix if present
-			return strings.TrimPrefix(release.TagName, "v")
+	}
+
+	resp, err := get(ctx, client, "https://api.github.com/repos/anthropics/claude-code/releases/latest")
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 200 {
+			var release struct {
+				TagName string `json:"tag_name"`
+			}
+			if json.NewDecoder(resp.Body).Decode(&release) == nil && release.TagName != "" {
+				// Remove 'v' prefix if present
+				return strings.TrimPrefix(release.TagName, "v"), nil
+			}
 		}
 	}
 
 	// Fallback: fetch CHANGELOG.md and parse first version
-	resp, err = client.Get("https://raw.githubusercontent.com/anthropics/claude-code/main/CHANGELOG.md")
+	const changelogURL = "https://raw.githubusercontent.com/anthropics/claude-code/main/CHANGELOG.md"
+	resp, err = get(ctx, client, changelogURL)
 	if err != nil {
-		return ""
+		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", badStatus(changelogURL, resp)
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return ""
+		return "", fmt.Errorf("%w: %w", ErrNetwork, err)
 	}
 
 	// Match version pattern like "## 2.1.14" or "# 2.1.14"
 	re := regexp.MustCompile(`##?\s*(\d+\.\d+\.\d+)`)
 	matches := re.FindSubmatch(body)
 	if len(matches) > 1 {
-		return string(matches[1])
+		return string(matches[1]), nil
+	}
+
+	return "", fmt.Errorf("%w: no version found in %s", ErrBadResponse, changelogURL)
+}
+
+// fetchNewestClaudeRelease returns the highest version among recent Claude
+// Code releases, pre-releases included. releases/latest skips those.
+func fetchNewestClaudeRelease(ctx context.Context, client *http.Client) (string, error) {
+	const url = "https://api.github.com/repos/anthropics/claude-code/releases?per_page=30"
+	resp, err := get(ctx, client, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", badStatus(url, resp)
+	}
+
+	var releases []struct {
+		TagName string `json:"tag_name"`
+		Draft   bool   `json:"draft"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", fmt.Errorf("%w: parse %s: %w", ErrBadResponse, url, err)
 	}
 
-	return ""
+	var newest string
+	for _, r := range releases {
+		v := strings.TrimPrefix(r.TagName, "v")
+		if r.Draft || !semverRegex.MatchString(v) {
+			continue
+		}
+		if Compare(v, newest) > 0 {
+			newest = v
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("%w: no releases in %s", ErrBadResponse, url)
+	}
+	return newest, nil
 }
 
 // FetchLatestCodex gets the latest Codex version from npm
-func FetchLatestCodex() string {
-	client := &http.Client{Timeout: 5 * time.Second}
+func FetchLatestCodex() (string, error) {
+	return FetchLatestContext(context.Background(), "codex")
+}
+
+// FetchLatestGemini gets the latest Gemini CLI version from npm
+func FetchLatestGemini() (string, error) {
+	return FetchLatestContext(context.Background(), "gemini")
+}
 
-	resp, err := client.Get("https://registry.npmjs.org/@openai/codex")
+// fetchNpmLatest reads the version an npm package's dist-tag (channel)
+// points at
+func fetchNpmLatest(ctx context.Context, pkgName, channel string) (string, error) {
+	client := newClient()
+
+	url := "https://registry.npmjs.org/" + pkgName
+	resp, err := get(ctx, client, url)
 	if err != nil {
-		return ""
+		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", badStatus(url, resp)
+	}
 
 	var pkg struct {
-		DistTags struct {
-			Latest string `json:"latest"`
-		} `json:"dist-tags"`
+		DistTags map[string]string `json:"dist-tags"`
 	}
 
-	if json.NewDecoder(resp.Body).Decode(&pkg) != nil {
-		return ""
+	if err := json.NewDecoder(resp.Body).Decode(&pkg); err != nil {
+		return "", fmt.Errorf("%w: parse %s: %w", ErrBadResponse, url, err)
+	}
+	if pkg.DistTags[channel] == "" {
+		return "", fmt.Errorf("%w: no %s dist-tag for %s", ErrBadResponse, channel, pkgName)
+	}
+
+	return pkg.DistTags[channel], nil
+}
+
+// transport carries every fetch's requests
+var transport http.RoundTripper = http.DefaultTransport
+
+// SetTransport makes every fetch send its requests through rt, e.g. so a
+// test can answer or count them; nil restores the default
+func SetTransport(rt http.RoundTripper) {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	transport = rt
+}
+
+// newClient returns a client for one fetch
+func newClient() *http.Client {
+	return &http.Client{Timeout: 5 * time.Second, Transport: transport}
+}
+
+// get fetches url, abandoning the request when ctx is done. Every fetch in
+// this package goes through it, so it enforces SetOffline. A request that
+// fails outright wraps ErrNetwork.
+func get(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	if offline {
+		return nil, ErrOffline
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNetwork, err)
 	}
+	return resp, nil
+}
+
+// badStatus is the error for a non-200 response to url
+func badStatus(url string, resp *http.Response) error {
+	return &statusError{url: url, status: resp.Status}
+}
+
+// statusError is a non-200 response; it matches ErrBadStatus
+type statusError struct {
+	url    string
+	status string
+}
 
-	return pkg.DistTags.Latest
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v: GET %s: %s", ErrBadStatus, e.url, e.status)
 }
 
-// Compare returns -1 if a < b, 0 if a == b, 1 if a > b
+func (e *statusError) Unwrap() error { return ErrBadStatus }
+
+// Compare returns -1 if a < b, 0 if a == b, 1 if a > b, following semver
+// precedence: a pre-release like 2.1.0-beta.1 ranks below 2.1.0, and build
+// metadata (+...) is ignored
 func Compare(a, b string) int {
 	if a == b {
 		return 0
@@ -132,8 +450,13 @@ func Compare(a, b string) int {
 		return 1
 	}
 
-	aParts := strings.Split(a, ".")
-	bParts := strings.Split(b, ".")
+	a, _, _ = strings.Cut(a, "+")
+	b, _, _ = strings.Cut(b, "+")
+	aCore, aPre, aIsPre := strings.Cut(a, "-")
+	bCore, bPre, bIsPre := strings.Cut(b, "-")
+
+	aParts := strings.Split(aCore, ".")
+	bParts := strings.Split(bCore, ".")
 
 	for i := 0; i < len(aParts) && i < len(bParts); i++ {
 		var aNum, bNum int
@@ -153,5 +476,79 @@ func Compare(a, b string) int {
 	if len(aParts) > len(bParts) {
 		return 1
 	}
-	return 0
+
+	switch {
+	case aIsPre && !bIsPre:
+		return -1
+	case !aIsPre && bIsPre:
+		return 1
+	case !aIsPre && !bIsPre:
+		return 0
+	}
+	return comparePrerelease(aPre, bPre)
+}
+
+// comparePrerelease orders two pre-release tags by semver's rules: dot
+// separated identifiers compared in turn, numeric ones numerically and
+// below alphanumeric ones, with a shorter tag first when one is a prefix
+// of the other (beta < beta.1)
+func comparePrerelease(a, b string) int {
+	aIDs := strings.Split(a, ".")
+	bIDs := strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.Atoi(aIDs[i])
+		bNum, bErr := strconv.Atoi(bIDs[i])
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = cmp.Compare(aNum, bNum)
+		case aErr == nil:
+			c = -1
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(aIDs[i], bIDs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(aIDs), len(bIDs))
+}
+
+// Delta returns how far from lags behind to, as the difference in the first
+// component that differs: 2.1.14 -> 3.0.1 is (1, 0, 0), 2.1.14 -> 2.3.0 is
+// (0, 2, 0). All zero when from isn't older than to.
+func Delta(from, to string) (major, minor, patch int) {
+	if from == "" || to == "" || Compare(from, to) >= 0 {
+		return 0, 0, 0
+	}
+
+	var f, t [3]int
+	for i, part := range strings.SplitN(from, ".", 3) {
+		fmt.Sscanf(part, "%d", &f[i])
+	}
+	for i, part := range strings.SplitN(to, ".", 3) {
+		fmt.Sscanf(part, "%d", &t[i])
+	}
+
+	switch {
+	case f[0] != t[0]:
+		return t[0] - f[0], 0, 0
+	case f[1] != t[1]:
+		return 0, t[1] - f[1], 0
+	default:
+		return 0, 0, t[2] - f[2]
+	}
+}
+
+// IsVersion reports whether s looks like a version av can compare, e.g. 2.1.14
+func IsVersion(s string) bool {
+	return semverRegex.MatchString(s)
+}
+
+// BelowMinimum reports whether v is older than the required minimum. An
+// unknown version or an empty minimum is never below it.
+func BelowMinimum(v, minimum string) bool {
+	return v != "" && minimum != "" && Compare(v, minimum) < 0
 }
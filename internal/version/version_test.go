@@ -0,0 +1,41 @@
+package version
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.1.14", "2.1.14", 0},
+		{"2.1.14", "2.1.9", 1},
+		{"2.0.1", "2.1.0", -1},
+		{"10.0.0", "9.9.9", 1},
+		{"2.1", "2.1.0", -1},
+		{"", "2.1.0", -1},
+		{"2.1.0", "", 1},
+		{"2.1.0-beta.1", "2.1.0", -1},
+		{"2.1.0", "2.1.0-beta.1", 1},
+		{"2.1.0-beta.1", "2.0.9", 1},
+		{"2.1.0-alpha", "2.1.0-alpha.1", -1},
+		{"2.1.0-alpha.1", "2.1.0-alpha.beta", -1},
+		{"2.1.0-alpha.beta", "2.1.0-beta", -1},
+		{"2.1.0-beta.2", "2.1.0-beta.11", -1},
+		{"2.1.0-rc.1", "2.1.0-beta.11", 1},
+		{"2.1.0+build.5", "2.1.0", 0},
+		{"2.1.0-rc.1+build.5", "2.1.0-rc.1", 0},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAgentWidthFitsAgents(t *testing.T) {
+	for _, agent := range Agents {
+		if len(agent) > AgentWidth {
+			t.Errorf("agent %q is wider than AgentWidth %d", agent, AgentWidth)
+		}
+	}
+}